@@ -1,94 +1,87 @@
 package api
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"sort"
 	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/params"
+	"storage_extract/rawdb"
 	"storage_extract/state"
 	"storage_extract/trie"
 	"storage_extract/trie/trienode"
+	"storage_extract/triedb"
+	"storage_extract/vm"
+	"strconv"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gin-gonic/gin"
 	"github.com/holiman/uint256"
 )
 
-// Global state database instances
-var (
-	db                    = &state.CachingDB{}
-	stateDB               *state.StateDB
-	stateRoot             = common.Hash{}
-	originalKeyValuePairs = make(map[common.Address]map[common.Hash]common.Hash)
-	proofSet              = trienode.NewProofSet()
-)
+// sessions holds the isolated workspaces the handlers run on.
+var sessions *sessionManager
 
 func init() {
 	var err error
-	stateDB, err = state.New(stateRoot, db)
+	sessions, err = newSessionManager(memorydb.New(), nil)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize stateDB: %v", err))
 	}
 }
 
-// StartServer starts the Gin HTTP server
-func StartServer(port string) error {
-	// Set Gin to release mode for production
-	gin.SetMode(gin.ReleaseMode)
-
-	// Create Gin router
-	r := gin.Default()
-
-	// Setup static file serving
-	setupStaticFileServer(r)
-
-	// Setup API routes
-	setupAPIHandlers(r)
-
-	// Start HTTP server
-	fmt.Println("Server started, listening on port", port)
-	return r.Run(":" + port)
-}
-
-// setupAPIHandlers registers API endpoint handlers with Gin router
-func setupAPIHandlers(r *gin.Engine) {
-	api := r.Group("/api")
-	{
-		account := api.Group("/account")
-		{
-			account.POST("/create", ginHandleCreateAccount)
-			account.POST("/get", ginHandleGetAccount)
-		}
-
-		api.POST("/storage/update", ginHandleUpdateStorage)
-		api.POST("/proof", ginHandleProof)
-		api.POST("/storage/get", ginHandleGetValue)
+// SetupDatabase replaces the sessions with a default one backed by the given
+// key-value store, storing trie nodes in the given scheme ("hash" or "path").
+// The sessions created later use the same scheme on an in-memory store. It
+// must be called before the server is started.
+func SetupDatabase(disk ethdb.KeyValueStore, scheme string) error {
+	var config *triedb.Config
+	switch scheme {
+	case rawdb.HashScheme:
+		config = triedb.HashDefaults
+	case rawdb.PathScheme:
+		config = triedb.PathDefaults
+	default:
+		return fmt.Errorf("unknown state scheme %q", scheme)
+	}
+	manager, err := newSessionManager(disk, config)
+	if err != nil {
+		return err
 	}
+	sessions = manager
+	return nil
 }
 
-// setupStaticFileServer configures static file serving with Gin
-func setupStaticFileServer(r *gin.Engine) {
-	// First check if front directory exists
-	frontDir := "./front"
-	if _, err := os.Stat(frontDir); os.IsNotExist(err) {
-		// If front directory doesn't exist, try frontend directory
-		frontDir = "./frontend"
-		if _, err := os.Stat(frontDir); os.IsNotExist(err) {
-			// If neither directory exists, print warning
-			fmt.Println("WARNING: Neither 'front' nor 'frontend' directory exists!")
-			fmt.Println("Please create either 'front' or 'frontend' directory with HTML/CSS/JS files.")
-			return
-		}
+// registerAPIRoutes registers the handlers running on a session.
+func registerAPIRoutes(api *gin.RouterGroup) {
+	account := api.Group("/account")
+	{
+		account.POST("/create", ginHandleCreateAccount)
+		account.POST("/get", ginHandleGetAccount)
+		account.POST("/set", ginHandleSetAccount)
+		account.POST("/selfdestruct", ginHandleSelfDestruct)
 	}
 
-	// Print the frontend directory being used
-	absPath, _ := filepath.Abs(frontDir)
-	fmt.Printf("Serving frontend files from: %s\n", absPath)
-
-	// Set up static file server with Gin
-	r.Static("/", frontDir)
+	api.POST("/storage/update", ginHandleUpdateStorage)
+	api.POST("/storage/simulate", ginHandleSimulateCalls)
+	api.POST("/storage/transient", ginHandleTransientStorage)
+	api.POST("/storage/gas", ginHandleStorageGas)
+	api.POST("/storage/range", ginHandleStorageRange)
+	api.POST("/proof", ginHandleProof)
+	api.POST("/proof/range", ginHandleRangeProof)
+	api.POST("/proof/generate", ginHandleGenerateProof)
+	api.POST("/storage/get", ginHandleGetValue)
+	api.POST("/db/nodes", ginHandleNodeStorage)
+	api.POST("/history/versions", ginHandleListVersions)
+	api.POST("/history/open", ginHandleOpenVersion)
+	api.POST("/trie/diff", ginHandleTrieDiff)
 }
 
 // debugLogRequest is a helper function to log request details for Gin
@@ -106,9 +99,60 @@ func debugLogRequest(c *gin.Context) {
 	}
 }
 
+// slot is a storage slot written by a request.
+type slot struct{ key, value common.Hash }
+
+// parseSlots parses the hex-encoded slots of a request, in the order of their
+// keys. Keys and values are decoded like the storage keys of eth_getStorageAt,
+// so that the routes writing slots and storage_setState accept the same
+// encodings. Keys encoded differently but decoding to the same slot are
+// rejected, since either value could win.
+func parseSlots(storage map[string]string) ([]slot, error) {
+	slots := make([]slot, 0, len(storage))
+	for keyHex, valueHex := range storage {
+		w, err := parseSlot(keyHex, valueHex)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, w)
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return bytes.Compare(slots[i].key[:], slots[j].key[:]) < 0
+	})
+	for i := 1; i < len(slots); i++ {
+		if slots[i].key == slots[i-1].key {
+			return nil, fmt.Errorf("storage key %x given twice", slots[i].key)
+		}
+	}
+	return slots, nil
+}
+
+// parseSlot parses a single hex-encoded slot, see parseSlots.
+func parseSlot(keyHex, valueHex string) (slot, error) {
+	key, err := parseSlotKey(keyHex)
+	if err != nil {
+		return slot{}, err
+	}
+	value, _, err := decodeHash(valueHex)
+	if err != nil {
+		return slot{}, fmt.Errorf("invalid storage value %q: %v", valueHex, err)
+	}
+	return slot{key, value}, nil
+}
+
+// parseSlotKey parses the hex-encoded key of a slot, see parseSlots.
+func parseSlotKey(keyHex string) (common.Hash, error) {
+	key, _, err := decodeHash(keyHex)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid storage key %q: %v", keyHex, err)
+	}
+	return key, nil
+}
+
 // ginHandleCreateAccount handles account creation requests
 func ginHandleCreateAccount(c *gin.Context) {
 	debugLogRequest(c)
+	s := currentSession(c)
 
 	var req struct {
 		Address string `json:"address"`
@@ -122,8 +166,8 @@ func ginHandleCreateAccount(c *gin.Context) {
 	addr := common.HexToAddress(req.Address)
 	// Create a new state object if it doesn't exist, since stateDB doesn't expose getOrNewStateObject
 	// We'll access it via SetState which internally calls getOrNewStateObject
-	stateDB.SetState(addr, common.Hash{}, common.Hash{}) // This will create the account if it doesn't exist
-	obj := stateDB.GetStateObject(addr)
+	s.stateDB.SetState(addr, common.Hash{}, common.Hash{}) // This will create the account if it doesn't exist
+	obj := s.stateDB.GetStateObject(addr)
 	if obj == nil {
 		ginWriteError(c, "Could not create or get account", http.StatusInternalServerError)
 		return
@@ -135,6 +179,7 @@ func ginHandleCreateAccount(c *gin.Context) {
 // ginHandleGetAccount handles account retrieval requests
 func ginHandleGetAccount(c *gin.Context) {
 	debugLogRequest(c)
+	s := currentSession(c)
 
 	var req struct {
 		Address string `json:"address"`
@@ -145,101 +190,708 @@ func ginHandleGetAccount(c *gin.Context) {
 		return
 	}
 
+	// Reading an account must not create it, an unknown one is shown empty
+	obj := s.stateDB.ReadStateObject(common.HexToAddress(req.Address))
+	ginWriteTrieResponse(c, "success", req.Address, obj)
+}
+
+// ginHandleSetAccount handles account field update requests. Each of balance,
+// nonce and code is optional, only the provided fields are changed.
+func ginHandleSetAccount(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string  `json:"address"`
+		Balance *string `json:"balance"`
+		Nonce   *string `json:"nonce"`
+		Code    *string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
 	addr := common.HexToAddress(req.Address)
-	obj := stateDB.GetStateObject(addr)
+	if req.Balance != nil {
+		// Accept both hex (0x...) and decimal balances
+		balance, err := uint256.FromHex(*req.Balance)
+		if err != nil {
+			balance, err = uint256.FromDecimal(*req.Balance)
+		}
+		if err != nil {
+			ginWriteError(c, "Invalid balance format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.stateDB.SetBalance(addr, balance)
+	}
+	if req.Nonce != nil {
+		nonce, err := strconv.ParseUint(*req.Nonce, 0, 64)
+		if err != nil {
+			ginWriteError(c, "Invalid nonce format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.stateDB.SetNonce(addr, nonce)
+	}
+	if req.Code != nil {
+		code, err := hexutil.Decode(*req.Code)
+		if err != nil {
+			ginWriteError(c, "Invalid code format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.stateDB.SetCode(addr, code)
+	}
+
+	// Write the account changes into the account trie
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	obj := s.stateDB.ReadStateObject(addr)
 	if obj == nil {
-		ginWriteError(c, "Could not get account", http.StatusInternalServerError)
+		ginWriteError(c, "Could not get account after update", http.StatusInternalServerError)
 		return
 	}
-	// Do NOT call finalise or updateTrie here
 	ginWriteTrieResponse(c, "success", req.Address, obj)
 }
 
-// ginHandleUpdateStorage handles storage update requests - consolidates batch storage and trie update
-func ginHandleUpdateStorage(c *gin.Context) {
+// ginHandleSelfDestruct executes a SELFDESTRUCT of the account, sending its
+// balance to the beneficiary if one is given. With eip6780 the Cancun rules
+// apply and the account is only deleted if it was created in the same
+// transaction, which newContract simulates. A deleted account is removed from
+// the account trie along with its whole storage trie.
+func ginHandleSelfDestruct(c *gin.Context) {
 	debugLogRequest(c)
+	s := currentSession(c)
 
 	var req struct {
-		Address string            `json:"address"`
-		Storage map[string]string `json:"storage"`
+		Address     string `json:"address"`
+		Beneficiary string `json:"beneficiary"`
+		EIP6780     bool   `json:"eip6780"`
+		NewContract bool   `json:"newContract"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	addr := common.HexToAddress(req.Address)
+	if !s.stateDB.Exist(addr) {
+		ginWriteError(c, "Account not found", http.StatusNotFound)
+		return
+	}
+	if req.NewContract {
+		s.stateDB.CreateContract(addr)
+	}
+	// Move the balance to the beneficiary the way the opcode does, the
+	// balance is burnt if there is no beneficiary.
+	balance := s.stateDB.GetBalance(addr).Clone()
+	if req.Beneficiary != "" {
+		s.stateDB.AddBalance(common.HexToAddress(req.Beneficiary), balance)
+	}
+	destructed := true
+	if req.EIP6780 {
+		s.stateDB.SubBalance(addr, balance)
+		_, destructed = s.stateDB.SelfDestruct6780(addr)
+	} else {
+		s.stateDB.SelfDestruct(addr)
+	}
+
+	// The self-destructed account is deleted at the end of the transaction
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	if destructed {
+		delete(s.originalKeyValuePairs, addr)
+	}
+	exists := s.stateDB.Exist(addr)
+
+	// A deleted account is shown empty, without being created again
+	obj := s.stateDB.ReadStateObject(addr)
+	resp, err := s.trieResponse("success", req.Address, obj)
+	if err != nil {
+		ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["destructed"] = destructed
+	resp["exists"] = exists
+	c.JSON(http.StatusOK, resp)
+}
+
+// ginHandleSimulateCalls simulates a stack of nested calls writing to the storage
+// of an account. Each call runs inside its own snapshot taken after the calls
+// enclosing it, and the calls marked to revert are rolled back from the
+// innermost outwards, the way the EVM unwinds a failing inner call. The storage
+// slots restored by every revert are reported along with the resulting trie.
+func ginHandleSimulateCalls(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+		Calls   []struct {
+			Storage map[string]string `json:"storage"`
+			Revert  bool              `json:"revert"`
+		} `json:"calls"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if len(req.Calls) == 0 {
+		ginWriteError(c, "No calls to simulate", http.StatusBadRequest)
+		return
+	}
+
+	// Parse all the calls up front so that nothing is applied on bad input
+	writes := make([][]slot, len(req.Calls))
+	for i, call := range req.Calls {
+		slots, err := parseSlots(call.Storage)
+		if err != nil {
+			ginWriteError(c, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writes[i] = slots
+	}
 
 	addr := common.HexToAddress(req.Address)
-	obj := stateDB.GetStateObject(addr)
+	obj := s.stateDB.GetStateObject(addr)
 	if obj == nil {
 		ginWriteError(c, "Could not get account", http.StatusInternalServerError)
 		return
 	}
 
-	// Initialize the map for this address if it doesn't exist
-	if originalKeyValuePairs[addr] == nil {
-		originalKeyValuePairs[addr] = make(map[common.Hash]common.Hash)
+	// Enter the calls from the outermost one, taking a snapshot before each
+	snapshots := make([]int, len(req.Calls))
+	for i := range req.Calls {
+		snapshots[i] = s.stateDB.Snapshot()
+		for _, w := range writes[i] {
+			s.stateDB.SetState(addr, w.key, w.value)
+		}
 	}
 
-	for keyHex, valueHex := range req.Storage {
-		// Convert hex strings to uint256.Int with error handling
-		key, err := uint256.FromHex(keyHex)
+	// Unwind the calls from the innermost one, reverting the failing ones
+	var rolledBack []map[string]interface{}
+	survived := len(req.Calls)
+	for i := len(req.Calls) - 1; i >= 0; i-- {
+		if !req.Calls[i].Revert {
+			continue
+		}
+		changes, err := s.stateDB.StorageChangesSince(snapshots[i])
 		if err != nil {
-			ginWriteError(c, "Invalid key format: "+err.Error(), http.StatusBadRequest)
+			ginWriteError(c, "Failed to roll back the call: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		for _, change := range changes {
+			rolledBack = append(rolledBack, map[string]interface{}{
+				"call":      i,
+				"key":       fmt.Sprintf("0x%x", change.Key.Bytes()),
+				"discarded": fmt.Sprintf("0x%x", s.stateDB.GetState(change.Address, change.Key).Bytes()),
+				"restored":  fmt.Sprintf("0x%x", change.Prev.Bytes()),
+			})
+		}
+		s.stateDB.RevertToSnapshot(snapshots[i])
+		survived = i
+	}
+
+	// Only the writes of the calls enclosing every revert are kept
+	if s.originalKeyValuePairs[addr] == nil {
+		s.originalKeyValuePairs[addr] = make(map[common.Hash]common.Hash)
+	}
+	for i := 0; i < survived; i++ {
+		for _, w := range writes[i] {
+			// A slot cleared by the surviving writes is no longer a key-value pair
+			if value := obj.GetState(w.key); value == (common.Hash{}) {
+				delete(s.originalKeyValuePairs[addr], w.key)
+			} else {
+				s.originalKeyValuePairs[addr][w.key] = value
+			}
+		}
+	}
 
-		value, err := uint256.FromHex(valueHex)
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	obj = s.stateDB.ReadStateObject(addr)
+	if obj == nil {
+		ginWriteError(c, "Could not get account after simulation", http.StatusInternalServerError)
+		return
+	}
+	resp, err := s.trieResponse("success", req.Address, obj)
+	if err != nil {
+		ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["rolledBack"] = rolledBack
+	c.JSON(http.StatusOK, resp)
+}
+
+// ginHandleTransientStorage runs a transaction writing the given slots into the
+// transient storage (EIP-1153) of an account. The slots are read back within
+// the transaction, like TLOAD would, and once more after the transaction
+// ends, when they are already discarded. The storage root and the state root
+// are reported from before and after the transaction to show that transient
+// slots never reach the tries.
+func ginHandleTransientStorage(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string            `json:"address"`
+		Storage map[string]string `json:"storage"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Storage) == 0 {
+		ginWriteError(c, "No transient storage to set", http.StatusBadRequest)
+		return
+	}
+
+	// Parse all the slots up front so that nothing is applied on bad input
+	writes, err := parseSlots(req.Storage)
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Transient storage lives outside of the accounts, so the account is only
+	// read and an unknown one isn't created
+	addr := common.HexToAddress(req.Address)
+	stateRootBefore := s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	storageRootBefore := s.stateDB.ReadStateObject(addr).GetRoot()
+
+	// TSTORE the slots and TLOAD them back within the same transaction
+	for _, w := range writes {
+		s.stateDB.SetTransientState(addr, w.key, w.value)
+	}
+	during := make([]common.Hash, len(writes))
+	for i, w := range writes {
+		during[i] = s.stateDB.GetTransientState(addr, w.key)
+	}
+
+	// End the transaction, the transient storage is discarded in Finalise
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	if s.latestStateRoot != stateRootBefore {
+		ginWriteError(c, "Transient storage changed the state root", http.StatusInternalServerError)
+		return
+	}
+
+	var slots []map[string]interface{}
+	for i, w := range writes {
+		slots = append(slots, map[string]interface{}{
+			"key":     fmt.Sprintf("0x%x", w.key.Bytes()),
+			"during":  fmt.Sprintf("0x%x", during[i].Bytes()),
+			"afterTx": fmt.Sprintf("0x%x", s.stateDB.GetTransientState(addr, w.key).Bytes()),
+		})
+	}
+	resp, err := s.trieResponse("success", req.Address, s.stateDB.ReadStateObject(addr))
+	if err != nil {
+		ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["transient"] = slots
+	resp["storageRootBefore"] = storageRootBefore.Hex()
+	resp["stateRootBefore"] = stateRootBefore.Hex()
+	c.JSON(http.StatusOK, resp)
+}
+
+// ginHandleStorageGas runs a transaction of SLOAD and SSTORE operations on the
+// storage of an account and reports the gas of every operation under the rules
+// of the selected fork, London by default: EIP-2200 net gas metering, EIP-2929
+// warm/cold access from Berlin and the EIP-3529 refunds from London. The slots
+// of the optional EIP-2930 access list are warm from the start of the
+// transaction. The writes are kept in the state.
+func ginHandleStorageGas(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+		Fork    string `json:"fork"`
+		Ops     []struct {
+			Op    string `json:"op"`
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"ops"`
+		AccessList []string `json:"accessList"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Ops) == 0 {
+		ginWriteError(c, "No operations to run", http.StatusBadRequest)
+		return
+	}
+	rules, err := params.RulesForFork(req.Fork)
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+	calc := vm.NewStorageGas(rules)
+	if len(req.AccessList) > 0 && !calc.HasAccessList() {
+		ginWriteError(c, "Access lists are not supported before Berlin", http.StatusBadRequest)
+		return
+	}
+
+	// Parse all the operations up front so that nothing is applied on bad input
+	type operation struct {
+		store      bool
+		key, value common.Hash
+	}
+	ops := make([]operation, len(req.Ops))
+	for i, op := range req.Ops {
+		switch strings.ToLower(op.Op) {
+		case "sload":
+		case "sstore":
+			ops[i].store = true
+		default:
+			ginWriteError(c, "Unknown operation: "+op.Op, http.StatusBadRequest)
+			return
+		}
+		if !ops[i].store {
+			key, err := parseSlotKey(op.Key)
+			if err != nil {
+				ginWriteError(c, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ops[i].key = key
+			continue
+		}
+		w, err := parseSlot(op.Key, op.Value)
 		if err != nil {
-			ginWriteError(c, "Invalid value format: "+err.Error(), http.StatusBadRequest)
+			ginWriteError(c, err.Error(), http.StatusBadRequest)
 			return
 		}
+		ops[i].key, ops[i].value = w.key, w.value
+	}
+	var accessList []common.Hash
+	for _, keyHex := range req.AccessList {
+		key, err := parseSlotKey(keyHex)
+		if err != nil {
+			ginWriteError(c, "Invalid access list: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		accessList = append(accessList, key)
+	}
+
+	addr := common.HexToAddress(req.Address)
+
+	// The called contract is always warm, the slots of the access list are
+	// warmed up by paying for them upfront.
+	s.stateDB.AddAddressToAccessList(addr)
+	var accessListGas uint64
+	if len(accessList) > 0 {
+		accessListGas = params.TxAccessListAddressGas
+	}
+	for _, key := range accessList {
+		s.stateDB.AddSlotToAccessList(addr, key)
+		accessListGas += params.TxAccessListStorageKeyGas
+	}
+
+	var (
+		report []map[string]interface{}
+		opsGas uint64
+	)
+	for _, op := range ops {
+		var entry map[string]interface{}
+		if op.store {
+			entry = s.storeWithGas(calc, addr, op.key, op.value)
+		} else {
+			entry = s.loadWithGas(calc, addr, op.key)
+		}
+		report = append(report, entry)
+		opsGas += entry["gas"].(uint64)
+	}
+	refund := s.stateDB.GetRefund()
+
+	// Track the written slots the same way a storage update does
+	if s.originalKeyValuePairs[addr] == nil {
+		s.originalKeyValuePairs[addr] = make(map[common.Hash]common.Hash)
+	}
+	for _, op := range ops {
+		if !op.store {
+			continue
+		}
+		if value := s.stateDB.GetState(addr, op.key); value == (common.Hash{}) {
+			delete(s.originalKeyValuePairs[addr], op.key)
+		} else {
+			s.originalKeyValuePairs[addr][op.key] = value
+		}
+	}
+
+	// End the transaction, the access list and the refund counter are reset.
+	// An account only loaded from is left as it was, even if it doesn't exist.
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	obj := s.stateDB.ReadStateObject(addr)
+	resp, err := s.trieResponse("success", req.Address, obj)
+	if err != nil {
+		ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["gasReport"] = map[string]interface{}{
+		"fork":          rules.Name(),
+		"ops":           report,
+		"accessListGas": accessListGas,
+		"totalGas":      accessListGas + opsGas,
+		"refund":        refund,
+		"summary":       gasSummary(calc, opsGas, accessListGas, refund),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loadWithGas executes an SLOAD of the slot and reports its gas. The access is
+// cold if the slot was not in the access list yet, which is only tracked from
+// Berlin on.
+func (s *session) loadWithGas(calc *vm.StorageGas, addr common.Address, key common.Hash) map[string]interface{} {
+	entry := s.storageOpEntry(calc, addr, key)
+	entry["op"] = "SLOAD"
+	entry["value"] = entry["current"]
+	entry["gas"] = calc.SLoad(s.stateDB, addr, key)
+	entry["refund"] = int64(0)
+	return entry
+}
+
+// storeWithGas executes an SSTORE writing the value into the slot and reports
+// its gas along with the change of the refund counter, which is negative when
+// a previously granted refund is taken back.
+func (s *session) storeWithGas(calc *vm.StorageGas, addr common.Address, key, value common.Hash) map[string]interface{} {
+	entry := s.storageOpEntry(calc, addr, key)
+	var (
+		original   = s.stateDB.GetCommittedState(addr, key)
+		current    = s.stateDB.GetState(addr, key)
+		refundPrev = s.stateDB.GetRefund()
+	)
+	entry["op"] = "SSTORE"
+	entry["value"] = fmt.Sprintf("0x%x", value.Bytes())
+	entry["case"] = vm.SStoreCase(original, current, value)
+	entry["gas"] = calc.SStore(s.stateDB, addr, key, value)
+	entry["refund"] = int64(s.stateDB.GetRefund()) - int64(refundPrev)
+	s.stateDB.SetState(addr, key, value)
+	return entry
+}
+
+// storageOpEntry reports the slot a storage operation is about to access. The
+// access is empty before Berlin, since slots have no warm/cold state there.
+func (s *session) storageOpEntry(calc *vm.StorageGas, addr common.Address, key common.Hash) map[string]interface{} {
+	access := ""
+	if calc.HasAccessList() {
+		access = "warm"
+		if _, warm := s.stateDB.SlotInAccessList(addr, key); !warm {
+			access = "cold"
+		}
+	}
+	return map[string]interface{}{
+		"key":      fmt.Sprintf("0x%x", key.Bytes()),
+		"original": fmt.Sprintf("0x%x", s.stateDB.GetCommittedState(addr, key).Bytes()),
+		"current":  fmt.Sprintf("0x%x", s.stateDB.GetState(addr, key).Bytes()),
+		"access":   access,
+	}
+}
 
-		originalKeyValuePairs[addr][key.Bytes32()] = value.Bytes32()
-		stateDB.SetState(addr, key.Bytes32(), value.Bytes32())
+// gasSummary sums up the gas of a transaction running the storage operations.
+// The gas used includes the intrinsic gas of a plain call, since the refund
+// is capped to a fraction of the whole transaction, not just its opcodes.
+func gasSummary(calc *vm.StorageGas, opsGas, accessListGas, refundCounter uint64) map[string]interface{} {
+	gasUsed := params.TxGas + accessListGas + opsGas
+	refund := calc.Refund(gasUsed, refundCounter)
+	return map[string]interface{}{
+		"intrinsicGas":  params.TxGas,
+		"accessListGas": accessListGas,
+		"opsGas":        opsGas,
+		"gasUsed":       gasUsed,
+		"refundCounter": refundCounter,
+		"refund":        refund,
+		"netGas":        gasUsed - refund,
+	}
+}
+
+// ginHandleUpdateStorage handles storage update requests - consolidates batch storage and trie update.
+// The batch is priced as one transaction under the rules of the selected fork,
+// London by default, reporting the gas and refund of every SSTORE.
+func ginHandleUpdateStorage(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string            `json:"address"`
+		Fork    string            `json:"fork"`
+		Storage map[string]string `json:"storage"`
+		Trace   bool              `json:"trace"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rules, err := params.RulesForFork(req.Fork)
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+	calc := vm.NewStorageGas(rules)
+
+	// Parse all the slots up front so that nothing is applied on bad input
+	writes, err := parseSlots(req.Storage)
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	addr := common.HexToAddress(req.Address)
+	obj := s.stateDB.GetStateObject(addr)
+	if obj == nil {
+		ginWriteError(c, "Could not get account", http.StatusInternalServerError)
+		return
+	}
+
+	// Initialize the map for this address if it doesn't exist
+	if s.originalKeyValuePairs[addr] == nil {
+		s.originalKeyValuePairs[addr] = make(map[common.Hash]common.Hash)
+	}
+
+	// The slots are written in key order so that the gas report is
+	// deterministic. The batch runs as a single transaction calling the
+	// account, which is therefore warm, while every slot starts out cold.
+	s.stateDB.AddAddressToAccessList(addr)
+	var (
+		report []map[string]interface{}
+		opsGas uint64
+	)
+	for _, w := range writes {
+		// A zero value clears the slot, so it's no longer a key-value pair
+		if w.value == (common.Hash{}) {
+			delete(s.originalKeyValuePairs[addr], w.key)
+		} else {
+			s.originalKeyValuePairs[addr][w.key] = w.value
+		}
+		entry := s.storeWithGas(calc, addr, w.key, w.value)
+		report = append(report, entry)
+		opsGas += entry["gas"].(uint64)
+	}
+	refund := s.stateDB.GetRefund()
+
+	// Record how the storage trie is restructured by the batch, key by key.
+	// The trie is loaded in full beforehand so that every step shows the
+	// whole trie rather than the nodes on the written paths only.
+	var insertTrace *trie.InsertTrace
+	if req.Trace {
+		if tr := obj.GetTrie(); tr != nil {
+			if stateTrie, ok := (*tr).(*trie.StateTrie); ok && stateTrie != nil {
+				if err := stateTrie.ResolveAll(); err != nil {
+					ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				insertTrace = trie.NewInsertTrace()
+				stateTrie.SetInsertTrace(insertTrace)
+				defer stateTrie.SetInsertTrace(nil)
+			}
+		}
 	}
 
 	// Force trie update to generate the actual trie keys
-	stateDB.Commit(0, false) // Call updateRoot which will internally update the trie
-	obj = stateDB.GetStateObject(addr)
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects) // Call updateRoot which will internally update the trie
+	obj = s.stateDB.ReadStateObject(addr)
 	if obj == nil {
 		ginWriteError(c, "Could not get account after storage update", http.StatusInternalServerError)
 		return
 	}
 
-	tr := obj.GetTrie()
-	if tr == nil {
-		ginWriteError(c, "Trie not found for address "+req.Address, http.StatusInternalServerError)
-		return
+	// Report the slots removed from the storage trie by this update. The
+	// deletions are only recorded when the storage trie was updated, which
+	// is never the case for an empty request.
+	deleted := []string{}
+	if len(req.Storage) > 0 {
+		for _, key := range obj.DeletedStorage() {
+			deleted = append(deleted, fmt.Sprintf("0x%x", key.Bytes()))
+		}
 	}
-	stateTrie, ok := (*tr).(*trie.StateTrie)
-	if !ok || stateTrie == nil {
-		ginWriteError(c, "StateTrie not found for address "+req.Address, http.StatusInternalServerError)
+
+	// Commit the update as the next version, so that the trie it replaces
+	// stays resolvable at its root. The committed tries are no longer usable,
+	// so the account is loaded again from the reopened state.
+	if err := s.commit(); err != nil {
+		ginWriteError(c, "Failed to commit storage update: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Generate the proof for the updated storage
-	for key := range originalKeyValuePairs[addr] {
-		hashKey := stateTrie.HashKey(key.Bytes())
+	obj = s.stateDB.ReadStateObject(addr)
 
-		if err := stateTrie.Prove(hashKey, proofSet); err != nil {
-			fmt.Printf("Failed to generate proof for key %x: %v\n", key.Bytes(), err)
-			continue
+	resp, err := s.trieResponse("success", req.Address, obj)
+	if err != nil {
+		ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["deleted"] = deleted
+	resp["version"] = s.committedBlock
+	resp["gasReport"] = map[string]interface{}{
+		"fork":    rules.Name(),
+		"ops":     report,
+		"summary": gasSummary(calc, opsGas, 0, refund),
+	}
+	if insertTrace != nil {
+		resp["trace"] = map[string]interface{}{
+			"initial": insertTrace.Initial,
+			"steps":   traceSteps(insertTrace, req.Storage),
 		}
-		fmt.Printf("Proof generated for key %x\n", key.Bytes())
 	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	// Send the response using the standard function
-	ginWriteTrieResponse(c, "success", req.Address, obj)
+// traceSteps lists the steps of an insertion trace with the slots they wrote,
+// which are looked up among the written ones by their hashed keys. Paths and
+// keys have one hex character per nibble.
+func traceSteps(insertTrace *trie.InsertTrace, storage map[string]string) []map[string]interface{} {
+	slots := make(map[common.Hash][2]string)
+	for keyHex, valueHex := range storage {
+		if key, err := parseSlotKey(keyHex); err == nil {
+			slots[crypto.Keccak256Hash(key[:])] = [2]string{keyHex, valueHex}
+		}
+	}
+	steps := []map[string]interface{}{}
+	for _, step := range insertTrace.Steps {
+		events := []map[string]interface{}{}
+		for _, ev := range step.Events {
+			events = append(events, map[string]interface{}{
+				"kind":     ev.Kind,
+				"path":     trie.FormatNibbles(ev.Path),
+				"nodeKey":  trie.FormatNibbles(ev.NodeKey),
+				"matchLen": ev.MatchLen,
+				"index":    ev.Index,
+			})
+		}
+		entry := map[string]interface{}{
+			"key":    fmt.Sprintf("%x", step.Key),
+			"delete": step.Delete,
+			"events": events,
+			"root":   step.Root,
+		}
+		if slot, ok := slots[common.BytesToHash(step.Key)]; ok {
+			entry["slot"], entry["value"] = slot[0], slot[1]
+		}
+		steps = append(steps, entry)
+	}
+	return steps
 }
 
-// ginHandleProof handles Merkle proof generation requests
-func ginHandleProof(c *gin.Context) {
+// Limits of the number of slots returned by a storage range query.
+const (
+	defaultStorageRangeLimit = 16
+	maxStorageRangeLimit     = 1024
+)
+
+// ginHandleStorageRange pages through the storage of an account in the order
+// of the hashed slot keys, the way debug_storageRangeAt does. The page starts
+// at the given hashed key (the first slot by default) and the nextKey of the
+// response is the start of the following page, or null after the last one.
+func ginHandleStorageRange(c *gin.Context) {
 	debugLogRequest(c)
+	s := currentSession(c)
 
 	var req struct {
 		Address string `json:"address"`
-		Key     string `json:"key"`
-		Root    string `json:"root"`
+		Start   string `json:"start"`
+		Limit   int    `json:"limit"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -247,28 +899,130 @@ func ginHandleProof(c *gin.Context) {
 		return
 	}
 
-	// Parse the key first to validate format
-	keyBytes, err := uint256.FromHex(req.Key)
+	var start common.Hash
+	if req.Start != "" {
+		if err := start.UnmarshalText([]byte(req.Start)); err != nil {
+			ginWriteError(c, "Invalid start key format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultStorageRangeLimit
+	}
+	if limit < 0 || limit > maxStorageRangeLimit {
+		ginWriteError(c, fmt.Sprintf("Limit must be between 1 and %d", maxStorageRangeLimit), http.StatusBadRequest)
+		return
+	}
+
+	addr := common.HexToAddress(req.Address)
+	result, err := s.stateDB.StorageRange(addr, start, limit)
 	if err != nil {
-		ginWriteError(c, "Invalid key format: "+err.Error(), http.StatusBadRequest)
+		ginWriteError(c, "Failed to iterate storage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"address": req.Address,
+		"storage": result.Storage,
+		"nextKey": result.NextKey,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ginHandleRangeProof proves a page of storage slots against the storage root
+// of an account with two edge proofs, then verifies it the way snap sync does.
+// With tamper set, the value of the first slot is altered before verifying to
+// show the proof being rejected.
+func ginHandleRangeProof(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+		Start   string `json:"start"`
+		Limit   int    `json:"limit"`
+		Tamper  bool   `json:"tamper"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var origin common.Hash
+	if req.Start != "" {
+		if err := origin.UnmarshalText([]byte(req.Start)); err != nil {
+			ginWriteError(c, "Invalid start key format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultStorageRangeLimit
+	}
+	if limit < 0 || limit > maxStorageRangeLimit {
+		ginWriteError(c, fmt.Sprintf("Limit must be between 1 and %d", maxStorageRangeLimit), http.StatusBadRequest)
 		return
 	}
 
 	addr := common.HexToAddress(req.Address)
-	obj := stateDB.GetStateObject(addr)
-	if obj == nil {
-		ginWriteError(c, "Account not found", http.StatusNotFound)
+	rangeProof, err := s.stateDB.StorageRangeProof(addr, origin, limit)
+	if err != nil {
+		ginWriteError(c, "Failed to prove storage range: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if req.Tamper && len(rangeProof.Values) > 0 {
+		tampered := common.CopyBytes(rangeProof.Values[0])
+		tampered[len(tampered)-1] ^= 0x01
+		rangeProof.Values[0] = tampered
+	}
 
-	tr := obj.GetTrie()
-	if tr == nil {
-		ginWriteError(c, "Trie not found for address "+req.Address, http.StatusInternalServerError)
+	values := make([]hexutil.Bytes, len(rangeProof.Values))
+	for i, value := range rangeProof.Values {
+		values[i] = hexutil.Bytes(value)
+	}
+	proof := make([]hexutil.Bytes, len(rangeProof.Proof))
+	for i, node := range rangeProof.Proof {
+		proof[i] = hexutil.Bytes(node)
+	}
+	resp := map[string]interface{}{
+		"address": req.Address,
+		"root":    rangeProof.Root,
+		"origin":  rangeProof.Origin,
+		"keys":    rangeProof.Keys,
+		"values":  values,
+		"proof":   proof,
+	}
+	more, err := rangeProof.Verify()
+	resp["verified"] = err == nil
+	resp["more"] = more
+	if err != nil {
+		resp["reason"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ginHandleProof handles Merkle proof generation requests
+func ginHandleProof(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+		Key     string `json:"key"`
+		Root    string `json:"root"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	stateTrie, ok := (*tr).(*trie.StateTrie)
-	if !ok || stateTrie == nil {
-		ginWriteError(c, "StateTrie not found for address "+req.Address, http.StatusInternalServerError)
+
+	// Parse the key first to validate format
+	keyBytes, err := uint256.FromHex(req.Key)
+	if err != nil {
+		ginWriteError(c, "Invalid key format: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -281,38 +1035,58 @@ func ginHandleProof(c *gin.Context) {
 		return
 	}
 
-	// Hash the key using the same method as in proof generation
-	var hashKey common.Hash
-	hashKey = keyBytes.Bytes32()
+	// Prove the key against the trie at the given root, in a proof set of
+	// its own, so that only the nodes of this proof are available to verify it
+	addr := common.HexToAddress(req.Address)
+	tr, err := s.provableStorageTrie(addr, root)
+	if err != nil {
+		ginWriteError(c, "Failed to verify proof: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	hashKey := crypto.Keccak256Hash(common.Hash(keyBytes.Bytes32()).Bytes())
+	proof := trienode.NewProofSet()
+	if err := tr.Prove(hashKey.Bytes(), proof); err != nil {
+		ginWriteError(c, "Failed to generate proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Verify the proof and get the value
-	value, err := trie.VerifyProof(root, stateTrie.HashKey(hashKey.Bytes()), proofSet)
+	// Verify the proof and get the value. An absent key is proven by the
+	// nodes leading to the point where its path leaves the trie.
+	result, err := trie.VerifyProofPath(root, hashKey.Bytes(), proof)
 	if err != nil {
 		ginWriteError(c, "Failed to verify proof: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	var valueHex string
-	if value != nil {
-		valueHex = fmt.Sprintf("%x", value)
+	if result.Value != nil {
+		valueHex = fmt.Sprintf("%x", result.Value)
 	} else {
 		valueHex = ""
 	}
 
-	resp := map[string]interface{}{
-		"value": valueHex,
+	resp, err := proofPathResponse(result)
+	if err != nil {
+		ginWriteError(c, "Failed to decode proof: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
+	resp["value"] = valueHex
 
 	c.JSON(http.StatusOK, resp)
 }
 
-// ginHandleGetValue handles storage value retrieval requests
-func ginHandleGetValue(c *gin.Context) {
+// ginHandleGenerateProof generates a fresh Merkle proof of a storage key and
+// returns its nodes, so that clients can verify it on their own. The proof is
+// built against the current storage trie of the account, or against the trie
+// at the given root if it's available in the trie database.
+func ginHandleGenerateProof(c *gin.Context) {
 	debugLogRequest(c)
+	s := currentSession(c)
 
 	var req struct {
 		Address string `json:"address"`
 		Key     string `json:"key"`
+		Root    string `json:"root"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -320,13 +1094,137 @@ func ginHandleGetValue(c *gin.Context) {
 		return
 	}
 
+	keyBytes, err := uint256.FromHex(req.Key)
+	if err != nil {
+		ginWriteError(c, "Invalid key format: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var root common.Hash
+	if req.Root != "" {
+		if err := root.UnmarshalText([]byte(req.Root)); err != nil {
+			ginWriteError(c, "Invalid root format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	addr := common.HexToAddress(req.Address)
-	obj := stateDB.GetStateObject(addr)
-	if obj == nil {
-		ginWriteError(c, "Account not found", http.StatusNotFound)
+	tr, err := s.provableStorageTrie(addr, root)
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusNotFound)
+		return
+	}
+	root = tr.Hash()
+
+	slot := common.Hash(keyBytes.Bytes32())
+	hashedKey := crypto.Keccak256Hash(slot.Bytes())
+	proof := trienode.NewProofSet()
+	if err := tr.Prove(hashedKey.Bytes(), proof); err != nil {
+		ginWriteError(c, "Failed to generate proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := trie.VerifyProofPath(root, hashedKey.Bytes(), proof)
+	if err != nil {
+		ginWriteError(c, "Failed to verify proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := proofPathResponse(result)
+	if err != nil {
+		ginWriteError(c, "Failed to decode proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["address"] = req.Address
+	resp["key"] = slot.Hex()
+	resp["hashedKey"] = hashedKey.Hex()
+	resp["root"] = root.Hex()
+	resp["value"] = hexutil.Bytes(result.Value)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// provableStorageTrie returns the storage trie of the account to prove keys
+// against: the current one, unless another root is given, whose trie is then
+// opened from the trie database.
+func (s *session) provableStorageTrie(addr common.Address, root common.Hash) (state.Trie, error) {
+	// The proofs are read-only: an unknown account must not be created by
+	// looking it up, since it would change the state root on the next update
+	var tr state.Trie
+	if s.stateDB.Exist(addr) {
+		if obj := s.stateDB.ReadStateObject(addr); obj.GetTrie() != nil && *obj.GetTrie() != nil {
+			tr = *obj.GetTrie()
+		}
+	}
+	if tr != nil && (root == (common.Hash{}) || root == tr.Hash()) {
+		return tr, nil
+	}
+	if root == (common.Hash{}) {
+		return nil, errors.New("account not found")
+	}
+	// The trie is opened in the committed state holding it, since the path
+	// scheme reads the nodes of an older state through its state root
+	tr, err := s.db.OpenStorageTrie(storageTrieStateRoot(s, addr, root), addr, root)
+	if err != nil {
+		return nil, fmt.Errorf("storage trie not available at root %s: %v", root.Hex(), err)
+	}
+	return tr, nil
+}
+
+// proofPathResponse describes a verified proof path: whether the key exists,
+// the proof nodes on its path in order from the root with their hashes and
+// decoded forms, the path of the node where it stops and, for an absent key,
+// the point where the path leaves the trie.
+func proofPathResponse(result *trie.ProofPath) (map[string]interface{}, error) {
+	nodes := make([]map[string]interface{}, len(result.Nodes))
+	for i, n := range result.Nodes {
+		decoded, err := trie.DecodeNode(n.Blob)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = map[string]interface{}{
+			"path":    trie.FormatNibbles(n.Path),
+			"hash":    n.Hash.Hex(),
+			"rlp":     hexutil.Encode(n.Blob),
+			"decoded": decoded,
+		}
+	}
+	resp := map[string]interface{}{
+		"exists":   result.Value != nil,
+		"proof":    nodes,
+		"stopPath": trie.FormatNibbles(result.StopPath),
+	}
+	if d := result.Divergence; d != nil {
+		divergence := map[string]interface{}{
+			"kind":    d.Kind,
+			"keyRest": trie.FormatNibbles(d.KeyRest),
+		}
+		switch d.Kind {
+		case trie.DivergenceShortNode:
+			divergence["nodeKey"] = trie.FormatNibbles(d.NodeKey)
+		case trie.DivergenceEmptySlot:
+			divergence["slot"] = fmt.Sprintf("%x", d.Slot)
+		}
+		resp["divergence"] = divergence
+	}
+	return resp, nil
+}
+
+// ginHandleGetValue handles storage value retrieval requests
+func ginHandleGetValue(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+		Key     string `json:"key"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	addr := common.HexToAddress(req.Address)
+
 	// Convert hex string to uint256.Int, then to Bytes32 for storage key
 	key, err := uint256.FromHex(req.Key)
 	if err != nil {
@@ -334,8 +1232,9 @@ func ginHandleGetValue(c *gin.Context) {
 		return
 	}
 
-	// Get the storage value using GetState (similar to proof_service_ex.go logic)
-	value := obj.GetState(key.Bytes32())
+	// Get the storage value using GetState, which reads the slots of an
+	// unknown account as zero without creating it
+	value := s.stateDB.GetState(addr, key.Bytes32())
 
 	// Format the value without leading zeros
 	var valueHex string
@@ -350,8 +1249,8 @@ func ginHandleGetValue(c *gin.Context) {
 
 	// Check if we have the original value for comparison (like in proof_service_ex.go)
 	var originalMatch bool
-	if originalKeyValuePairs[addr] != nil {
-		if originalValue, exists := originalKeyValuePairs[addr][key.Bytes32()]; exists {
+	if s.originalKeyValuePairs[addr] != nil {
+		if originalValue, exists := s.originalKeyValuePairs[addr][key.Bytes32()]; exists {
 			originalMatch = (value == originalValue)
 		}
 	}
@@ -366,15 +1265,96 @@ func ginHandleGetValue(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// ginHandleNodeStorage describes how the storage trie of an account is laid out
+// in the node database. Every stored node is listed with its key in both the
+// hash-based and the path-based scheme, along with the disk footprint of the
+// scheme currently in use.
+func ginHandleNodeStorage(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	addr := common.HexToAddress(req.Address)
+	obj := s.stateDB.ReadStateObject(addr)
+
+	var nodes []map[string]interface{}
+	tr := obj.GetTrie()
+	if tr != nil && *tr != nil {
+		stateTrie, ok := (*tr).(*trie.StateTrie)
+		if !ok {
+			ginWriteError(c, "StateTrie not found for address "+req.Address, http.StatusInternalServerError)
+			return
+		}
+		infos, err := stateTrie.CollectNodes()
+		if err != nil {
+			ginWriteError(c, "Failed to collect trie nodes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		owner := stateTrie.Owner()
+		for _, info := range infos {
+			nodes = append(nodes, map[string]interface{}{
+				"path":    fmt.Sprintf("%x", info.Path),
+				"hash":    info.Hash.Hex(),
+				"size":    len(info.Blob),
+				"hashKey": fmt.Sprintf("0x%x", rawdb.TrieNodeKey(rawdb.HashScheme, owner, info.Path, info.Hash)),
+				"pathKey": fmt.Sprintf("0x%x", rawdb.TrieNodeKey(rawdb.PathScheme, owner, info.Path, info.Hash)),
+			})
+		}
+	}
+
+	scheme := s.db.TrieDB().Scheme()
+	count, size := rawdb.InspectTrieNodes(s.db.DiskDB(), scheme)
+	_, dirty := s.db.TrieDB().Size()
+
+	resp := map[string]interface{}{
+		"address": req.Address,
+		"scheme":  scheme,
+		"nodes":   nodes,
+		"disk": map[string]interface{}{
+			"trieNodes": count,
+			"size":      size.String(),
+			"dirty":     dirty.String(),
+		},
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // ginWriteTrieResponse writes a trie response to the HTTP response using Gin
 func ginWriteTrieResponse(c *gin.Context, status, address string, obj *state.StateObject) {
+	resp, err := currentSession(c).trieResponse(status, address, obj)
+	if err != nil {
+		ginWriteError(c, "Failed to load storage trie: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// trieResponse builds the response describing an account and its storage trie,
+// so that handlers can extend it before writing it out.
+func (s *session) trieResponse(status, address string, obj *state.StateObject) (map[string]interface{}, error) {
+	return renderTrieResponse(status, address, obj, s.originalKeyValuePairs[common.HexToAddress(address)], s.latestStateRoot)
+}
+
+// renderTrieResponse builds the response describing an account and its storage
+// trie, labelling the trie with the given key-value pairs of the account. The
+// nodes of the trie are loaded from the database as needed, so the trie can be
+// a committed or a historical one, and an error is returned if one is missing.
+func renderTrieResponse(status, address string, obj *state.StateObject, pairs map[common.Hash]common.Hash, stateRoot common.Hash) (map[string]interface{}, error) {
 	var rootHash, textString, textData, trieData string
 
 	// Get original key-value pairs for this address
-	addr := common.HexToAddress(address)
 	var originalKVPairs []map[string]interface{}
-	if originalKeyValuePairs[addr] != nil {
-		for key, value := range originalKeyValuePairs[addr] {
+	if pairs != nil {
+		for key, value := range pairs {
 			originalKVPairs = append(originalKVPairs, map[string]interface{}{
 				"originalKey":   fmt.Sprintf("0x%x", key.Bytes()),
 				"originalValue": fmt.Sprintf("0x%x", value.Bytes()),
@@ -393,6 +1373,12 @@ func ginWriteTrieResponse(c *gin.Context, status, address string, obj *state.Sta
 		formattedBuilder := &strings.Builder{}
 
 		if stateTrie, ok := (*triePtr).(*trie.StateTrie); ok {
+			// Load the nodes which are only referenced by hash, i.e. the ones
+			// committed to the database, so that the whole trie is rendered
+			if err := stateTrie.ResolveAll(); err != nil {
+				return nil, err
+			}
+
 			// If it's a StateTrie
 			stateTrie.PrintTrieToFormatted(formattedBuilder)
 			textString = formattedBuilder.String()
@@ -402,8 +1388,8 @@ func ginWriteTrieResponse(c *gin.Context, status, address string, obj *state.Sta
 			originalKeysMap := make(map[string]string)
 			originalValuesMap := make(map[string]string)
 
-			if originalKeyValuePairs[addr] != nil {
-				for key, value := range originalKeyValuePairs[addr] {
+			if pairs != nil {
+				for key, value := range pairs {
 					keyHex := fmt.Sprintf("%x", key.Bytes())
 					valueHex := fmt.Sprintf("%x", value.Bytes())
 					hashedKey := stateTrie.HashKey(key.Bytes())
@@ -483,8 +1469,17 @@ func ginWriteTrieResponse(c *gin.Context, status, address string, obj *state.Sta
 	}
 
 	resp := map[string]interface{}{
-		"status":  status,
-		"address": address,
+		"status":    status,
+		"address":   address,
+		"stateRoot": stateRoot.Hex(),
+		"account": map[string]interface{}{
+			"nonce":       obj.Nonce(),
+			"balance":     obj.Balance().Dec(),
+			"codeHash":    common.BytesToHash(obj.CodeHash()).Hex(),
+			"codeSize":    obj.CodeSize(),
+			"code":        hexutil.Encode(obj.Code()),
+			"storageRoot": obj.GetRoot().Hex(),
+		},
 		"trie": map[string]interface{}{
 			"rootHash":        rootHash,
 			"textData":        textData,
@@ -494,7 +1489,7 @@ func ginWriteTrieResponse(c *gin.Context, status, address string, obj *state.Sta
 		},
 	}
 
-	c.JSON(http.StatusOK, resp)
+	return resp, nil
 }
 
 // ginWriteError writes an error response to the HTTP response using Gin
@@ -0,0 +1,411 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/rawdb"
+	"storage_extract/triedb"
+	"storage_extract/triedb/pathdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	testAccount = "0x00000000000000000000000000000000000000aa"
+	testUnknown = "0x00000000000000000000000000000000000000bb"
+)
+
+// newTestServer sets up the sessions on an in-memory store with the given node
+// scheme and returns the router serving the API.
+func newTestServer(t *testing.T, scheme string) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	if err := SetupDatabase(memorydb.New(), scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	setupGinAPIHandlers(r)
+	return r
+}
+
+// serve sends a request with the given body encoded as JSON, unless it's
+// already a string, and returns the recorded response.
+func serve(t *testing.T, r http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var blob []byte
+	switch body := body.(type) {
+	case nil:
+	case string:
+		blob = []byte(body)
+	default:
+		var err error
+		if blob, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(blob))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// post sends a POST request and decodes the JSON object it's answered with,
+// failing the test unless the response has the given status.
+func post(t *testing.T, r http.Handler, path string, body interface{}, status int) map[string]interface{} {
+	t.Helper()
+
+	w := serve(t, r, http.MethodPost, path, body)
+	if w.Code != status {
+		t.Fatalf("POST %s: status mismatch: have %d, want %d: %s", path, w.Code, status, w.Body)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("POST %s: invalid response %q: %v", path, w.Body, err)
+	}
+	return resp
+}
+
+// defaultSession returns the session serving the requests which name none.
+func defaultSession(t *testing.T) *session {
+	t.Helper()
+
+	s, err := sessions.get(defaultSessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Tests that reading an unknown account leaves the state as it is: the account
+// isn't created, so the state root doesn't move and a later update doesn't
+// put it into the account trie.
+func TestReadsDontCreateAccounts(t *testing.T) {
+	for _, scheme := range []string{rawdb.HashScheme, rawdb.PathScheme} {
+		t.Run(scheme, func(t *testing.T) {
+			r := newTestServer(t, scheme)
+			post(t, r, "/api/storage/update", map[string]interface{}{
+				"address": testAccount,
+				"storage": map[string]string{"0x1": "0x2"},
+			}, http.StatusOK)
+			s := defaultSession(t)
+			root := s.stateDB.IntermediateRoot(false)
+
+			resp := post(t, r, "/api/account/get", map[string]string{"address": testUnknown}, http.StatusOK)
+			if nonce := resp["account"].(map[string]interface{})["nonce"]; nonce != float64(0) {
+				t.Fatalf("unknown account has nonce %v", nonce)
+			}
+			resp = post(t, r, "/api/storage/get", map[string]string{"address": testUnknown, "key": "0x1"}, http.StatusOK)
+			if resp["value"] != "0" {
+				t.Fatalf("slot of an unknown account reads %v", resp["value"])
+			}
+			post(t, r, "/api/db/nodes", map[string]string{"address": testUnknown}, http.StatusOK)
+			post(t, r, "/api/storage/gas", map[string]interface{}{
+				"address": testUnknown,
+				"ops":     []map[string]string{{"op": "sload", "key": "0x1"}},
+			}, http.StatusOK)
+
+			if s.stateDB.Exist(common.HexToAddress(testUnknown)) {
+				t.Fatal("reads created the unknown account")
+			}
+			if have := s.stateDB.IntermediateRoot(false); have != root {
+				t.Fatalf("reads moved the state root: have %x, want %x", have, root)
+			}
+			// A following update doesn't commit the unknown account either
+			post(t, r, "/api/storage/update", map[string]interface{}{
+				"address": testAccount,
+				"storage": map[string]string{},
+			}, http.StatusOK)
+			if have := s.latestStateRoot; have != root {
+				t.Fatalf("update after the reads moved the state root: have %x, want %x", have, root)
+			}
+			if n := len(s.versions); n != 1 {
+				t.Fatalf("version count mismatch: have %d, want 1", n)
+			}
+		})
+	}
+}
+
+// newTestSession creates a session with the given options and returns the
+// prefix of its API routes.
+func newTestSession(t *testing.T, r http.Handler, options interface{}) string {
+	t.Helper()
+
+	resp := post(t, r, "/api/session", options, http.StatusOK)
+	return "/api/session/" + resp["id"].(string)
+}
+
+// Tests that a self-destructed account stays deleted: the response doesn't
+// load it back as an empty account, which a following write would put into
+// the account trie again.
+func TestSelfDestructStaysDeleted(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+
+	// The state with only the other account, for reference
+	other := newTestSession(t, r, nil)
+	post(t, r, other+"/account/set", map[string]string{"address": testUnknown, "nonce": "1"}, http.StatusOK)
+	want := sessionByPath(t, other).latestStateRoot
+
+	post(t, r, "/api/storage/update", map[string]interface{}{
+		"address": testAccount,
+		"storage": map[string]string{"0x1": "0x2"},
+	}, http.StatusOK)
+	post(t, r, "/api/account/set", map[string]string{"address": testUnknown, "nonce": "1"}, http.StatusOK)
+	resp := post(t, r, "/api/account/selfdestruct", map[string]string{"address": testAccount}, http.StatusOK)
+	if resp["destructed"] != true || resp["exists"] != false {
+		t.Fatalf("self-destruct reported destructed=%v exists=%v", resp["destructed"], resp["exists"])
+	}
+	// A no-op write to the other account ends another transaction
+	post(t, r, "/api/account/set", map[string]string{"address": testUnknown, "nonce": "1"}, http.StatusOK)
+
+	s := defaultSession(t)
+	if s.stateDB.Exist(common.HexToAddress(testAccount)) {
+		t.Fatal("self-destructed account exists again")
+	}
+	if s.latestStateRoot != want {
+		t.Fatalf("state root mismatch: have %x, want %x", s.latestStateRoot, want)
+	}
+}
+
+// Tests that the empty accounts touched by a request are deleted at its end in
+// the sessions applying EIP-161, and kept in the others.
+func TestDeleteEmptyObjects(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+	for _, deleteEmpty := range []bool{false, true} {
+		prefix := newTestSession(t, r, map[string]bool{"deleteEmptyObjects": deleteEmpty})
+		s := sessionByPath(t, prefix)
+		if s.deleteEmptyObjects != deleteEmpty {
+			t.Fatalf("session created with deleteEmptyObjects=%v has %v", deleteEmpty, s.deleteEmptyObjects)
+		}
+		addr := common.HexToAddress(testAccount)
+
+		// Touching an account without giving it a nonce, balance or code
+		post(t, r, prefix+"/account/set", map[string]string{"address": testAccount, "nonce": "0"}, http.StatusOK)
+		if exists := s.stateDB.Exist(addr); exists == deleteEmpty {
+			t.Fatalf("deleteEmptyObjects=%v: empty account exists=%v", deleteEmpty, exists)
+		}
+		// Storage doesn't make an account non-empty
+		post(t, r, prefix+"/storage/update", map[string]interface{}{
+			"address": testAccount,
+			"storage": map[string]string{"0x1": "0x2"},
+		}, http.StatusOK)
+		if exists := s.stateDB.Exist(addr); exists == deleteEmpty {
+			t.Fatalf("deleteEmptyObjects=%v: account with storage only exists=%v", deleteEmpty, exists)
+		}
+		// A nonce does
+		post(t, r, prefix+"/account/set", map[string]string{"address": testAccount, "nonce": "1"}, http.StatusOK)
+		if !s.stateDB.Exist(addr) {
+			t.Fatalf("deleteEmptyObjects=%v: account with a nonce deleted", deleteEmpty)
+		}
+	}
+}
+
+// sessionByPath returns the session with the given route prefix.
+func sessionByPath(t *testing.T, prefix string) *session {
+	t.Helper()
+
+	s, err := sessions.get(prefix[len("/api/session/"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Tests that transient storage leaves the state as it is: the slots are gone
+// after the transaction, the account written to isn't created and the state
+// root doesn't move.
+func TestTransientStorageKeepsState(t *testing.T) {
+	for _, scheme := range []string{rawdb.HashScheme, rawdb.PathScheme} {
+		t.Run(scheme, func(t *testing.T) {
+			r := newTestServer(t, scheme)
+			post(t, r, "/api/storage/update", map[string]interface{}{
+				"address": testAccount,
+				"storage": map[string]string{"0x1": "0x2"},
+			}, http.StatusOK)
+			s := defaultSession(t)
+			root := s.stateDB.IntermediateRoot(false)
+
+			for _, addr := range []string{testAccount, testUnknown} {
+				resp := post(t, r, "/api/storage/transient", map[string]interface{}{
+					"address": addr,
+					"storage": map[string]string{"0x1": "0x3"},
+				}, http.StatusOK)
+				slot := resp["transient"].([]interface{})[0].(map[string]interface{})
+				if slot["during"] != common.HexToHash("0x3").Hex() || slot["afterTx"] != (common.Hash{}).Hex() {
+					t.Fatalf("%s: transient slot reads %v during and %v after the transaction", addr, slot["during"], slot["afterTx"])
+				}
+				if resp["stateRootBefore"] != root.Hex() {
+					t.Fatalf("%s: state root before mismatch: have %v, want %x", addr, resp["stateRootBefore"], root)
+				}
+				if have := s.stateDB.IntermediateRoot(false); have != root {
+					t.Fatalf("%s: transient storage moved the state root: have %x, want %x", addr, have, root)
+				}
+			}
+			if s.stateDB.Exist(common.HexToAddress(testUnknown)) {
+				t.Fatal("transient storage created the unknown account")
+			}
+		})
+	}
+}
+
+// Tests that the slots written by the calls surviving a simulation are tracked
+// like the ones of a storage update: a slot cleared by them is dropped, and
+// the writes of the reverted calls are ignored.
+func TestSimulateTracksSlots(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+	post(t, r, "/api/storage/update", map[string]interface{}{
+		"address": testAccount,
+		"storage": map[string]string{"0x1": "0x2", "0x2": "0x3"},
+	}, http.StatusOK)
+	post(t, r, "/api/storage/simulate", map[string]interface{}{
+		"address": testAccount,
+		"calls": []map[string]interface{}{
+			{"storage": map[string]string{"0x1": "0x0", "0x3": "0x4"}},
+			{"storage": map[string]string{"0x2": "0x0", "0x5": "0x6"}, "revert": true},
+		},
+	}, http.StatusOK)
+
+	want := map[common.Hash]common.Hash{
+		common.HexToHash("0x2"): common.HexToHash("0x3"),
+		common.HexToHash("0x3"): common.HexToHash("0x4"),
+	}
+	if have := defaultSession(t).originalKeyValuePairs[common.HexToAddress(testAccount)]; !reflect.DeepEqual(have, want) {
+		t.Fatalf("tracked slots mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that the routes writing slots and storage_setState parse the slots
+// alike: the same slots in different encodings lead to the same state root,
+// and keys decoding to the same slot are rejected.
+func TestSlotEncodings(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+	prefix := newTestSession(t, r, nil)
+	post(t, r, prefix+"/storage/update", map[string]interface{}{
+		"address": testAccount,
+		"storage": map[string]string{"0x1": "0x2", "0x0003": "04", "ff": "0x00ff"},
+	}, http.StatusOK)
+
+	var resp rpcMessage
+	rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"storage_setState","params":["`+testAccount+`",{"01":"0x02","0x3":"0x4","0xff":"0xff"}]}`, &resp)
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if have, want := defaultSession(t).latestStateRoot, sessionByPath(t, prefix).latestStateRoot; have != want {
+		t.Fatalf("state root mismatch: have %x, want %x", have, want)
+	}
+
+	post(t, r, prefix+"/storage/gas", map[string]interface{}{
+		"address":    testAccount,
+		"ops":        []map[string]string{{"op": "sload", "key": "01"}, {"op": "sstore", "key": "0x0003", "value": "04"}},
+		"accessList": []string{"0x01"},
+	}, http.StatusOK)
+
+	duplicate := map[string]string{"0x1": "0x2", "0x01": "0x3"}
+	for _, route := range []string{"/storage/update", "/storage/transient", "/storage/simulate"} {
+		body := map[string]interface{}{"address": testAccount, "storage": duplicate}
+		if route == "/storage/simulate" {
+			body = map[string]interface{}{"address": testAccount, "calls": []interface{}{map[string]interface{}{"storage": duplicate}}}
+		}
+		post(t, r, prefix+route, body, http.StatusBadRequest)
+	}
+	rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"storage_setState","params":["`+testAccount+`",{"0x1":"0x2","0x01":"0x3"}]}`, &resp)
+	if resp.Error == nil || resp.Error.Code != rpcInvalidParams {
+		t.Fatalf("duplicate keys: error mismatch: have %v, want code %d", resp.Error, rpcInvalidParams)
+	}
+}
+
+// Tests that a key is proven against the storage root of an older version,
+// whose nodes the path scheme has overwritten since, both by the proof of a
+// given root and by the generated proof.
+func TestHistoricalProof(t *testing.T) {
+	for _, scheme := range []string{rawdb.HashScheme, rawdb.PathScheme} {
+		t.Run(scheme, func(t *testing.T) {
+			r := newTestServer(t, scheme)
+			s := defaultSession(t)
+			addr := common.HexToAddress(testAccount)
+
+			post(t, r, "/api/storage/update", map[string]interface{}{
+				"address": testAccount,
+				"storage": map[string]string{"0x1": "0x2", "0x2": "0x3"},
+			}, http.StatusOK)
+			old := s.stateDB.GetStorageRoot(addr)
+			post(t, r, "/api/storage/update", map[string]interface{}{
+				"address": testAccount,
+				"storage": map[string]string{"0x1": "0x4", "0x3": "0x5"},
+			}, http.StatusOK)
+			if s.stateDB.GetStorageRoot(addr) == old {
+				t.Fatal("storage root unchanged by the update")
+			}
+
+			req := map[string]string{"address": testAccount, "key": "0x1", "root": old.Hex()}
+			resp := post(t, r, "/api/proof", req, http.StatusOK)
+			if resp["exists"] != true || resp["value"] != "02" {
+				t.Fatalf("proof: exists=%v value=%v, want the old value 02", resp["exists"], resp["value"])
+			}
+			resp = post(t, r, "/api/proof/generate", req, http.StatusOK)
+			if resp["root"] != old.Hex() || resp["value"] != "0x02" {
+				t.Fatalf("generated proof: root=%v value=%v, want the old value 0x02 under %x", resp["root"], resp["value"], old)
+			}
+			// A key added later is absent from the older trie
+			req["key"] = "0x3"
+			if resp := post(t, r, "/api/proof", req, http.StatusOK); resp["exists"] != false {
+				t.Fatalf("key added later exists in the older trie: %v", resp)
+			}
+		})
+	}
+}
+
+// Tests that the versions whose trie node histories the path scheme pruned are
+// listed as unavailable, while the recent ones stay available.
+func TestPrunedVersionsUnavailable(t *testing.T) {
+	r := newTestServer(t, rawdb.PathScheme)
+	manager, err := newSessionManager(memorydb.New(), &triedb.Config{
+		PathDB: &pathdb.Config{StateHistory: 2, WriteBufferSize: pathdb.Defaults.WriteBufferSize},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions = manager
+
+	for i := 1; i <= 5; i++ {
+		post(t, r, "/api/storage/update", map[string]interface{}{
+			"address": testAccount,
+			"storage": map[string]string{"0x1": fmt.Sprintf("0x%x", i)},
+		}, http.StatusOK)
+	}
+	resp := post(t, r, "/api/history/versions", map[string]string{"address": testAccount}, http.StatusOK)
+	versions := resp["versions"].([]interface{})
+	if len(versions) != 5 {
+		t.Fatalf("version count mismatch: have %d, want 5", len(versions))
+	}
+	// The state the oldest kept history starts from is available as well
+	for i, v := range versions {
+		if available, want := v.(map[string]interface{})["available"], i >= 2; available != want {
+			t.Fatalf("version %d: available=%v, want %v", i+1, available, want)
+		}
+	}
+	post(t, r, "/api/history/open", map[string]interface{}{"address": testAccount, "version": 2}, http.StatusGone)
+	post(t, r, "/api/history/open", map[string]interface{}{"address": testAccount, "version": 3}, http.StatusOK)
+}
+
+// Tests that a corrupt trie node history fails the setup with an error instead
+// of crashing the server.
+func TestSetupCorruptHistory(t *testing.T) {
+	disk := memorydb.New()
+	if err := rawdb.WriteTrieHistory(disk, 1, []byte{0xc1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupDatabase(disk, rawdb.PathScheme); err == nil {
+		t.Fatal("setup succeeded on a corrupt history")
+	}
+}
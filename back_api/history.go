@@ -0,0 +1,353 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/state"
+	"storage_extract/trie"
+	"storage_extract/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/gin-gonic/gin"
+)
+
+// ginHandleListVersions lists the committed versions of the session, oldest
+// first. Given an account, only the slots of the account are listed among the
+// changes of every version, along with the storage root of the account at the
+// version. A version is unavailable once the node database no longer holds
+// its nodes. The path scheme overwrites nodes in place, but keeps the replaced
+// ones in its trie node history, so its versions stay available too.
+func ginHandleListVersions(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string `json:"address"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	versions := []map[string]interface{}{}
+	for _, v := range s.versions {
+		entry := map[string]interface{}{
+			"number":    v.Number,
+			"root":      v.Root,
+			"timestamp": v.Timestamp,
+		}
+		available := versionAvailable(s, v.Root)
+		entry["available"] = available
+
+		changes := v.Changes
+		if req.Address != "" {
+			addr := common.HexToAddress(req.Address)
+			changes = []versionChange{}
+			for _, ch := range v.Changes {
+				if ch.Address == addr {
+					changes = append(changes, ch)
+				}
+			}
+			if available {
+				if storageRoot, err := cachedStorageRoot(s, v, addr); err == nil {
+					entry["storageRoot"] = storageRoot
+				}
+			}
+		}
+		entry["changes"] = changes
+		versions = append(versions, entry)
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"versions": versions,
+		"latest":   s.committedBlock,
+	})
+}
+
+// ginHandleOpenVersion opens the state of a committed version, or of any state
+// root whose nodes are still in the database, and renders the storage trie of
+// an account the way the current one is rendered.
+func ginHandleOpenVersion(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string  `json:"address"`
+		Version *uint64 `json:"version"`
+		Root    string  `json:"root"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		root   common.Hash
+		number uint64
+	)
+	switch {
+	case req.Version != nil:
+		if *req.Version == 0 || *req.Version > uint64(len(s.versions)) {
+			ginWriteError(c, "Version not found", http.StatusNotFound)
+			return
+		}
+		number, root = *req.Version, s.versions[*req.Version-1].Root
+	case req.Root != "":
+		if err := root.UnmarshalText([]byte(req.Root)); err != nil {
+			ginWriteError(c, "Invalid root format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, v := range s.versions {
+			if v.Root == root {
+				number = v.Number
+			}
+		}
+	default:
+		ginWriteError(c, "Either a version or a root is required", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := renderVersion(s, req.Address, root)
+	if err != nil {
+		ginWriteError(c, "State is not available: "+err.Error(), http.StatusGone)
+		return
+	}
+	resp["version"] = number
+	resp["readOnly"] = true
+	c.JSON(http.StatusOK, resp)
+}
+
+// ginHandleTrieDiff compares the storage trie of an account at two committed
+// versions, by default the latest one and the one before it, i.e. the nodes
+// rewritten by the last update. Version 0 is the empty state before the first
+// commit. The newer version is rendered along with the difference, so that
+// the tree view can tell the created nodes from the unchanged ones.
+func ginHandleTrieDiff(c *gin.Context) {
+	debugLogRequest(c)
+	s := currentSession(c)
+
+	var req struct {
+		Address string  `json:"address"`
+		From    *uint64 `json:"from"`
+		To      *uint64 `json:"to"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	to := uint64(len(s.versions))
+	if req.To != nil {
+		to = *req.To
+	}
+	if to == 0 || to > uint64(len(s.versions)) {
+		ginWriteError(c, "Version not found", http.StatusNotFound)
+		return
+	}
+	from := to - 1
+	if req.From != nil {
+		from = *req.From
+	}
+	if from > uint64(len(s.versions)) {
+		ginWriteError(c, "Version not found", http.StatusNotFound)
+		return
+	}
+	addr := common.HexToAddress(req.Address)
+	oldStateRoot, oldRoot, err := versionStorageRoot(s, from, addr)
+	if err != nil {
+		ginWriteError(c, "State is not available: "+err.Error(), http.StatusGone)
+		return
+	}
+	newStateRoot, newRoot, err := versionStorageRoot(s, to, addr)
+	if err != nil {
+		ginWriteError(c, "State is not available: "+err.Error(), http.StatusGone)
+		return
+	}
+	owner := crypto.Keccak256Hash(addr.Bytes())
+	diff, err := trie.Diff(trie.StorageTrieID(oldStateRoot, owner, oldRoot), trie.StorageTrieID(newStateRoot, owner, newRoot), s.db.TrieDB())
+	if err != nil {
+		ginWriteError(c, "State is not available: "+err.Error(), http.StatusGone)
+		return
+	}
+	resp, err := renderVersion(s, req.Address, newStateRoot)
+	if err != nil {
+		ginWriteError(c, "State is not available: "+err.Error(), http.StatusGone)
+		return
+	}
+	resp["version"] = to
+	resp["readOnly"] = true
+	resp["diff"] = map[string]interface{}{
+		"from":     from,
+		"to":       to,
+		"oldRoot":  oldRoot,
+		"newRoot":  newRoot,
+		"added":    diffLeaves(s, diff.Added),
+		"removed":  diffLeaves(s, diff.Removed),
+		"modified": diffLeaves(s, diff.Modified),
+		"created":  diffNodes(diff.Created),
+		"orphaned": diffNodes(diff.Orphaned),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// renderVersion opens the state at the given root and renders the storage
+// trie of the account like the current one. The historical state is read-only:
+// it's discarded once rendered.
+func renderVersion(s *session, address string, root common.Hash) (map[string]interface{}, error) {
+	historical, err := openVersion(s, root)
+	if err != nil {
+		return nil, err
+	}
+	addr := common.HexToAddress(address)
+	obj := historical.GetStateObject(addr)
+
+	// Label the trie with the slots of the version, whose keys are recovered
+	// from the preimages
+	pairs := make(map[common.Hash]common.Hash)
+	storage, err := historical.StorageRange(addr, common.Hash{}, math.MaxInt)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range storage.Storage {
+		if entry.Key != nil {
+			pairs[*entry.Key] = entry.Value
+		}
+	}
+	resp, err := renderTrieResponse("success", address, obj, pairs, root)
+	if err != nil {
+		return nil, err
+	}
+	if err := historical.Error(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// versionStorageRoot returns the state root of the version with the given
+// number and the storage root of the account in it. Version 0 is the empty
+// state.
+func versionStorageRoot(s *session, number uint64, addr common.Address) (common.Hash, common.Hash, error) {
+	if number == 0 {
+		return types.EmptyRootHash, types.EmptyRootHash, nil
+	}
+	v := s.versions[number-1]
+	storageRoot, err := cachedStorageRoot(s, v, addr)
+	if err != nil {
+		return common.Hash{}, common.Hash{}, err
+	}
+	if storageRoot == (common.Hash{}) {
+		storageRoot = types.EmptyRootHash
+	}
+	return v.Root, storageRoot, nil
+}
+
+// cachedStorageRoot returns the storage root of the account in the given
+// version, an empty hash if the account doesn't exist there. Versions never
+// change, so the storage roots are cached in the version once looked up.
+func cachedStorageRoot(s *session, v *version, addr common.Address) (common.Hash, error) {
+	if storageRoot, ok := v.storageRoots[addr]; ok {
+		return storageRoot, nil
+	}
+	historical, err := openVersion(s, v.Root)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	storageRoot := historical.GetStorageRoot(addr)
+	if err := historical.Error(); err != nil {
+		return common.Hash{}, err
+	}
+	if v.storageRoots == nil {
+		v.storageRoots = make(map[common.Address]common.Hash)
+	}
+	v.storageRoots[addr] = storageRoot
+	return storageRoot, nil
+}
+
+// storageTrieStateRoot returns the state root of the latest committed version
+// in which the account has the given storage root, or the latest state root if
+// there is none.
+func storageTrieStateRoot(s *session, addr common.Address, storageRoot common.Hash) common.Hash {
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		v := s.versions[i]
+		if root, err := cachedStorageRoot(s, v, addr); err == nil && root == storageRoot {
+			return v.Root
+		}
+	}
+	return s.latestStateRoot
+}
+
+// versionAvailable reports whether the node database still holds the root node
+// of the state, which is checked without opening the state.
+func versionAvailable(s *session, root common.Hash) bool {
+	if root == types.EmptyRootHash {
+		return true
+	}
+	reader, err := s.db.TrieDB().NodeReader(root)
+	if err != nil {
+		return false
+	}
+	blob, err := reader.Node(common.Hash{}, nil, root)
+	return err == nil && len(blob) > 0
+}
+
+// diffLeaves lists the changed slots of a trie diff with their original keys,
+// where their preimages are known, and their decoded values.
+func diffLeaves(s *session, leaves []*trie.LeafDiff) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for _, leaf := range leaves {
+		entry := map[string]interface{}{
+			"key":   hexutil.Encode(leaf.Key),
+			"prev":  decodeSlot(leaf.Prev),
+			"value": decodeSlot(leaf.Value),
+		}
+		if preimage := s.db.TrieDB().Preimage(common.BytesToHash(leaf.Key)); preimage != nil {
+			entry["originalKey"] = common.BytesToHash(preimage)
+		}
+		list = append(list, entry)
+	}
+	return list
+}
+
+// decodeSlot decodes the RLP-encoded value of a storage slot, nil if the slot
+// is missing.
+func decodeSlot(blob []byte) *common.Hash {
+	if blob == nil {
+		return nil
+	}
+	_, content, _, err := rlp.Split(blob)
+	if err != nil {
+		return nil
+	}
+	value := common.BytesToHash(content)
+	return &value
+}
+
+// diffNodes lists the nodes of a trie diff by path, with one hex character per
+// nibble. Nodes embedded in their parent have no hash.
+func diffNodes(nodes map[string]common.Hash) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for path, hash := range nodes {
+		entry := map[string]interface{}{"path": trie.FormatNibbles([]byte(path))}
+		if hash != (common.Hash{}) {
+			entry["hash"] = hash
+		}
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i]["path"].(string) < list[j]["path"].(string)
+	})
+	return list
+}
+
+// openVersion opens the state at the given root from the node database of the
+// session, failing if its root node is no longer available.
+func openVersion(s *session, root common.Hash) (*state.StateDB, error) {
+	return state.New(root, s.db)
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"storage_extract/common"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// maxRPCBatchSize is the maximum number of requests in a batch.
+const maxRPCBatchSize = 1000
+
+// rpcMessage is a JSON-RPC 2.0 request or response.
+// Original struct: github.com/ethereum/go-ethereum/rpc/json.go line 63 (jsonrpcMessage)
+type rpcMessage struct {
+	Version string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+}
+
+// rpcError is the error object of a JSON-RPC 2.0 response.
+// Original struct: github.com/ethereum/go-ethereum/rpc/json.go line 140 (jsonError)
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *rpcError) Error() string {
+	return err.Message
+}
+
+// rpcMethods maps the served JSON-RPC methods to their handlers, which decode
+// the positional params themselves.
+var rpcMethods = map[string]func(s *session, params []json.RawMessage) (interface{}, error){
+	"eth_getStorageAt":     rpcGetStorageAt,
+	"eth_getProof":         rpcGetProof,
+	"debug_storageRangeAt": rpcStorageRangeAt,
+	"storage_setState":     rpcSetState,
+	"storage_commit":       rpcCommit,
+}
+
+// ginHandleRPC serves the JSON-RPC 2.0 endpoint, so that standard Ethereum
+// tooling can query and modify the state the way it talks to a node. Both
+// single requests and batches are served; notifications, i.e. requests
+// without an id, are run but get no response.
+func ginHandleRPC(c *gin.Context) {
+	s := currentSession(c)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, rpcErrorResponse(nil, &rpcError{rpcParseError, "parse error"}))
+		return
+	}
+	if !isBatch(body) {
+		var msg rpcMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.JSON(http.StatusOK, rpcErrorResponse(nil, &rpcError{rpcParseError, "parse error"}))
+			return
+		}
+		resp := handleRPCMessage(s, &msg)
+		if msg.ID == nil {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		c.JSON(http.StatusOK, rpcErrorResponse(nil, &rpcError{rpcParseError, "parse error"}))
+		return
+	}
+	// Emit error response for empty batches and the ones over the limit.
+	if len(batch) == 0 {
+		c.JSON(http.StatusOK, rpcErrorResponse(nil, &rpcError{rpcInvalidRequest, "empty batch"}))
+		return
+	}
+	if len(batch) > maxRPCBatchSize {
+		c.JSON(http.StatusOK, rpcErrorResponse(nil, &rpcError{rpcInvalidRequest, "batch too large"}))
+		return
+	}
+	// The requests of a batch run in order, so a batch can write the state
+	// and read it back.
+	resps := []*rpcMessage{}
+	for _, raw := range batch {
+		var msg rpcMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			resps = append(resps, rpcErrorResponse(nil, &rpcError{rpcInvalidRequest, "invalid request"}))
+			continue
+		}
+		resp := handleRPCMessage(s, &msg)
+		if msg.ID != nil {
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, resps)
+}
+
+// isBatch returns true when the first non-whitespace characters is '['
+// Original function: github.com/ethereum/go-ethereum/rpc/json.go line 296
+func isBatch(raw json.RawMessage) bool {
+	for _, c := range raw {
+		// skip insignificant whitespace (http://www.ietf.org/rfc/rfc4627.txt)
+		if c == 0x20 || c == 0x09 || c == 0x0a || c == 0x0d {
+			continue
+		}
+		return c == '['
+	}
+	return false
+}
+
+// handleRPCMessage runs a single JSON-RPC request and returns its response.
+func handleRPCMessage(s *session, msg *rpcMessage) *rpcMessage {
+	if msg.Version != "2.0" || msg.Method == "" {
+		return rpcErrorResponse(msg.ID, &rpcError{rpcInvalidRequest, "invalid request"})
+	}
+	method, ok := rpcMethods[msg.Method]
+	if !ok {
+		return rpcErrorResponse(msg.ID, &rpcError{rpcMethodNotFound, fmt.Sprintf("the method %s does not exist/is not available", msg.Method)})
+	}
+	var params []json.RawMessage
+	if len(msg.Params) > 0 && string(msg.Params) != "null" {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return rpcErrorResponse(msg.ID, &rpcError{rpcInvalidParams, "non-array args"})
+		}
+	}
+	result, err := method(s, params)
+	if err != nil {
+		var rerr *rpcError
+		if !errors.As(err, &rerr) {
+			rerr = &rpcError{rpcServerError, err.Error()}
+		}
+		return rpcErrorResponse(msg.ID, rerr)
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return &rpcMessage{Version: "2.0", ID: rpcResponseID(msg.ID), Result: result}
+}
+
+// rpcErrorResponse creates the error response of a request.
+func rpcErrorResponse(id json.RawMessage, err *rpcError) *rpcMessage {
+	return &rpcMessage{Version: "2.0", ID: rpcResponseID(id), Error: err}
+}
+
+// rpcResponseID returns the id echoed in a response, which is null if the id
+// of the request is missing.
+func rpcResponseID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// rpcParam decodes the positional param at the given index into v. Missing
+// params are left at their zero value unless they're required.
+func rpcParam(params []json.RawMessage, index int, required bool, v interface{}) error {
+	if index >= len(params) || string(params[index]) == "null" {
+		if required {
+			return &rpcError{rpcInvalidParams, fmt.Sprintf("missing value for required argument %d", index)}
+		}
+		return nil
+	}
+	if err := json.Unmarshal(params[index], v); err != nil {
+		return &rpcError{rpcInvalidParams, fmt.Sprintf("invalid argument %d: %v", index, err)}
+	}
+	return nil
+}
+
+// rpcCheckBlock checks the block param of a request. Only the current state is
+// served, so only "latest" and "pending" are accepted.
+func rpcCheckBlock(params []json.RawMessage, index int) error {
+	var block string
+	if err := rpcParam(params, index, false, &block); err != nil {
+		return err
+	}
+	switch block {
+	case "", "latest", "pending":
+		return nil
+	default:
+		return &rpcError{rpcInvalidParams, fmt.Sprintf("unsupported block %q, only the latest state is available", block)}
+	}
+}
+
+// rpcGetStorageAt serves eth_getStorageAt(address, key, block), returning the
+// 32-byte value of the slot.
+// Original function: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 584 (BlockChainAPI.GetStorageAt)
+func rpcGetStorageAt(s *session, params []json.RawMessage) (interface{}, error) {
+	var (
+		addr   common.Address
+		hexKey string
+	)
+	if err := rpcParam(params, 0, true, &addr); err != nil {
+		return nil, err
+	}
+	if err := rpcParam(params, 1, true, &hexKey); err != nil {
+		return nil, err
+	}
+	if err := rpcCheckBlock(params, 2); err != nil {
+		return nil, err
+	}
+	key, _, err := decodeHash(hexKey)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unable to decode storage key: %s", err)}
+	}
+	res := s.stateDB.GetState(addr, key)
+	return hexutil.Bytes(res[:]), s.stateDB.Error()
+}
+
+// rpcGetProof serves eth_getProof(address, storageKeys, block).
+func rpcGetProof(s *session, params []json.RawMessage) (interface{}, error) {
+	var (
+		addr        common.Address
+		storageKeys []string
+	)
+	if err := rpcParam(params, 0, true, &addr); err != nil {
+		return nil, err
+	}
+	if err := rpcParam(params, 1, true, &storageKeys); err != nil {
+		return nil, err
+	}
+	if err := rpcCheckBlock(params, 2); err != nil {
+		return nil, err
+	}
+	var (
+		keys       = make([]common.Hash, len(storageKeys))
+		keyLengths = make([]int, len(storageKeys))
+	)
+	// Deserialize all keys. This prevents state access on invalid input.
+	for i, hexKey := range storageKeys {
+		var err error
+		keys[i], keyLengths[i], err = decodeHash(hexKey)
+		if err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+	result, err := s.stateDB.GetProof(addr, keys)
+	if err != nil {
+		return nil, err
+	}
+	// Output key encoding is a bit special: if the input was a 32-byte hash, it is
+	// returned as such. Otherwise, we apply the QUANTITY encoding mandated by the
+	// JSON-RPC spec for getProof.
+	for i := range result.StorageProof {
+		if keyLengths[i] != 32 {
+			result.StorageProof[i].Key = hexutil.EncodeBig(new(big.Int).SetBytes(keys[i][:]))
+		}
+	}
+	return result, nil
+}
+
+// decodeHash parses a hex-encoded 32-byte hash. The input may optionally
+// be prefixed by 0x and can have a byte length up to 32.
+// Original function: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 443
+func decodeHash(s string) (h common.Hash, inputLength int, err error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	if (len(s) & 1) > 0 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return common.Hash{}, 0, errors.New("hex string invalid")
+	}
+	if len(b) > 32 {
+		return common.Hash{}, len(b), errors.New("hex string too long, want at most 32 bytes")
+	}
+	return common.BytesToHash(b), len(b), nil
+}
+
+// rpcStorageRangeAt serves debug_storageRangeAt(blockHash, txIndex, address,
+// keyStart, maxResult), returning at most maxResult slots of the account in
+// the order of their hashed keys, starting at the hashed key keyStart. Like the
+// REST route, a page holds at most maxStorageRangeLimit slots.
+//
+// Different from the original code, the block and the transaction index are
+// ignored, since there are no blocks and the latest state is always served.
+// Original function: github.com/ethereum/go-ethereum/eth/api_debug.go line 213 (DebugAPI.StorageRangeAt)
+func rpcStorageRangeAt(s *session, params []json.RawMessage) (interface{}, error) {
+	var (
+		addr      common.Address
+		keyStart  hexutil.Bytes
+		maxResult int
+	)
+	if err := rpcParam(params, 2, true, &addr); err != nil {
+		return nil, err
+	}
+	if err := rpcParam(params, 3, true, &keyStart); err != nil {
+		return nil, err
+	}
+	if err := rpcParam(params, 4, true, &maxResult); err != nil {
+		return nil, err
+	}
+	if maxResult < 1 || maxResult > maxStorageRangeLimit {
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("maxResult must be between 1 and %d", maxStorageRangeLimit)}
+	}
+	return s.stateDB.StorageRange(addr, common.BytesToHash(keyStart), maxResult)
+}
+
+// rpcSetState serves storage_setState(address, {key: value}), writing the
+// slots of the account and updating its storage trie the way the "Update
+// Trie" button does. Setting a slot to zero deletes it. The new storage root
+// and state root are returned.
+func rpcSetState(s *session, params []json.RawMessage) (interface{}, error) {
+	var (
+		addr    common.Address
+		storage map[string]string
+	)
+	if err := rpcParam(params, 0, true, &addr); err != nil {
+		return nil, err
+	}
+	if err := rpcParam(params, 1, true, &storage); err != nil {
+		return nil, err
+	}
+	// Parse all the slots up front so that nothing is applied on bad input
+	writes, err := parseSlots(storage)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if s.originalKeyValuePairs[addr] == nil {
+		s.originalKeyValuePairs[addr] = make(map[common.Hash]common.Hash)
+	}
+	for _, w := range writes {
+		s.stateDB.SetState(addr, w.key, w.value)
+		if w.value == (common.Hash{}) {
+			delete(s.originalKeyValuePairs[addr], w.key)
+		} else {
+			s.originalKeyValuePairs[addr][w.key] = w.value
+		}
+	}
+	s.latestStateRoot = s.stateDB.IntermediateRoot(s.deleteEmptyObjects)
+	if err := s.stateDB.Error(); err != nil {
+		return nil, err
+	}
+	obj := s.stateDB.ReadStateObject(addr)
+	return map[string]interface{}{
+		"storageHash": obj.GetRoot(),
+		"stateRoot":   s.latestStateRoot,
+	}, nil
+}
+
+// rpcCommit serves storage_commit(), committing the state into the node
+// database as the next version. The new state root and the version number,
+// which is also the block number, are returned. Without pending changes no
+// version is added, and the latest one is returned.
+func rpcCommit(s *session, params []json.RawMessage) (interface{}, error) {
+	if err := s.commit(); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"stateRoot": s.latestStateRoot,
+		"block":     hexutil.Uint64(s.committedBlock),
+	}, nil
+}
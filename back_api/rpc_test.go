@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/rawdb"
+)
+
+// rpc sends a JSON-RPC request body and decodes the response into v, failing
+// the test unless the request is answered with 200.
+func rpc(t *testing.T, r http.Handler, body string, v interface{}) {
+	t.Helper()
+
+	w := serve(t, r, http.MethodPost, "/rpc", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status mismatch: have %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if v == nil {
+		if w.Body.Len() != 0 {
+			t.Fatalf("unexpected response to a notification: %s", w.Body)
+		}
+		return
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body, err)
+	}
+}
+
+// Tests that the requests of a batch run in order, so that a slot written by
+// one is read back by the next, and that only the requests with an id are
+// answered, in the order of the batch.
+func TestRPCBatch(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+
+	var resps []rpcMessage
+	rpc(t, r, `[
+		{"jsonrpc":"2.0","id":1,"method":"storage_setState","params":["`+testAccount+`",{"0x1":"0x2"}]},
+		{"jsonrpc":"2.0","method":"storage_setState","params":["`+testAccount+`",{"0x3":"0x4"}]},
+		{"jsonrpc":"2.0","id":"two","method":"eth_getStorageAt","params":["`+testAccount+`","0x1","latest"]},
+		1,
+		{"jsonrpc":"2.0","id":3,"method":"eth_getStorageAt","params":["`+testAccount+`","0x3"]}
+	]`, &resps)
+
+	if len(resps) != 4 {
+		t.Fatalf("response count mismatch: have %d, want 4", len(resps))
+	}
+	for i, id := range []string{`1`, `"two"`, `null`, `3`} {
+		if string(resps[i].ID) != id {
+			t.Fatalf("response %d: id mismatch: have %s, want %s", i, resps[i].ID, id)
+		}
+	}
+	if resps[0].Error != nil {
+		t.Fatalf("storage_setState failed: %v", resps[0].Error)
+	}
+	if resps[1].Result != common.HexToHash("0x2").Hex() {
+		t.Fatalf("slot written in the batch reads %v", resps[1].Result)
+	}
+	if resps[2].Error == nil || resps[2].Error.Code != rpcInvalidRequest {
+		t.Fatalf("invalid batch entry answered with %+v", resps[2])
+	}
+	if resps[3].Result != common.HexToHash("0x4").Hex() {
+		t.Fatalf("slot written by a notification reads %v", resps[3].Result)
+	}
+}
+
+// Tests that notifications, i.e. requests without an id, are run but get no
+// response, single or batched.
+func TestRPCNotification(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+
+	rpc(t, r, `{"jsonrpc":"2.0","method":"storage_setState","params":["`+testAccount+`",{"0x1":"0x2"}]}`, nil)
+	rpc(t, r, `[{"jsonrpc":"2.0","method":"storage_setState","params":["`+testAccount+`",{"0x3":"0x4"}]}]`, nil)
+
+	s := defaultSession(t)
+	addr := common.HexToAddress(testAccount)
+	if have := s.stateDB.GetState(addr, common.HexToHash("0x1")); have != common.HexToHash("0x2") {
+		t.Fatalf("single notification not run: slot reads %x", have)
+	}
+	if have := s.stateDB.GetState(addr, common.HexToHash("0x3")); have != common.HexToHash("0x4") {
+		t.Fatalf("batched notification not run: slot reads %x", have)
+	}
+}
+
+// Tests the error codes of the malformed requests.
+func TestRPCErrors(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		// Unknown methods
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_sendTransaction","params":[]}`, rpcMethodNotFound},
+		{`{"jsonrpc":"2.0","id":1,"method":"storage_unknown"}`, rpcMethodNotFound},
+
+		// Invalid params
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_getStorageAt","params":{"address":"` + testAccount + `"}}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_getStorageAt","params":["` + testAccount + `"]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_getStorageAt","params":["` + testAccount + `","0xzz"]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_getStorageAt","params":["` + testAccount + `","0x1","0x10"]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_getProof","params":["` + testAccount + `","0x1"]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"storage_setState","params":[1,{}]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"debug_storageRangeAt","params":[null,0,"` + testAccount + `","0x",0]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"debug_storageRangeAt","params":[null,0,"` + testAccount + `","0x",-1]}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"debug_storageRangeAt","params":[null,0,"` + testAccount + `","0x",1025]}`, rpcInvalidParams},
+
+		// Invalid requests
+		{`{"jsonrpc":"1.0","id":1,"method":"eth_getStorageAt"}`, rpcInvalidRequest},
+		{`{"jsonrpc":"2.0","id":1}`, rpcInvalidRequest},
+		{`[]`, rpcInvalidRequest},
+		{`{"jsonrpc":"2.0",`, rpcParseError},
+	}
+	for i, tt := range tests {
+		var resp rpcMessage
+		rpc(t, r, tt.body, &resp)
+		if resp.Error == nil {
+			t.Fatalf("test %d: no error, result %v", i, resp.Result)
+		}
+		if resp.Error.Code != tt.code {
+			t.Fatalf("test %d: error code mismatch: have %d, want %d (%s)", i, resp.Error.Code, tt.code, resp.Error.Message)
+		}
+	}
+	// The largest page is served
+	var resp rpcMessage
+	rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"debug_storageRangeAt","params":[null,0,"`+testAccount+`","0x",1024]}`, &resp)
+	if resp.Error != nil {
+		t.Fatalf("page of the maximum size failed: %v", resp.Error)
+	}
+}
+
+// Tests that eth_getProof serves the proofs of the state, whose verification
+// is tested along with GetProof, and that the storage keys are echoed in the
+// encoding they were requested in.
+func TestRPCGetProof(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+
+	var resp rpcMessage
+	rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"storage_setState","params":["`+testAccount+`",{"0x1":"0x2a","0x3":"0x4"}]}`, &resp)
+	if resp.Error != nil {
+		t.Fatalf("storage_setState failed: %v", resp.Error)
+	}
+	absent := common.HexToHash("0x2")
+	for _, addr := range []string{testAccount, testUnknown} {
+		var proof struct {
+			Result json.RawMessage `json:"result"`
+			Error  *rpcError       `json:"error"`
+		}
+		rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"eth_getProof","params":["`+addr+`",["0x1","`+absent.Hex()+`"],"latest"]}`, &proof)
+		if proof.Error != nil {
+			t.Fatalf("account %s: eth_getProof failed: %v", addr, proof.Error)
+		}
+		want, err := defaultSession(t).stateDB.GetProof(common.HexToAddress(addr), []common.Hash{common.HexToHash("0x1"), absent})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The slot requested as a quantity is echoed as such, the one
+		// requested as a hash as a hash
+		want.StorageProof[0].Key, want.StorageProof[1].Key = "0x1", absent.Hex()
+		blob, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(proof.Result) != string(blob) {
+			t.Fatalf("account %s: proof mismatch:\nhave %s\nwant %s", addr, proof.Result, blob)
+		}
+	}
+}
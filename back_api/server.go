@@ -1,15 +1,25 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// StartGinServer starts the Gin web server
-func StartGinServer(port string) error {
+// shutdownTimeout is how long the server waits for the requests in flight to
+// finish once it's stopped.
+const shutdownTimeout = 5 * time.Second
+
+// StartGinServer starts the Gin web server and serves until the context is
+// cancelled, then shuts the server down, waiting for the requests in flight,
+// so that the database can be closed safely after it returns.
+func StartGinServer(ctx context.Context, port string) error {
 	// Create Gin router with default middleware (logger, recovery)
 	r := gin.Default()
 
@@ -17,7 +27,7 @@ func StartGinServer(port string) error {
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, "+sessionHeader)
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -35,19 +45,45 @@ func StartGinServer(port string) error {
 
 	// Start HTTP server
 	fmt.Printf("Starting Ethereum Storage Visualizer (Gin) on port %s...\n", port)
-	return r.Run(":" + port)
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	fmt.Println("Shutting down the server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 // setupGinAPIHandlers registers API endpoint handlers with Gin
 func setupGinAPIHandlers(r *gin.Engine) {
 	api := r.Group("/api")
 	{
-		api.POST("/account/create", ginHandleCreateAccount)
-		api.POST("/account/get", ginHandleGetAccount)
-		api.POST("/storage/update", ginHandleUpdateStorage)
-		api.POST("/storage/get", ginHandleGetValue)
-		api.POST("/proof", ginHandleProof)
+		api.POST("/session", ginHandleCreateSession)
+		api.GET("/session/:id", ginHandleGetSession)
+		api.POST("/session/:id/release", ginHandleReleaseSession)
+		api.DELETE("/session/:id", ginHandleCloseSession)
 	}
+	// The handlers run on the session named by the X-Session-ID header, or
+	// by the path under /api/session/:id, or else on the default session.
+	// JSON-RPC is served at /rpc, and at /api/session/:id/rpc for the path.
+	registerAPIRoutes(api.Group("", withSession))
+	registerAPIRoutes(api.Group("/session/:id", withSession))
+
+	r.POST("/rpc", withSession, ginHandleRPC)
+	api.POST("/session/:id/rpc", withSession, ginHandleRPC)
 }
 
 // setupGinStaticFileServer configures static file serving with Gin
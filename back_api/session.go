@@ -0,0 +1,417 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/rawdb"
+	"storage_extract/state"
+	"storage_extract/triedb"
+	"storage_extract/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultSessionID is the session used by requests that don't name one,
+	// which never expires.
+	defaultSessionID = "default"
+
+	// sessionHeader is the request header naming the session of a request,
+	// unless it's given in the path.
+	sessionHeader = "X-Session-ID"
+
+	// sessionIdleTimeout is the time after which a session that served no
+	// request is closed.
+	sessionIdleTimeout = 30 * time.Minute
+
+	// sessionReleaseGrace is the time after which a released session is
+	// closed, unless it's used again in the meantime, e.g. by the page of the
+	// client being reloaded.
+	sessionReleaseGrace = 30 * time.Second
+
+	// maxSessions is the maximum number of sessions open at the same time.
+	maxSessions = 64
+)
+
+var (
+	errSessionNotFound = errors.New("unknown or expired session")
+	errTooManySessions = errors.New("too many sessions")
+)
+
+// session is an isolated workspace: a state database on its own key-value
+// store, which also holds the trie nodes, the contract code and the preimages
+// of the session, the StateDB on top of it and the bookkeeping of the
+// handlers. The requests of a session are serialized by its lock.
+type session struct {
+	id       string
+	lock     sync.Mutex // Serializes the requests of the session
+	lastUsed time.Time  // Time the last request was served, guarded by the manager lock
+	released bool       // Whether the client let go of the session, guarded by the manager lock
+
+	db                    *state.CachingDB
+	stateDB               *state.StateDB
+	latestStateRoot       common.Hash                                    // State root derived by the last trie update
+	committedBlock        uint64                                         // Number of the last block committed over JSON-RPC
+	originalKeyValuePairs map[common.Address]map[common.Hash]common.Hash // Storage written through the API, per account
+	versions              []*version                                     // Committed states, by number from 1
+	deleteEmptyObjects    bool                                           // Whether empty accounts are deleted at the end of every transaction (EIP-161)
+}
+
+// version is a committed state of a session, which stays resolvable as long as
+// the node database keeps the nodes of its root.
+type version struct {
+	Number    uint64          `json:"number"`
+	Root      common.Hash     `json:"root"`      // State root of the version
+	Timestamp int64           `json:"timestamp"` // Unix time of the commit
+	Changes   []versionChange `json:"changes"`   // Storage slots changed by the commit
+
+	storageRoots map[common.Address]common.Hash // Storage roots looked up in the version, by account
+}
+
+// versionChange is a storage slot changed by a commit.
+type versionChange struct {
+	Address common.Address `json:"address"`
+	Key     common.Hash    `json:"key"`
+	Prev    common.Hash    `json:"prev"`
+	Value   common.Hash    `json:"value"`
+}
+
+// newSession creates a session on top of the given key-value store, storing
+// trie nodes with the given config. The session resumes from the versions
+// committed into the store, if any, or starts from an empty state.
+func newSession(id string, disk ethdb.KeyValueStore, config *triedb.Config) (*session, error) {
+	db, err := state.NewDatabaseWithConfig(disk, config)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{
+		id:                    id,
+		lastUsed:              time.Now(),
+		db:                    db,
+		originalKeyValuePairs: make(map[common.Address]map[common.Hash]common.Hash),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load restores the committed versions of the session from its key-value store
+// and opens the state at the latest one. The slots written through the API are
+// recovered from the changes of the versions.
+func (s *session) load() error {
+	disk := s.db.DiskDB()
+	for number := uint64(1); ; number++ {
+		blob := rawdb.ReadVersion(disk, number)
+		if blob == nil {
+			break
+		}
+		v := new(version)
+		if err := json.Unmarshal(blob, v); err != nil {
+			return fmt.Errorf("corrupted version %d: %v", number, err)
+		}
+		for _, ch := range v.Changes {
+			if s.originalKeyValuePairs[ch.Address] == nil {
+				s.originalKeyValuePairs[ch.Address] = make(map[common.Hash]common.Hash)
+			}
+			if ch.Value == (common.Hash{}) {
+				delete(s.originalKeyValuePairs[ch.Address], ch.Key)
+			} else {
+				s.originalKeyValuePairs[ch.Address][ch.Key] = ch.Value
+			}
+		}
+		s.versions = append(s.versions, v)
+	}
+	root := rawdb.ReadHeadStateRoot(disk)
+	stateDB, err := state.New(root, s.db)
+	if err != nil {
+		return fmt.Errorf("failed to open the state at %x: %v", root, err)
+	}
+	s.stateDB, s.latestStateRoot = stateDB, root
+	s.committedBlock = uint64(len(s.versions))
+	return nil
+}
+
+// commit commits the state of the session into the node database as the next
+// version and reopens it at the committed root, since the tries of a committed
+// state are no longer usable. The version is recorded in the key-value store
+// as the new head, along with the preimages of the written slots, so that the
+// session can be resumed from it. A commit leaving the state root unchanged
+// records no version, so that every version has a root of its own.
+func (s *session) commit() error {
+	pending, err := s.stateDB.PendingStorageChanges()
+	if err != nil {
+		return err
+	}
+	changes := []versionChange{}
+	for _, ch := range pending {
+		changes = append(changes, versionChange{
+			Address: ch.Address,
+			Key:     ch.Key,
+			Prev:    ch.Prev,
+			Value:   s.stateDB.GetState(ch.Address, ch.Key),
+		})
+	}
+	root, err := s.stateDB.Commit(s.committedBlock+1, s.deleteEmptyObjects)
+	if err != nil {
+		return err
+	}
+	stateDB, err := state.New(root, s.db)
+	if err != nil {
+		return err
+	}
+	// The committed state is swapped out right away, so that the session stays
+	// usable even if the version can't be recorded below
+	s.stateDB, s.latestStateRoot = stateDB, root
+
+	head := types.EmptyRootHash
+	if len(s.versions) > 0 {
+		head = s.versions[len(s.versions)-1].Root
+	}
+	if root == head {
+		return nil
+	}
+	v := &version{
+		Number:    s.committedBlock + 1,
+		Root:      root,
+		Timestamp: time.Now().Unix(),
+		Changes:   changes,
+	}
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	batch := s.db.DiskDB().NewBatch()
+	if err := rawdb.WriteVersion(batch, v.Number, blob); err != nil {
+		return err
+	}
+	if err := rawdb.WriteHeadStateRoot(batch, root); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if err := s.db.TrieDB().WritePreimages(); err != nil {
+		return err
+	}
+	s.committedBlock++
+	s.versions = append(s.versions, v)
+	return nil
+}
+
+// sessionManager keeps track of the open sessions and closes the idle ones.
+type sessionManager struct {
+	lock     sync.Mutex
+	sessions map[string]*session
+	config   *triedb.Config // Trie database config of the new sessions
+}
+
+// newSessionManager creates a session manager whose default session is backed
+// by the given key-value store. All sessions store trie nodes with the given
+// config.
+func newSessionManager(disk ethdb.KeyValueStore, config *triedb.Config) (*sessionManager, error) {
+	def, err := newSession(defaultSessionID, disk, config)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionManager{
+		sessions: map[string]*session{defaultSessionID: def},
+		config:   config,
+	}, nil
+}
+
+// create opens a new session with an empty in-memory state.
+func (m *sessionManager) create(deleteEmptyObjects bool) (*session, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.expire()
+	if len(m.sessions)-1 >= maxSessions { // the default session is not counted
+		return nil, errTooManySessions
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	s, err := newSession(hex.EncodeToString(id[:]), memorydb.New(), m.config)
+	if err != nil {
+		return nil, err
+	}
+	s.deleteEmptyObjects = deleteEmptyObjects
+	m.sessions[s.id] = s
+	return s, nil
+}
+
+// get returns the open session with the given id, marking it as used.
+func (m *sessionManager) get(id string) (*session, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.expire()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+	s.lastUsed, s.released = time.Now(), false
+	return s, nil
+}
+
+// touch marks the session as used, so that it only expires once it's been
+// idle for the timeout after its last request completed.
+func (m *sessionManager) touch(s *session) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s.lastUsed = time.Now()
+}
+
+// close closes the session with the given id. The default session can't be
+// closed.
+func (m *sessionManager) close(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.sessions[id]; !ok || id == defaultSessionID {
+		return errSessionNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+// release marks the session with the given id as released by its client: it's
+// closed after a short grace, unless it's used again in the meantime. The
+// default session can't be released.
+func (m *sessionManager) release(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || id == defaultSessionID {
+		return errSessionNotFound
+	}
+	s.lastUsed, s.released = time.Now(), true
+	return nil
+}
+
+// expire closes the sessions idle for longer than the timeout, or than the
+// grace for the released ones. This function assumes the lock is already held.
+func (m *sessionManager) expire() {
+	for id, s := range m.sessions {
+		timeout := sessionIdleTimeout
+		if s.released {
+			timeout = sessionReleaseGrace
+		}
+		if id != defaultSessionID && time.Since(s.lastUsed) > timeout {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// withSession is the middleware resolving the session of a request, which is
+// named by the path, the X-Session-ID header or otherwise the default one.
+// The session is locked until the request is served.
+func withSession(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		id = c.GetHeader(sessionHeader)
+	}
+	if id == "" {
+		id = defaultSessionID
+	}
+	s, err := sessions.get(id)
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusNotFound)
+		c.Abort()
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer sessions.touch(s)
+
+	c.Set("session", s)
+	c.Next()
+}
+
+// currentSession returns the session of a request resolved by withSession.
+func currentSession(c *gin.Context) *session {
+	return c.MustGet("session").(*session)
+}
+
+// ginHandleCreateSession creates an isolated session and returns its id, which
+// the following requests give in the X-Session-ID header or the path. With
+// deleteEmptyObjects the session applies EIP-161: the empty accounts touched
+// by a transaction are deleted at its end, like Finalise(true) does.
+func ginHandleCreateSession(c *gin.Context) {
+	// A request without a body gets the default options
+	var req struct {
+		DeleteEmptyObjects bool `json:"deleteEmptyObjects"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			ginWriteError(c, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	s, err := sessions.create(req.DeleteEmptyObjects)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errTooManySessions) {
+			code = http.StatusServiceUnavailable
+		}
+		ginWriteError(c, err.Error(), code)
+		return
+	}
+	c.JSON(http.StatusOK, sessionInfo(s))
+}
+
+// ginHandleGetSession resumes a session, e.g. after the page of the client was
+// reloaded, and returns it like it was created. A released session is kept
+// open again.
+func ginHandleGetSession(c *gin.Context) {
+	s, err := sessions.get(c.Param("id"))
+	if err != nil {
+		ginWriteError(c, err.Error(), http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, sessionInfo(s))
+}
+
+// ginHandleReleaseSession releases a session, which is closed after a short
+// grace unless it's resumed. Clients release their session when their page is
+// hidden, which happens both when it's closed and when it's reloaded.
+func ginHandleReleaseSession(c *gin.Context) {
+	if err := sessions.release(c.Param("id")); err != nil {
+		ginWriteError(c, err.Error(), http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"status": "success"})
+}
+
+// sessionInfo describes a session to its client.
+func sessionInfo(s *session) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 s.id,
+		"scheme":             s.db.TrieDB().Scheme(),
+		"idleTimeout":        sessionIdleTimeout.String(),
+		"deleteEmptyObjects": s.deleteEmptyObjects,
+	}
+}
+
+// ginHandleCloseSession closes a session, discarding its state.
+func ginHandleCloseSession(c *gin.Context) {
+	if err := sessions.close(c.Param("id")); err != nil {
+		ginWriteError(c, err.Error(), http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"status": "success"})
+}
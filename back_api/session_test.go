@@ -0,0 +1,297 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/rawdb"
+	"storage_extract/triedb"
+)
+
+// getValue reads a slot of the test account through the session named by the
+// given header, the default one if it's empty.
+func getValue(t *testing.T, r http.Handler, id string, key string) interface{} {
+	t.Helper()
+
+	blob, err := json.Marshal(map[string]string{"address": testAccount, "key": key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/storage/get", bytes.NewReader(blob))
+	req.Header.Set("Content-Type", "application/json")
+	if id != "" {
+		req.Header.Set(sessionHeader, id)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status mismatch: have %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body, err)
+	}
+	return resp["value"]
+}
+
+// Tests that the sessions don't see each other's writes, whether they're
+// named in the path or the header, and that the requests naming no session
+// run on the default one.
+func TestSessionIsolation(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+	first, second := newTestSession(t, r, nil), newTestSession(t, r, nil)
+
+	for prefix, value := range map[string]string{first: "0x1", second: "0x2", "/api": "0x3"} {
+		post(t, r, prefix+"/storage/update", map[string]interface{}{
+			"address": testAccount,
+			"storage": map[string]string{"0x1": value},
+		}, http.StatusOK)
+	}
+	tests := []struct {
+		id    string
+		value string
+	}{
+		{sessionByPath(t, first).id, "1"},
+		{sessionByPath(t, second).id, "2"},
+		{"", "3"},
+		{defaultSessionID, "3"},
+	}
+	for _, tt := range tests {
+		if value := getValue(t, r, tt.id, "0x1"); value != tt.value {
+			t.Fatalf("session %q: slot reads %v, want %s", tt.id, value, tt.value)
+		}
+	}
+	if sessionByPath(t, first).latestStateRoot == sessionByPath(t, second).latestStateRoot {
+		t.Fatal("sessions with different writes share the state root")
+	}
+	// A slot written in a session only is unknown to the others
+	post(t, r, first+"/storage/update", map[string]interface{}{
+		"address": testAccount,
+		"storage": map[string]string{"0x2": "0x5"},
+	}, http.StatusOK)
+	if value := getValue(t, r, "", "0x2"); value != "0" {
+		t.Fatalf("default session reads the slot of another session: %v", value)
+	}
+	// Unknown sessions aren't replaced by the default one
+	if w := serve(t, r, http.MethodPost, "/api/session/unknown/storage/get", map[string]string{"address": testAccount, "key": "0x1"}); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown session: status mismatch: have %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// Tests that the versions are numbered from 1 without gaps, that a commit
+// leaving the state root unchanged records no version and takes no number, and
+// that the numbering resumes where it stopped once the session is reopened.
+func TestVersionNumbering(t *testing.T) {
+	for _, scheme := range []string{rawdb.HashScheme, rawdb.PathScheme} {
+		t.Run(scheme, func(t *testing.T) {
+			r := newTestServer(t, scheme)
+			disk := memorydb.New()
+			config := triedb.HashDefaults
+			if scheme == rawdb.PathScheme {
+				config = triedb.PathDefaults
+			}
+			manager, err := newSessionManager(disk, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sessions = manager
+			s := defaultSession(t)
+
+			steps := []struct {
+				storage map[string]string
+				block   uint64 // Number of the last version after the step
+			}{
+				{map[string]string{"0x1": "0x1"}, 1},
+				{map[string]string{"0x1": "0x2"}, 2},
+				{map[string]string{"0x1": "0x2"}, 2}, // same value
+				{map[string]string{}, 2},             // no write
+				{map[string]string{"0x2": "0x0"}, 2}, // deleting an absent slot
+				{map[string]string{"0x2": "0x3"}, 3},
+				{map[string]string{"0x2": "0x0"}, 4},
+			}
+			for i, step := range steps {
+				post(t, r, "/api/storage/update", map[string]interface{}{
+					"address": testAccount,
+					"storage": step.storage,
+				}, http.StatusOK)
+				if s.committedBlock != step.block {
+					t.Fatalf("step %d: committed block mismatch: have %d, want %d", i, s.committedBlock, step.block)
+				}
+			}
+			// An empty commit over JSON-RPC records no version either
+			var resp rpcMessage
+			rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"storage_commit"}`, &resp)
+			if resp.Error != nil {
+				t.Fatal(resp.Error)
+			}
+			if block := resp.Result.(map[string]interface{})["block"]; block != "0x4" {
+				t.Fatalf("empty commit returned block %v, want 0x4", block)
+			}
+			check := func(s *session) {
+				if len(s.versions) != 4 || s.committedBlock != 4 {
+					t.Fatalf("have %d versions up to block %d, want 4", len(s.versions), s.committedBlock)
+				}
+				for i, v := range s.versions {
+					if v.Number != uint64(i+1) {
+						t.Fatalf("version %d numbered %d", i+1, v.Number)
+					}
+					if i > 0 && v.Root == s.versions[i-1].Root {
+						t.Fatalf("version %d has the root of the previous one", v.Number)
+					}
+				}
+				if head := s.versions[len(s.versions)-1].Root; s.latestStateRoot != head {
+					t.Fatalf("latest state root mismatch: have %x, want %x", s.latestStateRoot, head)
+				}
+			}
+			check(s)
+
+			// The session resumes from the store with the same numbering
+			reopened, err := newSession(defaultSessionID, disk, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(reopened)
+			if err := reopened.commit(); err != nil {
+				t.Fatal(err)
+			}
+			reopened.stateDB.SetState(common.HexToAddress(testAccount), common.HexToHash("0x1"), common.HexToHash("0x1"))
+			if err := reopened.commit(); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(reopened.versions); n != 5 || reopened.versions[4].Number != 5 {
+				t.Fatalf("reopened session recorded %d versions, want 5 numbered up to 5", n)
+			}
+		})
+	}
+}
+
+// Tests that the slots wiped by a self-destruct are recorded as deleted in the
+// version committing it, so that the reopened session doesn't bring them back.
+func TestSelfDestructResume(t *testing.T) {
+	r := newTestServer(t, rawdb.HashScheme)
+	disk := memorydb.New()
+	manager, err := newSessionManager(disk, triedb.HashDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions = manager
+
+	post(t, r, "/api/storage/update", map[string]interface{}{
+		"address": testAccount,
+		"storage": map[string]string{"0x1": "0x2", "0x3": "0x4"},
+	}, http.StatusOK)
+	post(t, r, "/api/account/selfdestruct", map[string]string{"address": testAccount}, http.StatusOK)
+	var resp rpcMessage
+	rpc(t, r, `{"jsonrpc":"2.0","id":1,"method":"storage_commit"}`, &resp)
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	s := defaultSession(t)
+	if n := len(s.versions); n != 2 {
+		t.Fatalf("version count mismatch: have %d, want 2", n)
+	}
+	addr := common.HexToAddress(testAccount)
+	want := []versionChange{
+		{Address: addr, Key: common.HexToHash("0x1"), Prev: common.HexToHash("0x2")},
+		{Address: addr, Key: common.HexToHash("0x3"), Prev: common.HexToHash("0x4")},
+	}
+	if have := s.versions[1].Changes; !reflect.DeepEqual(have, want) {
+		t.Fatalf("changes mismatch: have %v, want %v", have, want)
+	}
+
+	reopened, err := newSession(defaultSessionID, disk, triedb.HashDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slots := reopened.originalKeyValuePairs[addr]; len(slots) != 0 {
+		t.Fatalf("reopened session brought back the wiped slots: %v", slots)
+	}
+	if reopened.stateDB.Exist(addr) {
+		t.Fatal("self-destructed account exists in the reopened session")
+	}
+}
+
+// failingStore is a key-value store whose batches fail to write if they hold
+// the given key.
+type failingStore struct {
+	ethdb.KeyValueStore
+	key []byte
+}
+
+func (db *failingStore) NewBatch() ethdb.Batch {
+	return &failingBatch{Batch: db.KeyValueStore.NewBatch(), key: db.key}
+}
+
+// failingBatch is a batch of failingStore.
+type failingBatch struct {
+	ethdb.Batch
+	key  []byte
+	fail bool
+}
+
+func (b *failingBatch) Put(key []byte, value []byte) error {
+	if bytes.Equal(key, b.key) {
+		b.fail = true
+	}
+	return b.Batch.Put(key, value)
+}
+
+func (b *failingBatch) Write() error {
+	if b.fail {
+		return errors.New("batch write failed")
+	}
+	return b.Batch.Write()
+}
+
+// Tests that a commit whose version can't be recorded still leaves the session
+// on the reopened state, so that it can be written and committed again.
+func TestCommitFailedVersion(t *testing.T) {
+	// Find the key of the head state root to fail the batch of the version
+	keys := memorydb.New()
+	if err := rawdb.WriteHeadStateRoot(keys, common.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	it := keys.NewIterator(nil, nil)
+	if !it.Next() {
+		t.Fatal("head state root not written")
+	}
+	disk := &failingStore{KeyValueStore: memorydb.New(), key: common.CopyBytes(it.Key())}
+	it.Release()
+
+	s, err := newSession(defaultSessionID, disk, triedb.HashDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.HexToAddress(testAccount)
+	s.stateDB.SetState(addr, common.HexToHash("0x1"), common.HexToHash("0x2"))
+	if err := s.commit(); err == nil {
+		t.Fatal("commit succeeded with a failing batch")
+	}
+	if len(s.versions) != 0 || s.committedBlock != 0 {
+		t.Fatalf("failed commit recorded %d versions up to block %d", len(s.versions), s.committedBlock)
+	}
+	if have := s.stateDB.IntermediateRoot(false); have != s.latestStateRoot {
+		t.Fatalf("session state at %x, latest state root %x", have, s.latestStateRoot)
+	}
+	if value := s.stateDB.GetState(addr, common.HexToHash("0x1")); value != common.HexToHash("0x2") {
+		t.Fatalf("committed slot reads %x after the failed commit", value)
+	}
+
+	// The session commits again once the store recovers
+	disk.key = nil
+	s.stateDB.SetState(addr, common.HexToHash("0x3"), common.HexToHash("0x4"))
+	if err := s.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.versions) != 1 || s.versions[0].Root != s.latestStateRoot {
+		t.Fatalf("have %d versions, want 1 at %x", len(s.versions), s.latestStateRoot)
+	}
+}
@@ -1,6 +1,15 @@
 package common
 
-import "github.com/ethereum/go-ethereum/common/hexutil"
+import (
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	hashT    = reflect.TypeOf(Hash{})
+	addressT = reflect.TypeOf(Address{})
+)
 
 // Lengths of hashes and addresses in bytes.
 const (
@@ -45,6 +54,24 @@ func (h Hash) Bytes() []byte { return h[:] }
 // Hex converts a hash to a hex string.
 func (h Hash) Hex() string { return hexutil.Encode(h[:]) }
 
+// UnmarshalText parses a hash in hex syntax.
+// Original function: github.com/ethereum/go-ethereum/common/types.go line 131
+func (h *Hash) UnmarshalText(input []byte) error {
+	return hexutil.UnmarshalFixedText("Hash", input, h[:])
+}
+
+// UnmarshalJSON parses a hash in hex syntax.
+// Original function: github.com/ethereum/go-ethereum/common/types.go line 136
+func (h *Hash) UnmarshalJSON(input []byte) error {
+	return hexutil.UnmarshalFixedJSON(hashT, input, h[:])
+}
+
+// MarshalText returns the hex representation of h.
+// Original function: github.com/ethereum/go-ethereum/common/types.go line 141
+func (h Hash) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(h[:]).MarshalText()
+}
+
 // /////////////////////////////////////////////////////////////////////////
 // Address represents the 20 byte address of an Ethereum account.
 type Address [AddressLength]byte
@@ -74,3 +101,21 @@ func (a *Address) SetBytes(b []byte) {
 	}
 	copy(a[AddressLength-len(b):], b)
 }
+
+// MarshalText returns the hex representation of a.
+// Original function: github.com/ethereum/go-ethereum/common/types.go line 327
+func (a Address) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(a[:]).MarshalText()
+}
+
+// UnmarshalText parses an address in hex syntax.
+// Original function: github.com/ethereum/go-ethereum/common/types.go line 332
+func (a *Address) UnmarshalText(input []byte) error {
+	return hexutil.UnmarshalFixedText("Address", input, a[:])
+}
+
+// UnmarshalJSON parses an address in hex syntax.
+// Original function: github.com/ethereum/go-ethereum/common/types.go line 337
+func (a *Address) UnmarshalJSON(input []byte) error {
+	return hexutil.UnmarshalFixedJSON(addressT, input, a[:])
+}
@@ -0,0 +1,555 @@
+// Package filedb implements a simple append-only, file-backed key-value store.
+//
+// Every write is appended to a single log file as a checksummed record and the
+// live key set is kept in memory. Opening the database replays the log, so the
+// content survives restarts. A torn record at the tail of the log (e.g. caused
+// by a crash during a write) is discarded on open, a corrupted record followed
+// by others fails the open.
+//
+// The record layout is:
+//
+//	op (1 byte) | uvarint(len(key)) | uvarint(len(value)) | key | value | crc32 (4 bytes)
+//
+// where the checksum covers everything preceding it in the record.
+package filedb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+)
+
+const (
+	opPut    byte = 0x01 // Record stores a value for the key
+	opDelete byte = 0x02 // Record removes the key
+
+	// maxRecordSize caps the payload length accepted by the decoder, so that a
+	// garbled length prefix can't trigger a huge allocation.
+	maxRecordSize = 64 * 1024 * 1024
+)
+
+var (
+	// errClosed is returned if the database was already closed at the invocation
+	// of a data access operation.
+	errClosed = errors.New("database closed")
+
+	// errNotFound is returned if a key is requested that is not found in the
+	// database.
+	errNotFound = errors.New("not found")
+
+	// errCorrupted is returned by the record decoder if the record is malformed
+	// or its checksum does not match, and by New if such a record is followed by
+	// others in the log.
+	errCorrupted = errors.New("corrupted record")
+)
+
+// Database is a persistent key-value store backed by an append-only log file.
+// Apart from basic data storage functionality it also supports batch writes and
+// iterating over the keyspace in binary-alphabetical order.
+type Database struct {
+	path string
+	file *os.File
+	db   map[string][]byte // Live key set, rebuilt from the log on open
+	size int64             // Size of the log file in bytes
+	lock sync.RWMutex
+}
+
+// New opens (or creates) the log file at the given path and replays its
+// content. A torn record at the tail of the log is truncated, a corrupted one
+// in the middle of it is reported as errCorrupted.
+func New(path string) (*Database, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	db := &Database{
+		path: path,
+		file: file,
+		db:   make(map[string][]byte),
+	}
+	if err := db.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// replay reads the whole log into the in-memory key set. A record failing to
+// decode is only the torn tail of an interrupted write if it runs to the end
+// of the log, the log is then truncated before it. Truncating at a record in
+// the middle of the log would silently drop the ones after it, so that's
+// reported as corruption instead.
+func (db *Database) replay() error {
+	if _, err := db.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var (
+		reader = bufio.NewReader(db.file)
+		offset int64
+	)
+	for {
+		op, key, value, n, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err != io.ErrUnexpectedEOF {
+				if _, err := reader.Peek(1); err != io.EOF {
+					return fmt.Errorf("%w at offset %d", errCorrupted, offset)
+				}
+			}
+			// Drop the torn tail, everything before it is intact.
+			if err := db.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		switch op {
+		case opPut:
+			db.db[string(key)] = value
+		case opDelete:
+			delete(db.db, string(key))
+		}
+		offset += int64(n)
+	}
+	db.size = offset
+	_, err := db.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// readRecord decodes a single record from the reader, returning the operation,
+// key, value and the number of bytes consumed. A clean end of the log is
+// reported as io.EOF, a record cut short by the end of the log as
+// io.ErrUnexpectedEOF and anything else as errCorrupted.
+func readRecord(r *bufio.Reader) (byte, []byte, []byte, int, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, nil, 0, io.EOF
+	}
+	if op != opPut && op != opDelete {
+		return 0, nil, nil, 0, errCorrupted
+	}
+	klen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, nil, 0, decodeError(err)
+	}
+	vlen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, nil, 0, decodeError(err)
+	}
+	if klen+vlen > maxRecordSize {
+		return 0, nil, nil, 0, errCorrupted
+	}
+	header := appendHeader(nil, op, int(klen), int(vlen))
+	body := make([]byte, klen+vlen+4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, nil, 0, decodeError(err)
+	}
+	payload, sum := body[:klen+vlen], body[klen+vlen:]
+	crc := crc32.Update(crc32.ChecksumIEEE(header), crc32.IEEETable, payload)
+	if binary.BigEndian.Uint32(sum) != crc {
+		return 0, nil, nil, 0, errCorrupted
+	}
+	return op, payload[:klen], payload[klen:], len(header) + len(body), nil
+}
+
+// decodeError maps a read error within a record to the one reported by
+// readRecord.
+func decodeError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return io.ErrUnexpectedEOF
+	}
+	return errCorrupted
+}
+
+// appendHeader appends the record header (operation and lengths) to buf.
+func appendHeader(buf []byte, op byte, klen, vlen int) []byte {
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(klen))
+	return binary.AppendUvarint(buf, uint64(vlen))
+}
+
+// appendRecord appends a full checksummed record to buf.
+func appendRecord(buf []byte, op byte, key, value []byte) []byte {
+	start := len(buf)
+	buf = appendHeader(buf, op, len(key), len(value))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+// write appends the encoded records to the log. The caller must hold the lock.
+//
+// The write is all or nothing: if only a part of the records made it to the
+// file, the log is truncated back to where it was, so that the torn bytes don't
+// hide the records appended after them when the log is replayed.
+func (db *Database) write(data []byte) error {
+	if _, err := db.file.Write(data); err != nil {
+		if terr := db.file.Truncate(db.size); terr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, terr)
+		}
+		if _, serr := db.file.Seek(db.size, io.SeekStart); serr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, serr)
+		}
+		return err
+	}
+	db.size += int64(len(data))
+	return nil
+}
+
+// Close flushes the log to disk and releases the file handle. Any consecutive
+// data access op fails with an error.
+func (db *Database) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return nil
+	}
+	db.db = nil
+	if err := db.file.Sync(); err != nil {
+		db.file.Close()
+		return err
+	}
+	return db.file.Close()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return false, errClosed
+	}
+	_, ok := db.db[string(key)]
+	return ok, nil
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return nil, errClosed
+	}
+	if entry, ok := db.db[string(key)]; ok {
+		return common.CopyBytes(entry), nil
+	}
+	return nil, errNotFound
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return errClosed
+	}
+	if err := db.write(appendRecord(nil, opPut, key, value)); err != nil {
+		return err
+	}
+	db.db[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return errClosed
+	}
+	if _, ok := db.db[string(key)]; !ok {
+		return nil
+	}
+	if err := db.write(appendRecord(nil, opDelete, key, nil)); err != nil {
+		return err
+	}
+	delete(db.db, string(key))
+	return nil
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() ethdb.Batch {
+	return &batch{
+		db: db,
+	}
+}
+
+// NewBatchWithSize creates a write-only database batch with pre-allocated buffer.
+func (db *Database) NewBatchWithSize(size int) ethdb.Batch {
+	return &batch{
+		db:     db,
+		writes: make([]keyvalue, 0, size),
+	}
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var (
+		pr     = string(prefix)
+		st     = string(append(prefix, start...))
+		keys   = make([]string, 0, len(db.db))
+		values = make([][]byte, 0, len(db.db))
+	)
+	for key := range db.db {
+		if !strings.HasPrefix(key, pr) {
+			continue
+		}
+		if key >= st {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values = append(values, db.db[key])
+	}
+	return &iterator{
+		index:  -1,
+		keys:   keys,
+		values: values,
+	}
+}
+
+// Stat returns the statistic data of the database.
+func (db *Database) Stat() (string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return "", errClosed
+	}
+	var live int
+	for key, value := range db.db {
+		live += len(key) + len(value)
+	}
+	return fmt.Sprintf("filedb: %d entries, %d live bytes, %d log bytes", len(db.db), live, db.size), nil
+}
+
+// Compact rewrites the log so that it only contains the live key set, dropping
+// every overwritten or deleted record. The range arguments are ignored, the
+// entire log is always compacted.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return errClosed
+	}
+	keys := make([]string, 0, len(db.db))
+	for key := range db.db {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf []byte
+	for _, key := range keys {
+		buf = appendRecord(buf, opPut, []byte(key), db.db[key])
+	}
+	// The compacted log must be on disk before it replaces the current one,
+	// otherwise a crash right after the rename could leave an empty log.
+	tmp := db.path + ".tmp"
+	if err := writeFileSync(tmp, buf); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, db.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(db.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return err
+	}
+	db.file.Close()
+	db.file = file
+	db.size = int64(len(buf))
+	return nil
+}
+
+// writeFileSync writes the data into the file at the given path, replacing
+// it, and flushes it to disk.
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Len returns the number of entries currently present in the database.
+func (db *Database) Len() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return len(db.db)
+}
+
+// keyvalue is a key-value tuple tagged with a deletion field to allow creating
+// write batches.
+type keyvalue struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// batch is a write-only batch that commits changes to its host database when
+// Write is called. All buffered records are appended to the log at once.
+type batch struct {
+	db     *Database
+	writes []keyvalue
+	size   int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{string(key), common.CopyBytes(value), false})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+// Delete inserts the key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{string(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to the log. The records are appended in
+// a single write, which is rolled back on failure, so either all or none of
+// the batch is applied.
+func (b *batch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	if b.db.db == nil {
+		return errClosed
+	}
+	var buf []byte
+	for _, entry := range b.writes {
+		if entry.delete {
+			buf = appendRecord(buf, opDelete, []byte(entry.key), nil)
+			continue
+		}
+		buf = appendRecord(buf, opPut, []byte(entry.key), entry.value)
+	}
+	if err := b.db.write(buf); err != nil {
+		return err
+	}
+	for _, entry := range b.writes {
+		if entry.delete {
+			delete(b.db.db, entry.key)
+			continue
+		}
+		b.db.db[entry.key] = entry.value
+	}
+	return nil
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	for _, entry := range b.writes {
+		if entry.delete {
+			if err := w.Delete([]byte(entry.key)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put([]byte(entry.key), entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterator walks over a sorted snapshot of the (potentially partial) keyspace
+// taken when the iterator was created.
+type iterator struct {
+	index  int
+	keys   []string
+	values [][]byte
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *iterator) Next() bool {
+	if it.index >= len(it.keys) {
+		return false
+	}
+	it.index += 1
+	return it.index < len(it.keys)
+}
+
+// Error returns any accumulated error. The snapshot iterator cannot encounter
+// errors.
+func (it *iterator) Error() error {
+	return nil
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *iterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (it *iterator) Release() {
+	it.index, it.keys, it.values = -1, nil, nil
+}
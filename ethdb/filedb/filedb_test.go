@@ -0,0 +1,219 @@
+package filedb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/dbtest"
+)
+
+func TestFileDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() ethdb.KeyValueStore {
+			db, err := New(filepath.Join(t.TempDir(), "db.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+// checkContent verifies that the database holds exactly the given key set.
+func checkContent(t *testing.T, db *Database, want map[string]string) {
+	t.Helper()
+
+	if db.Len() != len(want) {
+		t.Fatalf("entry count mismatch: have %d, want %d", db.Len(), len(want))
+	}
+	for key, value := range want {
+		have, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if !bytes.Equal(have, []byte(value)) {
+			t.Fatalf("key %q: value mismatch: have %q, want %q", key, have, value)
+		}
+	}
+}
+
+// Tests that the puts, deletes and batches written to the log are replayed
+// when the database is reopened.
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.log")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("a"), []byte("1"))
+	db.Put([]byte("b"), []byte("2"))
+	db.Put([]byte("a"), []byte("3"))
+	db.Delete([]byte("b"))
+
+	b := db.NewBatch()
+	b.Put([]byte("c"), []byte("4"))
+	b.Put([]byte("d"), nil)
+	b.Delete([]byte("c"))
+	b.Put([]byte("e"), []byte("5"))
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "3", "d": "", "e": "5"}
+	checkContent(t, db, want)
+	db.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkContent(t, db, want)
+}
+
+// Tests that a torn record at the tail of the log is dropped on open, and that
+// the writes acknowledged after it survive the next reopen.
+func TestTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.log")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("a"), []byte("1"))
+	db.Put([]byte("b"), []byte("2"))
+	db.Close()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intact := stat.Size()
+
+	// Append every proper prefix of a record, as left by a crash in the middle
+	// of a write, and make sure each one is discarded
+	record := appendRecord(nil, opPut, []byte("c"), []byte("3"))
+	for cut := 1; cut < len(record); cut++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(record[:cut])
+		file.Close()
+
+		db, err := New(path)
+		if err != nil {
+			t.Fatalf("cut %d: %v", cut, err)
+		}
+		checkContent(t, db, map[string]string{"a": "1", "b": "2"})
+		db.Close()
+
+		if stat, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if stat.Size() != intact {
+			t.Fatalf("cut %d: torn tail not truncated: have %d bytes, want %d", cut, stat.Size(), intact)
+		}
+	}
+	// A garbled checksum is as good as a torn record
+	garbled := bytes.Clone(record)
+	garbled[len(garbled)-1] ^= 0xff
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(garbled)
+	file.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkContent(t, db, map[string]string{"a": "1", "b": "2"})
+
+	// The writes following the recovery are appended to the intact log
+	db.Put([]byte("d"), []byte("4"))
+	db.Delete([]byte("a"))
+	db.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkContent(t, db, map[string]string{"b": "2", "d": "4"})
+}
+
+// Tests that a corrupted record followed by others fails the open instead of
+// truncating the log, which would drop the intact records after it.
+func TestCorruptedMiddle(t *testing.T) {
+	first := appendRecord(nil, opPut, []byte("a"), []byte("1"))
+	log := appendRecord(bytes.Clone(first), opPut, []byte("b"), []byte("2"))
+	log = appendRecord(log, opPut, []byte("c"), []byte("3"))
+
+	tests := []struct {
+		name   string
+		garble int // Offset of the garbled byte
+	}{
+		{"operation", len(first)},
+		{"value", len(first) + 4},
+		{"checksum", len(first) + 5},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "db.log")
+		garbled := bytes.Clone(log)
+		garbled[tt.garble] ^= 0xff
+		if err := os.WriteFile(path, garbled, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := New(path); !errors.Is(err, errCorrupted) {
+			t.Fatalf("%s: open error mismatch: have %v, want %v", tt.name, err, errCorrupted)
+		}
+		if stat, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if stat.Size() != int64(len(garbled)) {
+			t.Fatalf("%s: corrupted log truncated to %d bytes, want %d", tt.name, stat.Size(), len(garbled))
+		}
+	}
+}
+
+// Tests that compaction drops the dead records without changing the content,
+// and that the compacted log is replayed and appended to like any other.
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.log")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		db.Put([]byte("a"), []byte{byte(i)})
+		db.Put([]byte("b"), []byte{byte(i)})
+		db.Delete([]byte("b"))
+	}
+	db.Put([]byte("c"), []byte("3"))
+	want := map[string]string{"a": string([]byte{99}), "c": "3"}
+
+	before := db.size
+	if err := db.Compact(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if db.size >= before {
+		t.Fatalf("log not compacted: have %d bytes, had %d", db.size, before)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary log left behind: %v", err)
+	}
+	checkContent(t, db, want)
+
+	db.Put([]byte("d"), []byte("4"))
+	want["d"] = "4"
+	db.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkContent(t, db, want)
+}
@@ -0,0 +1,16 @@
+package memorydb
+
+import (
+	"testing"
+
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/dbtest"
+)
+
+func TestMemoryDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() ethdb.KeyValueStore {
+			return New()
+		})
+	})
+}
@@ -2,6 +2,88 @@
  * API Client - Handles all communication with the backend API
  */
 class ApiClient {
+    /**
+     * The id of the session the requests run on, null for the default session
+     */
+    static sessionId = null;
+
+    /**
+     * Get the headers of a request, naming the session it runs on
+     * @returns {Object} The request headers
+     */
+    static headers() {
+        const headers = { 'Content-Type': 'application/json' };
+        if (ApiClient.sessionId) {
+            headers['X-Session-ID'] = ApiClient.sessionId;
+        }
+        return headers;
+    }
+
+    /**
+     * Create an isolated session, which the following requests run on
+     * @returns {Promise} The response promise
+     */
+    static async createSession() {
+        try {
+            const response = await fetch('/api/session', {
+                method: 'POST',
+                headers: ApiClient.headers()
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            const session = await response.json();
+            ApiClient.sessionId = session.id;
+            return session;
+        } catch (error) {
+            console.error('Error creating session:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Resume a session, e.g. the one the page used before it was reloaded
+     * @param {string} id - The id of the session
+     * @returns {Promise} The response promise, rejected if the session has expired
+     */
+    static async resumeSession(id) {
+        try {
+            const response = await fetch(`/api/session/${encodeURIComponent(id)}`, {
+                method: 'GET',
+                headers: ApiClient.headers()
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            const session = await response.json();
+            ApiClient.sessionId = session.id;
+            return session;
+        } catch (error) {
+            console.error('Error resuming session:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Release the session, which the server closes shortly unless it's resumed.
+     * The request outlives the page, so it can be sent while the page is hidden.
+     */
+    static releaseSession() {
+        if (!ApiClient.sessionId) {
+            return;
+        }
+        fetch(`/api/session/${encodeURIComponent(ApiClient.sessionId)}/release`, {
+            method: 'POST',
+            keepalive: true
+        }).catch(() => {});
+    }
+    
     /**
      * Create a new account
      * @param {string} address - The Ethereum address
@@ -11,9 +93,7 @@ class ApiClient {
         try {
             const response = await fetch('/api/account/create', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: ApiClient.headers(),
                 body: JSON.stringify({ address })
             });
             
@@ -38,9 +118,7 @@ class ApiClient {
         try {
             const response = await fetch('/api/account/get', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: ApiClient.headers(),
                 body: JSON.stringify({ address })
             });
             
@@ -56,20 +134,72 @@ class ApiClient {
         }
     }
     
+    /**
+     * Set the balance, nonce and/or code of an account
+     * @param {string} address - The Ethereum address
+     * @param {Object} fields - The fields to set ({ balance, nonce, code }), omitted fields are unchanged
+     * @returns {Promise} The response promise
+     */
+    static async setAccount(address, fields) {
+        try {
+            const response = await fetch('/api/account/set', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, ...fields })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error setting account:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Self-destruct an account, deleting it along with its storage
+     * @param {string} address - The Ethereum address
+     * @param {Object} options - The options ({ beneficiary, eip6780, newContract })
+     * @returns {Promise} The response promise
+     */
+    static async selfDestruct(address, options) {
+        try {
+            const response = await fetch('/api/account/selfdestruct', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, ...options })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error self-destructing account:', error);
+            throw error;
+        }
+    }
+    
     /**
      * Update storage with key-value pairs and get updated trie
      * @param {string} address - The Ethereum address
      * @param {Object} storage - The key-value pairs object
+     * @param {string} fork - The fork the SSTORE gas is priced by (istanbul, berlin, london)
+     * @param {boolean} trace - Whether to record how the trie is restructured, key by key
      * @returns {Promise} The response promise
      */
-    static async updateStorage(address, storage) {
+    static async updateStorage(address, storage, fork, trace) {
         try {
             const response = await fetch('/api/storage/update', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({ address, storage })
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, storage, fork, trace })
             });
             
             if (!response.ok) {
@@ -84,6 +214,141 @@ class ApiClient {
         }
     }
     
+    /**
+     * Simulate nested calls writing storage, reverting the failing ones
+     * @param {string} address - The Ethereum address
+     * @param {Array} calls - The calls from the outermost one ([{ storage, revert }])
+     * @returns {Promise} The response promise
+     */
+    static async simulateCalls(address, calls) {
+        try {
+            const response = await fetch('/api/storage/simulate', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, calls })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error simulating calls:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Run a transaction writing transient storage (EIP-1153) slots
+     * @param {string} address - The Ethereum address
+     * @param {Object} storage - The transient key-value pairs object
+     * @returns {Promise} The response promise
+     */
+    static async setTransientStorage(address, storage) {
+        try {
+            const response = await fetch('/api/storage/transient', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, storage })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error setting transient storage:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Run a transaction of storage operations and get their gas report
+     * @param {string} address - The Ethereum address
+     * @param {Array} ops - The operations ([{ op, key, value }])
+     * @param {Array} accessList - The storage keys of the EIP-2930 access list
+     * @param {string} fork - The fork the gas is priced by (istanbul, berlin, london)
+     * @returns {Promise} The response promise
+     */
+    static async getStorageGas(address, ops, accessList, fork) {
+        try {
+            const response = await fetch('/api/storage/gas', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, ops, accessList, fork })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error getting storage gas:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Get a page of storage slots in the order of their hashed keys
+     * @param {string} address - The Ethereum address
+     * @param {string} start - The hashed key the page starts at (hex, optional)
+     * @param {number} limit - The maximum number of slots in the page
+     * @returns {Promise} The response promise
+     */
+    static async getStorageRange(address, start, limit) {
+        try {
+            const response = await fetch('/api/storage/range', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, start, limit })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error getting storage range:', error);
+            throw error;
+        }
+    }
+    
+    /**
+     * Prove a page of storage slots with edge proofs and verify it against the storage root
+     * @param {string} address - The Ethereum address
+     * @param {string} start - The hashed key the range starts at (hex, optional)
+     * @param {number} limit - The maximum number of slots in the range
+     * @param {boolean} tamper - Whether to alter the first value before verifying
+     * @returns {Promise} The response promise
+     */
+    static async getRangeProof(address, start, limit, tamper) {
+        try {
+            const response = await fetch('/api/proof/range', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, start, limit, tamper })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error getting range proof:', error);
+            throw error;
+        }
+    }
+    
     /**
      * Get a specific storage value
      * @param {string} address - The Ethereum address
@@ -94,9 +359,7 @@ class ApiClient {
         try {
             const response = await fetch('/api/storage/get', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: ApiClient.headers(),
                 body: JSON.stringify({ address, key })
             });
             
@@ -123,9 +386,7 @@ class ApiClient {
         try {
             const response = await fetch('/api/proof', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: ApiClient.headers(),
                 body: JSON.stringify({ address, key, root })
             });
             
@@ -140,4 +401,134 @@ class ApiClient {
             throw error;
         }
     }
+
+    /**
+     * Generate a fresh Merkle proof for a key and get its nodes
+     * @param {string} address - The Ethereum address
+     * @param {string} key - The storage key (hex)
+     * @param {string} root - The storage root to prove against (optional, current root by default)
+     * @returns {Promise} The response promise
+     */
+    static async generateProof(address, key, root) {
+        try {
+            const response = await fetch('/api/proof/generate', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, key, root })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error generating proof:', error);
+            throw error;
+        }
+    }
+
+    /**
+     * Get the node database layout of an account's storage trie
+     * @param {string} address - The Ethereum address
+     * @returns {Promise} The response promise
+     */
+    static async getNodeStorage(address) {
+        try {
+            const response = await fetch('/api/db/nodes', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address })
+            });
+            
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+            
+            return await response.json();
+        } catch (error) {
+            console.error('Error getting node storage:', error);
+            throw error;
+        }
+    }
+
+    /**
+     * List the committed versions of the session
+     * @param {string} address - The Ethereum address the changes are filtered by (optional)
+     * @returns {Promise} The response promise
+     */
+    static async listVersions(address) {
+        try {
+            const response = await fetch('/api/history/versions', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address })
+            });
+
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+
+            return await response.json();
+        } catch (error) {
+            console.error('Error listing versions:', error);
+            throw error;
+        }
+    }
+
+    /**
+     * Open an account's storage trie at a committed version, read-only
+     * @param {string} address - The Ethereum address
+     * @param {number} version - The version number
+     * @returns {Promise} The response promise
+     */
+    static async openVersion(address, version) {
+        try {
+            const response = await fetch('/api/history/open', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, version })
+            });
+
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+
+            return await response.json();
+        } catch (error) {
+            console.error('Error opening version:', error);
+            throw error;
+        }
+    }
+
+    /**
+     * Compare an account's storage trie at two committed versions
+     * @param {string} address - The Ethereum address
+     * @param {number} from - The older version (optional, the one before "to" by default, 0 for the empty state)
+     * @param {number} to - The newer version (optional, the latest by default)
+     * @returns {Promise} The response promise
+     */
+    static async diffVersions(address, from, to) {
+        try {
+            const response = await fetch('/api/trie/diff', {
+                method: 'POST',
+                headers: ApiClient.headers(),
+                body: JSON.stringify({ address, from, to })
+            });
+
+            if (!response.ok) {
+                const errorData = await response.json();
+                throw new Error(errorData.error || `HTTP error ${response.status}`);
+            }
+
+            return await response.json();
+        } catch (error) {
+            console.error('Error comparing versions:', error);
+            throw error;
+        }
+    }
 }
\ No newline at end of file
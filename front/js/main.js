@@ -11,7 +11,12 @@ document.addEventListener('DOMContentLoaded', () => {
     const addStorageBtn = document.getElementById('add-storage-btn');
     const storageList = document.getElementById('storage-list');
     const updateTrieBtn = document.getElementById('update-trie-btn');
+    const deletedResult = document.getElementById('deleted-result');
+    const updateForkSelect = document.getElementById('update-fork');
+    const updateGasResult = document.getElementById('update-gas-result');
     const rootHashElem = document.getElementById('root-hash');
+    const stateRootElem = document.getElementById('state-root');
+    const sessionIdElem = document.getElementById('session-id');
     const textViewBtn = document.getElementById('text-view-btn');
     const treeViewBtn = document.getElementById('tree-view-btn');
     const textView = document.getElementById('text-view');
@@ -32,14 +37,113 @@ document.addEventListener('DOMContentLoaded', () => {
     const proofKeyInput = document.getElementById('proof-key');
     const proofRootInput = document.getElementById('proof-root');
     const getProofBtn = document.getElementById('get-proof-btn');
+    const generateProofBtn = document.getElementById('generate-proof-btn');
     const useCurrentRootBtn = document.getElementById('use-current-root-btn');
     const proofRootHash = document.getElementById('proof-root-hash');
     const proofValue = document.getElementById('proof-value');
+    const proofExists = document.getElementById('proof-exists');
+    const proofStop = document.getElementById('proof-stop');
+    const proofNodes = document.getElementById('proof-nodes');
+
+    // Account field elements
+    const accountBalanceInput = document.getElementById('account-balance');
+    const accountNonceInput = document.getElementById('account-nonce');
+    const accountCodeInput = document.getElementById('account-code');
+    const setAccountBtn = document.getElementById('set-account-btn');
+    const accountNonceValue = document.getElementById('account-nonce-value');
+    const accountBalanceValue = document.getElementById('account-balance-value');
+    const accountCodeHash = document.getElementById('account-code-hash');
+    const accountCodeSize = document.getElementById('account-code-size');
+    const accountStorageRoot = document.getElementById('account-storage-root');
+    const selfDestructBeneficiaryInput = document.getElementById('selfdestruct-beneficiary');
+    const selfDestructBtn = document.getElementById('selfdestruct-btn');
+    const selfDestructEip6780 = document.getElementById('selfdestruct-eip6780');
+    const selfDestructNewContract = document.getElementById('selfdestruct-new-contract');
+
+    // Call simulation elements
+    const innerKeyInput = document.getElementById('inner-key');
+    const innerValueInput = document.getElementById('inner-value');
+    const addInnerBtn = document.getElementById('add-inner-btn');
+    const innerCallList = document.getElementById('inner-call-list');
+    const innerRevertCheckbox = document.getElementById('inner-revert');
+    const simulateBtn = document.getElementById('simulate-btn');
+    const rollbackResult = document.getElementById('rollback-result');
+
+    // Transient storage elements
+    const transientKeyInput = document.getElementById('transient-key');
+    const transientValueInput = document.getElementById('transient-value');
+    const addTransientBtn = document.getElementById('add-transient-btn');
+    const transientList = document.getElementById('transient-list');
+    const runTransientBtn = document.getElementById('run-transient-btn');
+    const transientResult = document.getElementById('transient-result');
+
+    // Gas report elements
+    const gasForkSelect = document.getElementById('gas-fork');
+    const gasOpSelect = document.getElementById('gas-op');
+    const gasKeyInput = document.getElementById('gas-key');
+    const gasValueInput = document.getElementById('gas-value');
+    const addGasOpBtn = document.getElementById('add-gas-op-btn');
+    const gasOpList = document.getElementById('gas-op-list');
+    const gasAccessListInput = document.getElementById('gas-access-list');
+    const runGasBtn = document.getElementById('run-gas-btn');
+    const gasReportBody = document.getElementById('gas-report-body');
+    const gasAccessListCost = document.getElementById('gas-access-list-cost');
+    const gasTotal = document.getElementById('gas-total');
+    const gasRefund = document.getElementById('gas-refund');
+    const gasUsed = document.getElementById('gas-used');
+    const gasRefundCapped = document.getElementById('gas-refund-capped');
+    const gasNet = document.getElementById('gas-net');
+
+    // Storage range elements
+    const rangeStartInput = document.getElementById('range-start');
+    const rangeLimitInput = document.getElementById('range-limit');
+    const rangeFetchBtn = document.getElementById('range-fetch-btn');
+    const rangeNextBtn = document.getElementById('range-next-btn');
+    const rangeBody = document.getElementById('range-body');
+    const rangeNextKey = document.getElementById('range-next-key');
+    const rangeProveBtn = document.getElementById('range-prove-btn');
+    const rangeTamperCheckbox = document.getElementById('range-tamper');
+    const rangeProofResult = document.getElementById('range-proof-result');
+
+    // Node storage elements
+    const nodeScheme = document.getElementById('node-scheme');
+    const nodeDiskCount = document.getElementById('node-disk-count');
+    const nodeDiskSize = document.getElementById('node-disk-size');
+    const nodeDirtySize = document.getElementById('node-dirty-size');
+    const nodeHashKeyHeader = document.getElementById('node-hash-key-header');
+    const nodePathKeyHeader = document.getElementById('node-path-key-header');
+    const nodeStorageBody = document.getElementById('node-storage-body');
+
+    // History elements
+    const refreshHistoryBtn = document.getElementById('refresh-history-btn');
+    const historyBody = document.getElementById('history-body');
+    const historyBanner = document.getElementById('history-banner');
+    const historyVersion = document.getElementById('history-version');
+    const backToLatestBtn = document.getElementById('back-to-latest-btn');
+    const historyDiffFrom = document.getElementById('history-diff-from');
+    const diffResult = document.getElementById('diff-result');
+
+    // Insertion trace elements
+    const updateTraceCheckbox = document.getElementById('update-trace');
+    const tracePrevBtn = document.getElementById('trace-prev-btn');
+    const tracePlayBtn = document.getElementById('trace-play-btn');
+    const traceNextBtn = document.getElementById('trace-next-btn');
+    const traceCloseBtn = document.getElementById('trace-close-btn');
+    const traceStatus = document.getElementById('trace-status');
+    const traceEvents = document.getElementById('trace-events');
 
     // State
     let accounts = []; // List of all created/loaded accounts
     let selectedAccount = null; // Currently selected account
     let pendingStorage = {}; // { address: { key: value, ... } }
+    let innerStorage = {}; // { address: { key: value, ... } } written by the simulated inner call
+    let transientStorage = {}; // { address: { key: value, ... } } written to transient storage
+    let gasOps = {}; // { address: [{ op, key, value }, ...] } priced by the gas report
+    let rangeCursor = null; // Hashed key the next storage range page starts at
+    let viewedVersion = null; // Version shown read-only in the trie view, null for the latest state
+    let insertTrace = null; // { frames, finalTrie } of the last traced update
+    let traceFrame = -1; // Frame of the insertion trace on display, -1 if none
+    let traceTimer = null; // Timer playing the insertion trace
     let currentView = 'text';
 
     // Initialize TrieVisualizer early
@@ -80,7 +184,19 @@ document.addEventListener('DOMContentLoaded', () => {
         selectedAccount = addr;
         renderAccountList();
         renderStorageList();
+        renderInnerCallList();
+        rollbackResult.innerHTML = '<div class="empty-message">No simulation run yet.</div>';
+        renderTransientList();
+        transientResult.innerHTML = '<div class="empty-message">No transaction run yet.</div>';
+        renderGasOpList();
+        renderGasReport(null);
+        renderStorageRange(null);
+        renderRangeProof(null);
         clearTrieVisualization();
+        clearNodeStorage();
+        clearVersions();
+        clearInsertTrace();
+        renderAccountFields(null);
         if (addr) {
             fetchAndShowTrie(addr);
         }
@@ -286,20 +402,645 @@ document.addEventListener('DOMContentLoaded', () => {
     function clearTrieVisualization() {
         trieVisualizer.updateVisualization({});
     }
+    function renderInnerCallList() {
+        innerCallList.innerHTML = '';
+        const items = (selectedAccount && innerStorage[selectedAccount]) || {};
+        const keys = Object.keys(items);
+        if (keys.length === 0) {
+            innerCallList.innerHTML = '<div class="empty-message">No inner call writes.</div>';
+            return;
+        }
+        keys.forEach(key => {
+            const item = document.createElement('div');
+            item.className = 'storage-item';
+            const keyElem = document.createElement('div');
+            keyElem.className = 'storage-key';
+            keyElem.textContent = key;
+            const valueElem = document.createElement('div');
+            valueElem.className = 'storage-value';
+            valueElem.textContent = items[key];
+            const removeBtn = document.createElement('button');
+            removeBtn.textContent = 'Remove';
+            removeBtn.onclick = () => {
+                delete innerStorage[selectedAccount][key];
+                renderInnerCallList();
+            };
+            item.appendChild(keyElem);
+            item.appendChild(valueElem);
+            item.appendChild(removeBtn);
+            innerCallList.appendChild(item);
+        });
+    }
+    function renderTransientList() {
+        transientList.innerHTML = '';
+        const items = (selectedAccount && transientStorage[selectedAccount]) || {};
+        const keys = Object.keys(items);
+        if (keys.length === 0) {
+            transientList.innerHTML = '<div class="empty-message">No transient writes.</div>';
+            return;
+        }
+        keys.forEach(key => {
+            const item = document.createElement('div');
+            item.className = 'storage-item';
+            const keyElem = document.createElement('div');
+            keyElem.className = 'storage-key';
+            keyElem.textContent = key;
+            const valueElem = document.createElement('div');
+            valueElem.className = 'storage-value';
+            valueElem.textContent = items[key];
+            const removeBtn = document.createElement('button');
+            removeBtn.textContent = 'Remove';
+            removeBtn.onclick = () => {
+                delete transientStorage[selectedAccount][key];
+                renderTransientList();
+            };
+            item.appendChild(keyElem);
+            item.appendChild(valueElem);
+            item.appendChild(removeBtn);
+            transientList.appendChild(item);
+        });
+    }
+    function renderTransientResult(data) {
+        transientResult.innerHTML = '';
+        (data.transient || []).forEach(t => {
+            const div = document.createElement('div');
+            div.className = 'transient-item';
+            div.textContent = `${t.key}: TLOAD in tx ${t.during}, after tx ${t.afterTx}`;
+            transientResult.appendChild(div);
+        });
+        const storageRoot = data.account ? data.account.storageRoot : '-';
+        const rows = [
+            ['Storage root', data.storageRootBefore, storageRoot],
+            ['State root', data.stateRootBefore, data.stateRoot]
+        ];
+        rows.forEach(([label, before, after]) => {
+            const div = document.createElement('div');
+            div.textContent = `${label}: ${before === after ? 'unchanged' : before + ' \u2192 ' + after}`;
+            transientResult.appendChild(div);
+        });
+    }
+    function renderGasOpList() {
+        gasOpList.innerHTML = '';
+        const ops = (selectedAccount && gasOps[selectedAccount]) || [];
+        if (ops.length === 0) {
+            gasOpList.innerHTML = '<div class="empty-message">No operations.</div>';
+            return;
+        }
+        ops.forEach((op, i) => {
+            const item = document.createElement('div');
+            item.className = 'storage-item';
+            const keyElem = document.createElement('div');
+            keyElem.className = 'storage-key';
+            keyElem.textContent = `${op.op.toUpperCase()} ${op.key}`;
+            const valueElem = document.createElement('div');
+            valueElem.className = 'storage-value';
+            valueElem.textContent = op.op === 'sstore' ? op.value : '';
+            const removeBtn = document.createElement('button');
+            removeBtn.textContent = 'Remove';
+            removeBtn.onclick = () => {
+                gasOps[selectedAccount].splice(i, 1);
+                renderGasOpList();
+            };
+            item.appendChild(keyElem);
+            item.appendChild(valueElem);
+            item.appendChild(removeBtn);
+            gasOpList.appendChild(item);
+        });
+    }
+    function renderGasReport(report) {
+        gasReportBody.innerHTML = '';
+        if (!report || !report.ops || report.ops.length === 0) {
+            gasReportBody.innerHTML = '<tr><td colspan="6" class="empty-message">No transaction run yet.</td></tr>';
+            gasAccessListCost.textContent = '-';
+            gasTotal.textContent = '-';
+            gasRefund.textContent = '-';
+            gasUsed.textContent = '-';
+            gasRefundCapped.textContent = '-';
+            gasNet.textContent = '-';
+            return;
+        }
+        report.ops.forEach(op => {
+            const row = document.createElement('tr');
+            const cells = [
+                op.op,
+                op.op === 'SSTORE' ? `${op.key} = ${op.value}` : op.key,
+                op.case || '-',
+                op.access || '-',
+                op.gas,
+                op.refund
+            ];
+            cells.forEach(text => {
+                const td = document.createElement('td');
+                td.textContent = text;
+                row.appendChild(td);
+            });
+            if (op.access === 'cold') {
+                row.classList.add('cold-access');
+            }
+            gasReportBody.appendChild(row);
+        });
+        gasAccessListCost.textContent = report.accessListGas;
+        gasTotal.textContent = report.totalGas;
+        gasRefund.textContent = report.refund;
+        gasUsed.textContent = report.summary.gasUsed;
+        gasRefundCapped.textContent = report.summary.refund;
+        gasNet.textContent = report.summary.netGas;
+    }
+    function renderRollback(rolledBack) {
+        rollbackResult.innerHTML = '';
+        if (!rolledBack || rolledBack.length === 0) {
+            rollbackResult.innerHTML = '<div class="empty-message">No slots were rolled back.</div>';
+            return;
+        }
+        rolledBack.forEach(r => {
+            const div = document.createElement('div');
+            div.className = 'rollback-item';
+            div.textContent = `call #${r.call} ${r.key}: ${r.discarded} \u2192 ${r.restored}`;
+            rollbackResult.appendChild(div);
+        });
+    }
+    function renderDeleted(deleted) {
+        deletedResult.innerHTML = '';
+        if (!deleted || deleted.length === 0) {
+            deletedResult.innerHTML = '<div class="empty-message">No slots were deleted.</div>';
+            return;
+        }
+        deleted.forEach(key => {
+            const div = document.createElement('div');
+            div.className = 'deleted-item';
+            div.textContent = `deleted ${key}`;
+            deletedResult.appendChild(div);
+        });
+    }
+    function renderUpdateGas(report) {
+        updateGasResult.innerHTML = '';
+        if (!report || !report.ops || report.ops.length === 0) {
+            updateGasResult.innerHTML = '<div class="empty-message">The gas of every SSTORE is reported after the update.</div>';
+            return;
+        }
+        report.ops.forEach(op => {
+            const div = document.createElement('div');
+            div.className = 'gas-item';
+            const access = op.access ? `, ${op.access}` : '';
+            div.textContent = `${op.key} = ${op.value}: ${op.case}${access}, gas ${op.gas}, refund ${op.refund}`;
+            updateGasResult.appendChild(div);
+        });
+        const summary = report.summary;
+        const div = document.createElement('div');
+        div.className = 'gas-item gas-item-summary';
+        div.textContent = `${report.fork}: ${summary.gasUsed} gas used, ${summary.refund} of ${summary.refundCounter} refunded, ${summary.netGas} net`;
+        updateGasResult.appendChild(div);
+    }
+    function renderStorageRange(data) {
+        rangeBody.innerHTML = '';
+        rangeCursor = data ? data.nextKey : null;
+        rangeNextKey.textContent = rangeCursor || '-';
+        rangeNextBtn.disabled = !rangeCursor;
+        if (!data) {
+            rangeBody.innerHTML = '<tr><td colspan="3" class="empty-message">No range fetched yet.</td></tr>';
+            return;
+        }
+        const hashes = Object.keys(data.storage || {}).sort();
+        if (hashes.length === 0) {
+            rangeBody.innerHTML = '<tr><td colspan="3" class="empty-message">No slots in this range.</td></tr>';
+            return;
+        }
+        hashes.forEach(hash => {
+            const entry = data.storage[hash];
+            const row = document.createElement('tr');
+            [hash, entry.key || 'unknown', entry.value].forEach(text => {
+                const td = document.createElement('td');
+                td.textContent = text;
+                row.appendChild(td);
+            });
+            if (!entry.key) {
+                row.classList.add('missing-preimage');
+            }
+            rangeBody.appendChild(row);
+        });
+    }
+    function renderRangeProof(data) {
+        rangeProofResult.innerHTML = '';
+        if (!data) {
+            rangeProofResult.innerHTML = '<div class="empty-message">No range proven yet.</div>';
+            return;
+        }
+        const lines = [
+            `Storage root: ${data.root}`,
+            `Slots: ${data.keys ? data.keys.length : 0}, proof nodes: ${data.proof.length}` +
+                (data.proof.length === 0 ? ' (whole storage, verified by rebuilding the trie)' : ''),
+            data.verified
+                ? `Verified, ${data.more ? 'more slots follow' : 'no more slots'}`
+                : `Rejected: ${data.reason}`
+        ];
+        lines.forEach((text, i) => {
+            const div = document.createElement('div');
+            div.className = 'range-proof-item';
+            if (i === lines.length - 1) {
+                div.classList.add(data.verified ? 'range-proof-valid' : 'range-proof-invalid');
+            }
+            div.textContent = text;
+            rangeProofResult.appendChild(div);
+        });
+    }
+    function readRangeLimit() {
+        const limitText = rangeLimitInput.value.trim();
+        const limit = limitText ? parseInt(limitText, 10) : 0;
+        if (isNaN(limit) || limit < 0) {
+            setError('Limit must be a positive number.');
+            return null;
+        }
+        return limit;
+    }
+    async function fetchStorageRange(start) {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const limit = readRangeLimit();
+        if (limit === null) {
+            return;
+        }
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.getStorageRange(selectedAccount, start, limit);
+            renderStorageRange(data);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to get the storage range');
+            setLoading(false);
+        }
+    }
+    function describeDivergence(divergence, stopPath) {
+        const at = stopPath ? `path ${stopPath}` : 'the root';
+        switch (divergence.kind) {
+            case 'emptyTrie':
+                return 'the trie is empty';
+            case 'shortNode':
+                return `short node at ${at}, key ${divergence.nodeKey} doesn't match ${divergence.keyRest}`;
+            case 'emptySlot':
+                return `branch node at ${at}, slot ${divergence.slot.toUpperCase()} is empty`;
+            default:
+                return divergence.kind;
+        }
+    }
+    function renderProofPath(result) {
+        proofNodes.innerHTML = '';
+        if (!result) {
+            proofExists.textContent = '-';
+            proofStop.textContent = '-';
+            return;
+        }
+        proofExists.textContent = result.exists ? 'yes (inclusion proof)' : 'no (exclusion proof)';
+        proofStop.textContent = result.divergence
+            ? describeDivergence(result.divergence, result.stopPath)
+            : `leaf at path ${result.stopPath || 'root'}`;
+        result.proof.forEach((n, i) => {
+            const details = document.createElement('details');
+            details.className = 'proof-node-item';
+            const summary = document.createElement('summary');
+            summary.textContent = `#${i} ${n.decoded.type} at path ${n.path || 'root'}: ${n.hash} (${(n.rlp.length - 2) / 2} bytes)`;
+            const body = document.createElement('pre');
+            body.textContent = `RLP: ${n.rlp}\n` + JSON.stringify(n.decoded, null, 2);
+            details.appendChild(summary);
+            details.appendChild(body);
+            proofNodes.appendChild(details);
+        });
+    }
+    function renderAccountFields(account) {
+        accountNonceValue.textContent = account ? account.nonce : '-';
+        accountBalanceValue.textContent = account ? account.balance : '-';
+        accountCodeHash.textContent = account ? account.codeHash : '-';
+        accountCodeSize.textContent = account ? account.codeSize + ' bytes' : '-';
+        accountStorageRoot.textContent = account ? account.storageRoot : '-';
+    }
+    function clearNodeStorage() {
+        nodeScheme.textContent = '-';
+        nodeDiskCount.textContent = '-';
+        nodeDiskSize.textContent = '-';
+        nodeDirtySize.textContent = '-';
+        nodeStorageBody.innerHTML = '<tr><td colspan="4" class="empty-message">Select an account first.</td></tr>';
+    }
+    function renderNodeStorage(data) {
+        nodeScheme.textContent = data.scheme;
+        nodeDiskCount.textContent = data.disk.trieNodes;
+        nodeDiskSize.textContent = data.disk.size;
+        nodeDirtySize.textContent = data.disk.dirty;
+        // Highlight the key column of the scheme in use
+        nodeHashKeyHeader.classList.toggle('active-scheme', data.scheme === 'hash');
+        nodePathKeyHeader.classList.toggle('active-scheme', data.scheme === 'path');
+
+        nodeStorageBody.innerHTML = '';
+        const nodes = data.nodes || [];
+        if (nodes.length === 0) {
+            nodeStorageBody.innerHTML = '<tr><td colspan="4" class="empty-message">The storage trie is empty.</td></tr>';
+            return;
+        }
+        nodes.forEach(n => {
+            const tr = document.createElement('tr');
+            const cells = [n.path || '(root)', n.size + ' B', n.hashKey, n.pathKey];
+            cells.forEach((text, i) => {
+                const td = document.createElement('td');
+                td.textContent = text;
+                if ((i === 2 && data.scheme === 'hash') || (i === 3 && data.scheme === 'path')) {
+                    td.className = 'active-scheme';
+                }
+                tr.appendChild(td);
+            });
+            nodeStorageBody.appendChild(tr);
+        });
+    }
+    async function refreshNodeStorage(addr) {
+        try {
+            const data = await ApiClient.getNodeStorage(addr);
+            renderNodeStorage(data);
+        } catch (e) {
+            clearNodeStorage();
+        }
+    }
+    function clearVersions() {
+        viewedVersion = null;
+        historyBanner.style.display = 'none';
+        renderDiff(null);
+        historyBody.innerHTML = '<tr><td colspan="5" class="empty-message">Select an account first.</td></tr>';
+    }
+    function renderVersions(data) {
+        historyBody.innerHTML = '';
+        const versions = data.versions || [];
+        if (versions.length === 0) {
+            historyBody.innerHTML = '<tr><td colspan="5" class="empty-message">No version committed yet.</td></tr>';
+            return;
+        }
+        // Newest first
+        versions.slice().reverse().forEach(v => {
+            const tr = document.createElement('tr');
+            if (v.number === viewedVersion) {
+                tr.className = 'viewing';
+            } else if (!v.available) {
+                tr.className = 'unavailable';
+            }
+            const changes = (v.changes || []).map(ch => `${ch.key}: ${ch.prev} → ${ch.value}`);
+            const cells = [
+                v.number,
+                v.root,
+                new Date(v.timestamp * 1000).toLocaleTimeString(),
+                changes.length ? changes.join('\n') : '(none for this account)'
+            ];
+            cells.forEach(text => {
+                const td = document.createElement('td');
+                td.textContent = text;
+                td.style.whiteSpace = 'pre-wrap';
+                tr.appendChild(td);
+            });
+            const td = document.createElement('td');
+            if (v.available) {
+                const viewBtn = document.createElement('button');
+                viewBtn.textContent = 'View';
+                viewBtn.onclick = () => showVersion(selectedAccount, v.number);
+                td.appendChild(viewBtn);
+                const diffBtn = document.createElement('button');
+                diffBtn.textContent = 'Diff';
+                diffBtn.title = 'Compare with the previous version';
+                diffBtn.onclick = () => showDiff(selectedAccount, v.number);
+                td.appendChild(diffBtn);
+            } else {
+                td.textContent = 'pruned';
+                td.title = 'The nodes of this version are no longer in the node database';
+            }
+            tr.appendChild(td);
+            historyBody.appendChild(tr);
+        });
+    }
+    async function refreshVersions(addr) {
+        try {
+            const data = await ApiClient.listVersions(addr);
+            renderVersions(data);
+        } catch (e) {
+            clearVersions();
+        }
+    }
+    function renderDiff(diff) {
+        if (!diff) {
+            diffResult.innerHTML = '<div class="empty-message">No diff shown yet.</div>';
+            return;
+        }
+        diffResult.innerHTML = '';
+        const summary = document.createElement('div');
+        summary.textContent = `Version ${diff.from} → ${diff.to}: ${diff.added.length} added, ${diff.removed.length} removed, ` +
+            `${diff.modified.length} modified slots; ${diff.created.length} nodes created, ${diff.orphaned.length} orphaned`;
+        diffResult.appendChild(summary);
+        const leaves = [
+            ...diff.added.map(l => ['+', l]),
+            ...diff.removed.map(l => ['-', l]),
+            ...diff.modified.map(l => ['~', l])
+        ];
+        leaves.forEach(([kind, l]) => {
+            const item = document.createElement('div');
+            item.className = 'diff-leaf diff-leaf-' + { '+': 'added', '-': 'removed', '~': 'modified' }[kind];
+            item.textContent = `${kind} ${l.originalKey || l.key}: ${l.prev || '-'} → ${l.value || '-'}`;
+            item.title = 'Hashed key: ' + l.key;
+            diffResult.appendChild(item);
+        });
+        [['Created', diff.created], ['Orphaned', diff.orphaned]].forEach(([label, nodes]) => {
+            const item = document.createElement('div');
+            item.className = 'diff-nodes';
+            item.textContent = `${label}: ` + (nodes.length ? nodes.map(n => n.path || '(root)').join(', ') : '-');
+            diffResult.appendChild(item);
+        });
+    }
+    async function showVersion(addr, number) {
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.openVersion(addr, number);
+            viewedVersion = data.version;
+            historyVersion.textContent = data.version;
+            historyDiffFrom.textContent = '';
+            historyBanner.style.display = '';
+            renderAccountFields(data.account);
+            updateTrieVisualization(data.trie);
+            rootHashElem.textContent = data.trie.rootHash || '-';
+            stateRootElem.textContent = data.stateRoot || '-';
+            await refreshVersions(addr);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to open version');
+            setLoading(false);
+        }
+    }
+    async function showDiff(addr, number) {
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.diffVersions(addr, number - 1, number);
+            viewedVersion = data.version;
+            historyVersion.textContent = data.version;
+            historyDiffFrom.textContent = `, compared with version ${data.diff.from}`;
+            historyBanner.style.display = '';
+            renderAccountFields(data.account);
+            updateTrieVisualization(data.trie);
+            trieVisualizer.setDiffHighlight(data.diff);
+            rootHashElem.textContent = data.trie.rootHash || '-';
+            stateRootElem.textContent = data.stateRoot || '-';
+            renderDiff(data.diff);
+            await refreshVersions(addr);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to compare versions');
+            setLoading(false);
+        }
+    }
+    function describeTraceEvent(ev) {
+        const at = ev.path || '(root)';
+        switch (ev.kind) {
+            case 'resolve':
+                return `Load the node at ${at} from the database`;
+            case 'descend':
+                return `The key covers the whole key ${ev.nodeKey} of the short node at ${at}: descend into its child`;
+            case 'split':
+                return `The key diverges from the key ${ev.nodeKey} of the short node at ${at} after ${ev.matchLen} nibbles: split the short node`;
+            case 'create-branch':
+                return `Create a branch node at ${at}, where the keys diverge`;
+            case 'move':
+                return `Move the rest of the split short node below the branch, to ${at}` + (ev.nodeKey ? ` with the key ${ev.nodeKey}` : '');
+            case 'new-leaf':
+                return `Create a leaf at ${at} holding the value, with the rest of the key ${ev.nodeKey}`;
+            case 'extension':
+                return `Put an extension node at ${at} holding the shared prefix ${ev.nodeKey} above the branch`;
+            case 'update-value':
+                return 'Replace the value of the existing leaf';
+            case 'copy-branch':
+                return `Copy the branch node at ${at} (copy-on-write) and replace its child in slot ${ev.index.toString(16)}`;
+            case 'delete-leaf':
+                return `Remove the leaf at ${at}`;
+            case 'merge':
+                return `Merge the short node at ${at} with the short node left below it into the key ${ev.nodeKey}`;
+            case 'reduce-branch':
+                return `The branch node at ${at} has a single child left in slot ${ev.index.toString(16)}: reduce it to a short node`;
+            default:
+                return `${ev.kind} at ${at}`;
+        }
+    }
+    function buildTraceFrames(trace) {
+        // Every step starts with the trie before the write; the decisions are
+        // shown on the trie after it, except the removals, whose nodes are
+        // gone by then
+        const frames = [];
+        let before = trace.initial;
+        trace.steps.forEach((step, i) => {
+            const slot = step.slot ? `${step.slot} = ${step.value}` : `hashed key ${step.key}`;
+            frames.push({
+                step: i,
+                root: before,
+                path: step.key,
+                label: `Step ${i + 1}/${trace.steps.length}: ${step.delete ? 'delete' : 'write'} ${slot}`,
+                header: true
+            });
+            step.events.forEach(ev => {
+                const removal = ['delete-leaf', 'merge', 'reduce-branch'].includes(ev.kind);
+                frames.push({
+                    step: i,
+                    root: removal ? before : step.root,
+                    path: ev.path,
+                    label: describeTraceEvent(ev)
+                });
+            });
+            before = step.root;
+        });
+        return frames;
+    }
+    function stopTrace() {
+        if (traceTimer) {
+            clearInterval(traceTimer);
+            traceTimer = null;
+        }
+        tracePlayBtn.textContent = 'Play';
+    }
+    function clearInsertTrace() {
+        stopTrace();
+        insertTrace = null;
+        traceFrame = -1;
+        traceEvents.innerHTML = '';
+        traceStatus.innerHTML = '<div class="empty-message">Check "Trace the insertion step by step" and update the trie.</div>';
+        [tracePrevBtn, tracePlayBtn, traceNextBtn, traceCloseBtn].forEach(btn => btn.disabled = true);
+    }
+    function setInsertTrace(trace, finalTrie) {
+        clearInsertTrace();
+        const frames = buildTraceFrames(trace);
+        if (frames.length === 0) {
+            traceStatus.innerHTML = '<div class="empty-message">The update didn\'t change the trie.</div>';
+            return;
+        }
+        insertTrace = { frames, finalTrie };
+        frames.forEach((frame, i) => {
+            const li = document.createElement('li');
+            li.textContent = frame.label;
+            if (frame.header) {
+                li.className = 'trace-step';
+            }
+            li.onclick = () => {
+                stopTrace();
+                showTraceFrame(i);
+            };
+            traceEvents.appendChild(li);
+        });
+        [tracePlayBtn, traceNextBtn, traceCloseBtn].forEach(btn => btn.disabled = false);
+    }
+    function showTraceFrame(index) {
+        const frames = insertTrace.frames;
+        traceFrame = index;
+        const frame = frames[index];
+        switchView('tree');
+        trieVisualizer.showTraceFrame(frame.root, { path: frame.path, label: frame.label }, insertTrace.finalTrie.originalKVPairs);
+        traceStatus.innerHTML = '';
+        const counter = document.createElement('div');
+        counter.textContent = `Frame ${index + 1}/${frames.length}`;
+        const label = document.createElement('div');
+        label.textContent = frame.label;
+        traceStatus.appendChild(counter);
+        traceStatus.appendChild(label);
+        Array.from(traceEvents.children).forEach((li, i) => li.classList.toggle('current', i === index));
+        traceEvents.children[index].scrollIntoView({ block: 'nearest' });
+        tracePrevBtn.disabled = index === 0;
+        traceNextBtn.disabled = index === frames.length - 1;
+    }
+    function playTrace() {
+        if (traceFrame >= insertTrace.frames.length - 1) {
+            traceFrame = -1;
+        }
+        tracePlayBtn.textContent = 'Pause';
+        showTraceFrame(traceFrame + 1);
+        traceTimer = setInterval(() => {
+            if (traceFrame >= insertTrace.frames.length - 1) {
+                stopTrace();
+                return;
+            }
+            showTraceFrame(traceFrame + 1);
+        }, 1500);
+    }
     async function fetchAndShowTrie(addr) {
         try {
             setLoading(true);
             setError('');
+            viewedVersion = null;
+            historyBanner.style.display = 'none';
             const data = await ApiClient.getAccount(addr);
+            renderAccountFields(data && data.account);
             if (data && data.trie) {
                 updateTrieVisualization(data.trie);
                 if (data.trie.rootHash) {
                     rootHashElem.textContent = data.trie.rootHash;
                 }
+                if (data.stateRoot) {
+                    stateRootElem.textContent = data.stateRoot;
+                }
             } else {
                 setError('No trie data in response.');
                 clearTrieVisualization();
             }
+            await refreshNodeStorage(addr);
+            await refreshVersions(addr);
             setLoading(false);
         } catch (e) {
             setError(e.message || 'Failed to fetch trie data');
@@ -376,12 +1117,19 @@ document.addEventListener('DOMContentLoaded', () => {
             setLoading(true);
             setError('');
             // Call the consolidated storage update endpoint
-            const data = await ApiClient.updateStorage(selectedAccount, items);
+            clearInsertTrace();
+            const data = await ApiClient.updateStorage(selectedAccount, items, updateForkSelect.value, updateTraceCheckbox.checked);
+            renderAccountFields(data && data.account);
+            renderDeleted(data && data.deleted);
+            renderUpdateGas(data && data.gasReport);
             if (data && data.trie) {
                 updateTrieVisualization(data.trie);
                 if (data.trie.rootHash) {
                     rootHashElem.textContent = data.trie.rootHash;
                 }
+                if (data.stateRoot) {
+                    stateRootElem.textContent = data.stateRoot;
+                }
             } else {
                 setError('No trie data in response.');
                 clearTrieVisualization();
@@ -389,6 +1137,16 @@ document.addEventListener('DOMContentLoaded', () => {
             // Clear pending storage for this account after successful update
             pendingStorage[selectedAccount] = {};
             renderStorageList();
+            viewedVersion = null;
+            historyBanner.style.display = 'none';
+            await refreshNodeStorage(selectedAccount);
+            await refreshVersions(selectedAccount);
+            if (data && data.trace) {
+                setInsertTrace(data.trace, data.trie);
+                if (insertTrace) {
+                    playTrace();
+                }
+            }
             setLoading(false);
         } catch (e) {
             setError(e.message || 'Failed to update storage');
@@ -396,6 +1154,323 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     };
     
+    addInnerBtn.onclick = () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const key = innerKeyInput.value.trim();
+        const value = innerValueInput.value.trim();
+        if (!/^0x[0-9a-fA-F]+$/.test(key) || !/^0x[0-9a-fA-F]+$/.test(value)) {
+            setError('Both key and value must be valid hex strings (0x...)');
+            return;
+        }
+        if (!innerStorage[selectedAccount]) {
+            innerStorage[selectedAccount] = {};
+        }
+        innerStorage[selectedAccount][key] = value;
+        renderInnerCallList();
+        innerKeyInput.value = '';
+        innerValueInput.value = '';
+        setError('');
+    };
+
+    simulateBtn.onclick = async () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const outer = pendingStorage[selectedAccount] || {};
+        const inner = innerStorage[selectedAccount] || {};
+        if (Object.keys(outer).length === 0 && Object.keys(inner).length === 0) {
+            setError('Please add some storage items for the outer or the inner call.');
+            return;
+        }
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.simulateCalls(selectedAccount, [
+                { storage: outer, revert: false },
+                { storage: inner, revert: innerRevertCheckbox.checked }
+            ]);
+            if (data && data.trie) {
+                updateTrieVisualization(data.trie);
+                if (data.trie.rootHash) {
+                    rootHashElem.textContent = data.trie.rootHash;
+                }
+            }
+            if (data && data.stateRoot) {
+                stateRootElem.textContent = data.stateRoot;
+            }
+            renderAccountFields(data && data.account);
+            renderRollback(data && data.rolledBack);
+            pendingStorage[selectedAccount] = {};
+            innerStorage[selectedAccount] = {};
+            renderStorageList();
+            renderInnerCallList();
+            await refreshNodeStorage(selectedAccount);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to simulate calls');
+            setLoading(false);
+        }
+    };
+
+    addTransientBtn.onclick = () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const key = transientKeyInput.value.trim();
+        const value = transientValueInput.value.trim();
+        if (!/^0x[0-9a-fA-F]+$/.test(key) || !/^0x[0-9a-fA-F]+$/.test(value)) {
+            setError('Both key and value must be valid hex strings (0x...)');
+            return;
+        }
+        if (!transientStorage[selectedAccount]) {
+            transientStorage[selectedAccount] = {};
+        }
+        transientStorage[selectedAccount][key] = value;
+        renderTransientList();
+        transientKeyInput.value = '';
+        transientValueInput.value = '';
+        setError('');
+    };
+
+    runTransientBtn.onclick = async () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const items = transientStorage[selectedAccount] || {};
+        if (Object.keys(items).length === 0) {
+            setError('Please add some transient storage items.');
+            return;
+        }
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.setTransientStorage(selectedAccount, items);
+            if (data && data.trie) {
+                updateTrieVisualization(data.trie);
+                if (data.trie.rootHash) {
+                    rootHashElem.textContent = data.trie.rootHash;
+                }
+            }
+            if (data && data.stateRoot) {
+                stateRootElem.textContent = data.stateRoot;
+            }
+            renderAccountFields(data && data.account);
+            renderTransientResult(data || {});
+            transientStorage[selectedAccount] = {};
+            renderTransientList();
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to run transient storage transaction');
+            setLoading(false);
+        }
+    };
+
+    addGasOpBtn.onclick = () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const op = gasOpSelect.value;
+        const key = gasKeyInput.value.trim();
+        const value = gasValueInput.value.trim();
+        if (!/^0x[0-9a-fA-F]+$/.test(key) || (op === 'sstore' && !/^0x[0-9a-fA-F]+$/.test(value))) {
+            setError('Key and, for SSTORE, value must be valid hex strings (0x...)');
+            return;
+        }
+        if (!gasOps[selectedAccount]) {
+            gasOps[selectedAccount] = [];
+        }
+        gasOps[selectedAccount].push(op === 'sstore' ? { op, key, value } : { op, key });
+        renderGasOpList();
+        gasKeyInput.value = '';
+        gasValueInput.value = '';
+        setError('');
+    };
+
+    runGasBtn.onclick = async () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const ops = gasOps[selectedAccount] || [];
+        if (ops.length === 0) {
+            setError('Please add some operations.');
+            return;
+        }
+        const accessList = gasAccessListInput.value.split(',').map(k => k.trim()).filter(k => k);
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.getStorageGas(selectedAccount, ops, accessList, gasForkSelect.value);
+            if (data && data.trie) {
+                updateTrieVisualization(data.trie);
+                if (data.trie.rootHash) {
+                    rootHashElem.textContent = data.trie.rootHash;
+                }
+            }
+            if (data && data.stateRoot) {
+                stateRootElem.textContent = data.stateRoot;
+            }
+            renderAccountFields(data && data.account);
+            renderGasReport(data && data.gasReport);
+            gasOps[selectedAccount] = [];
+            renderGasOpList();
+            await refreshNodeStorage(selectedAccount);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to run the gas report');
+            setLoading(false);
+        }
+    };
+
+    rangeFetchBtn.onclick = () => fetchStorageRange(rangeStartInput.value.trim());
+
+    rangeNextBtn.onclick = () => {
+        if (rangeCursor) {
+            rangeStartInput.value = rangeCursor;
+            fetchStorageRange(rangeCursor);
+        }
+    };
+
+    rangeProveBtn.onclick = async () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const limit = readRangeLimit();
+        if (limit === null) {
+            return;
+        }
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.getRangeProof(selectedAccount, rangeStartInput.value.trim(), limit, rangeTamperCheckbox.checked);
+            renderRangeProof(data);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to prove the storage range');
+            setLoading(false);
+        }
+    };
+
+    setAccountBtn.onclick = async () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const fields = {};
+        const balance = accountBalanceInput.value.trim();
+        const nonce = accountNonceInput.value.trim();
+        const code = accountCodeInput.value.trim();
+        if (balance) fields.balance = balance;
+        if (nonce) fields.nonce = nonce;
+        if (code) {
+            if (!/^0x([0-9a-fA-F]{2})*$/.test(code)) {
+                setError('Code must be a valid hex string with an even number of digits (0x...)');
+                return;
+            }
+            fields.code = code;
+        }
+        if (Object.keys(fields).length === 0) {
+            setError('Please enter a balance, nonce or code.');
+            return;
+        }
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.setAccount(selectedAccount, fields);
+            renderAccountFields(data && data.account);
+            if (data && data.stateRoot) {
+                stateRootElem.textContent = data.stateRoot;
+            }
+            accountBalanceInput.value = '';
+            accountNonceInput.value = '';
+            accountCodeInput.value = '';
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to set account fields');
+            setLoading(false);
+        }
+    };
+
+    selfDestructBtn.onclick = async () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        const options = {
+            beneficiary: selfDestructBeneficiaryInput.value.trim(),
+            eip6780: selfDestructEip6780.checked,
+            newContract: selfDestructNewContract.checked
+        };
+        try {
+            setLoading(true);
+            setError('');
+            const data = await ApiClient.selfDestruct(selectedAccount, options);
+            renderAccountFields(data && data.account);
+            if (data && data.trie) {
+                updateTrieVisualization(data.trie);
+                rootHashElem.textContent = data.trie.rootHash || '-';
+            }
+            if (data && data.stateRoot) {
+                stateRootElem.textContent = data.stateRoot;
+            }
+            if (data && !data.destructed) {
+                setError('The account was not deleted: under EIP-6780 only contracts created in the same transaction are destructed.');
+            }
+            selfDestructBeneficiaryInput.value = '';
+            await refreshNodeStorage(selectedAccount);
+            setLoading(false);
+        } catch (e) {
+            setError(e.message || 'Failed to self-destruct account');
+            setLoading(false);
+        }
+    };
+
+    tracePlayBtn.onclick = () => {
+        if (traceTimer) {
+            stopTrace();
+        } else {
+            playTrace();
+        }
+    };
+    tracePrevBtn.onclick = () => {
+        stopTrace();
+        showTraceFrame(traceFrame - 1);
+    };
+    traceNextBtn.onclick = () => {
+        stopTrace();
+        showTraceFrame(traceFrame + 1);
+    };
+    traceCloseBtn.onclick = () => {
+        stopTrace();
+        traceFrame = -1;
+        Array.from(traceEvents.children).forEach(li => li.classList.remove('current'));
+        tracePrevBtn.disabled = true;
+        traceNextBtn.disabled = false;
+        traceStatus.innerHTML = '<div class="empty-message">Showing the final trie. Play or pick a frame to replay the trace.</div>';
+        updateTrieVisualization(insertTrace.finalTrie);
+    };
+
+    refreshHistoryBtn.onclick = () => {
+        if (!selectedAccount) {
+            setError('Select an account first.');
+            return;
+        }
+        refreshVersions(selectedAccount);
+    };
+    backToLatestBtn.onclick = () => {
+        if (selectedAccount) {
+            fetchAndShowTrie(selectedAccount);
+        }
+    };
+
     textViewBtn.onclick = () => switchView('text');
     treeViewBtn.onclick = () => switchView('tree');
 
@@ -484,12 +1559,74 @@ document.addEventListener('DOMContentLoaded', () => {
             
             // Display the root hash that was used for verification
             proofRootHash.textContent = rootHash;
+            renderProofPath(result);
+
+            // Highlight the path of the key if the proof is for the trie on display
+            if (rootHash.toLowerCase() === rootHashElem.textContent.toLowerCase()) {
+                trieVisualizer.setProofHighlight({
+                    stopPath: result.stopPath,
+                    exists: result.exists,
+                    slot: result.divergence ? result.divergence.slot : undefined
+                });
+            } else {
+                trieVisualizer.setProofHighlight(null);
+            }
             
             setLoading(false);
         } catch (error) {
             setError('Failed to get proof: ' + error.message);
             proofRootHash.textContent = '-';
             proofValue.textContent = '-';
+            renderProofPath(null);
+            trieVisualizer.setProofHighlight(null);
+            setLoading(false);
+        }
+    });
+
+    // Generate a fresh proof of the key, against the given root or the current one
+    generateProofBtn.addEventListener('click', async function() {
+        if (!selectedAccount) {
+            setError('Please select an account first');
+            return;
+        }
+        const key = proofKeyInput.value.trim();
+        const rootHash = proofRootInput.value.trim();
+
+        if (!/^0x[0-9a-fA-F]+$/.test(key)) {
+            setError('Key must be a valid hex string (0x...)');
+            return;
+        }
+
+        if (rootHash && !/^0x[0-9a-fA-F]{64}$/.test(rootHash)) {
+            setError('Root hash must be a valid 64-character hex string (0x...)');
+            return;
+        }
+
+        try {
+            setLoading(true);
+            setError('');
+
+            const result = await ApiClient.generateProof(selectedAccount, key, rootHash);
+            proofRootHash.textContent = result.root;
+            proofValue.textContent = result.exists ? result.value : 'Not found';
+            renderProofPath(result);
+            if (result.root.toLowerCase() === rootHashElem.textContent.toLowerCase()) {
+                trieVisualizer.setProofHighlight({
+                    stopPath: result.stopPath,
+                    exists: result.exists,
+                    slot: result.divergence ? result.divergence.slot : undefined
+                });
+            } else {
+                trieVisualizer.setProofHighlight(null);
+            }
+
+            setLoading(false);
+        } catch (error) {
+            setError('Failed to generate proof: ' + error.message);
+            proofRootHash.textContent = '-';
+            proofValue.textContent = '-';
+            renderProofPath(null);
+            trieVisualizer.setProofHighlight(null);
             setLoading(false);
         }
     });
@@ -530,4 +1667,34 @@ document.addEventListener('DOMContentLoaded', () => {
     clearTrieVisualization();
     setError('');
     setLoading(false);
+
+    // Every tab works on its own session, so it doesn't see the accounts and
+    // the storage of the others. The default session is shared. The session
+    // is kept across reloads of the tab: it's released when the page is
+    // hidden and resumed when it's shown again, and the server closes it
+    // shortly if it isn't, e.g. when the tab is closed.
+    function openSession() {
+        const storedId = sessionStorage.getItem('sessionId');
+        const opened = storedId
+            ? ApiClient.resumeSession(storedId).catch(() => ApiClient.createSession())
+            : ApiClient.createSession();
+        return opened
+            .then(session => {
+                sessionStorage.setItem('sessionId', session.id);
+                sessionIdElem.textContent = session.id;
+            })
+            .catch(error => {
+                ApiClient.sessionId = null;
+                sessionIdElem.textContent = 'default (shared)';
+                setError('Failed to create a session, using the shared one: ' + error.message);
+            });
+    }
+    window.addEventListener('pagehide', () => ApiClient.releaseSession());
+    window.addEventListener('pageshow', event => {
+        // A page restored from the back-forward cache resumes its session
+        if (event.persisted) {
+            openSession();
+        }
+    });
+    openSession();
 });
\ No newline at end of file
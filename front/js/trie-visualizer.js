@@ -42,6 +42,11 @@ class TrieVisualizer {
      * @param {Object} data - The server response data
      */
     updateVisualization(data) {
+        // A new trie invalidates the highlighted proof path and diff
+        this.proofHighlight = null;
+        this.diffHighlight = null;
+        this.traceHighlight = null;
+
         // Update root hash
         this.rootHashElement.textContent = data.rootHash || '-';
         
@@ -81,6 +86,70 @@ class TrieVisualizer {
         }
     }
     
+    /**
+     * Highlight the path of a proven key in the tree view
+     * @param {Object} highlight - The proof path ({ stopPath, exists, slot }), null to clear
+     */
+    setProofHighlight(highlight) {
+        this.proofHighlight = highlight;
+        if (this.currentRootNodeData) {
+            this.renderTreeDiagramBoxed(this.currentRootNodeData, this.currentOriginalKVPairs);
+        }
+    }
+    
+    /**
+     * Color the nodes of the tree view by how they changed since an older version of the trie
+     * @param {Object} diff - The trie diff ({ created, orphaned }, lists of nodes by path), null to clear
+     */
+    setDiffHighlight(diff) {
+        this.diffHighlight = diff ? {
+            created: new Set((diff.created || []).map(n => n.path)),
+            orphaned: new Set((diff.orphaned || []).map(n => n.path))
+        } : null;
+        if (this.currentRootNodeData) {
+            this.renderTreeDiagramBoxed(this.currentRootNodeData, this.currentOriginalKVPairs);
+        }
+    }
+    
+    /**
+     * Show a frame of an insertion trace: a snapshot of the trie with the path of a decision marked
+     * @param {Object} rootNodeData - The root node of the snapshot, null for an empty trie
+     * @param {Object} highlight - The decision ({ path, label }), the node it's taken at is the deepest one on the path
+     * @param {Array} originalKVPairs - The slots to label the leaves with
+     */
+    showTraceFrame(rootNodeData, highlight, originalKVPairs = []) {
+        this.proofHighlight = null;
+        this.diffHighlight = null;
+        this.traceHighlight = highlight ? {
+            ...highlight,
+            nodePath: this.findDeepestNodePath(rootNodeData, highlight.path)
+        } : null;
+        if (rootNodeData) {
+            this.renderTreeDiagramBoxed(rootNodeData, originalKVPairs);
+        } else {
+            this.clearTreeDiagram();
+        }
+    }
+    
+    /**
+     * Find the deepest node of a trie whose path is a prefix of the given path
+     * @param {Object} rootNodeData - The root node
+     * @param {string} path - The path, one hex character per nibble
+     * @returns {string|null} The path of the node, null if there's none
+     */
+    findDeepestNodePath(rootNodeData, path) {
+        let deepest = null;
+        const visit = (node) => {
+            if (!node || typeof node.path !== 'string' || !path.startsWith(node.path)) return;
+            if (node.type !== 'value' && (deepest === null || node.path.length > deepest.length)) {
+                deepest = node.path;
+            }
+            (node.children || []).forEach(visit);
+        };
+        visit(rootNodeData);
+        return deepest;
+    }
+    
     /**
      * Pretty print the trie as a human-readable tree (like CLI, not JSON)
      * @param {Object} node - The trie node
@@ -128,7 +197,8 @@ class TrieVisualizer {
      * @param {Array} originalKVPairs - Original key-value pairs before hashing.
      */
     renderTreeDiagramBoxed(rootNodeData, originalKVPairs = []) {
-        // Store original key-value pairs for use in rendering
+        // Store the trie and original key-value pairs for use in rendering
+        this.currentRootNodeData = rootNodeData;
         this.currentOriginalKVPairs = originalKVPairs || [];
         
         // Debug log to verify data is being passed
@@ -187,6 +257,44 @@ class TrieVisualizer {
         const nodeBox = this.createStyledNode(nodeTypeForStyle, ''); 
         nodeBox.innerHTML = ''; // Clear any default content
 
+        // Mark the nodes on the path of a proven key, and the node where it stops
+        const highlight = this.proofHighlight;
+        const onProofPath = highlight && typeof node.path === 'string' && highlight.stopPath.startsWith(node.path);
+        const isProofStop = onProofPath && node.path === highlight.stopPath;
+        if (isProofStop) {
+            nodeBox.style.outline = highlight.exists ? '3px solid #27ae60' : '3px solid #e74c3c';
+            nodeBox.title = highlight.exists ? 'The proven key ends here' : 'The path of the key leaves the trie here';
+        } else if (onProofPath) {
+            nodeBox.style.outline = '2px dashed #f39c12';
+        }
+
+        // Mark the nodes on the path of a traced decision, and the node it's taken at
+        const trace = this.traceHighlight;
+        if (trace && typeof node.path === 'string' && node.type !== 'value' && trace.path.startsWith(node.path)) {
+            if (node.path === trace.nodePath) {
+                nodeBox.style.outline = '3px solid #2980b9';
+                nodeBox.title = trace.label;
+            } else {
+                nodeBox.style.outline = '2px dashed #2980b9';
+            }
+        }
+
+        // Color the nodes by how they changed since the compared version: a
+        // node replaced at the same path is changed, one at a new path is new
+        const diff = this.diffHighlight;
+        if (diff && typeof node.path === 'string' && node.type !== 'value' && node.type !== 'hash') {
+            if (diff.created.has(node.path) && diff.orphaned.has(node.path)) {
+                nodeBox.style.boxShadow = '0 0 0 3px #f39c12';
+                nodeBox.title = nodeBox.title || 'Changed: rewritten at the same path';
+            } else if (diff.created.has(node.path)) {
+                nodeBox.style.boxShadow = '0 0 0 3px #27ae60';
+                nodeBox.title = nodeBox.title || 'New: created at a new path';
+            } else {
+                nodeBox.style.opacity = '0.5';
+                nodeBox.title = nodeBox.title || 'Unchanged';
+            }
+        }
+
         // 1. Title with clear node type identification
         const titleDiv = document.createElement('div');
         titleDiv.className = 'mpt-label';
@@ -356,6 +464,12 @@ class TrieVisualizer {
                         slotElement.style.border = '1px solid #e9ecef';
                     }
                     
+                    // The empty slot an exclusion proof ends at
+                    if (isProofStop && !highlight.exists && highlight.slot === slot) {
+                        slotElement.style.border = '2px solid #e74c3c';
+                        slotElement.style.color = '#e74c3c';
+                    }
+                    
                     slotsContainer.appendChild(slotElement);
                 }
                 
@@ -420,6 +534,7 @@ class TrieVisualizer {
      * Clears only the tree diagram part of the visualization.
      */
     clearTreeDiagram() {
+        this.currentRootNodeData = null;
         const diagramElement = document.getElementById('trie-diagram');
         if (diagramElement) {
             diagramElement.innerHTML = 'No trie data to display.';
@@ -1,26 +1,59 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
 	api "storage_extract/back_api"
 	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/filedb"
+	"storage_extract/ethdb/memorydb"
 	"storage_extract/state"
 	"storage_extract/trie/test"
+	"syscall"
 )
 
 func main() {
 	// Parse command line arguments
 	mode := flag.String("mode", "server", "Run mode: 'server' (web interface) or 'test' (command line test)")
 	port := flag.String("port", "8080", "Server port to use when running in server mode")
+	scheme := flag.String("scheme", "hash", "Trie node storage scheme: 'hash' (keyed by node hash) or 'path' (keyed by node path)")
+	datadir := flag.String("datadir", "", "Directory persisting the state of the default session across restarts (in memory if empty)")
 	flag.Parse()
 
 	// Choose the appropriate mode
 	switch *mode {
 	case "server":
-		// Start the web server with Gin
+		// Set up the state database with the selected node scheme, on disk
+		// if a data directory is given
+		var disk ethdb.KeyValueStore = memorydb.New()
+		if *datadir != "" {
+			fdb, err := filedb.New(filepath.Join(*datadir, "state.db"))
+			if err != nil {
+				fmt.Printf("Database error: %v\n", err)
+				return
+			}
+			defer func() {
+				if err := fdb.Close(); err != nil {
+					fmt.Printf("Database error: %v\n", err)
+				}
+			}()
+			disk = fdb
+		}
+		if err := api.SetupDatabase(disk, *scheme); err != nil {
+			fmt.Printf("Database error: %v\n", err)
+			return
+		}
+		// Start the web server with Gin, it's shut down on SIGINT or SIGTERM
+		// so that the deferred Close flushes the database
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 		fmt.Printf("Starting Ethereum Storage Visualizer on port %s...\n", *port)
-		if err := api.StartGinServer(*port); err != nil {
+		if err := api.StartGinServer(ctx, *port); err != nil {
 			fmt.Printf("Server error: %v\n", err)
 		}
 
@@ -47,7 +80,7 @@ func runTestMode() {
 	fmt.Printf("Creating contract test: Address %x\n", contractAddr)
 
 	// 2. Create StateDB and CachingDB
-	db := &state.CachingDB{}
+	db := state.NewDatabase(memorydb.New())
 	stateRoot := common.Hash{}
 	stateDB, err := state.New(stateRoot, db)
 	if err != nil {
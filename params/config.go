@@ -0,0 +1,47 @@
+package params
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rules wraps the fork flags relevant to the storage gas accounting.
+//
+// Different from the original code, there is no chain config to derive the
+// rules from a block number, they are selected by the name of the fork.
+// Original struct: github.com/ethereum/go-ethereum/params/config.go line 1063
+type Rules struct {
+	IsIstanbul, IsBerlin, IsLondon bool
+}
+
+// Forks lists the forks the rules can be selected by, from the oldest.
+// Notice: This variable is not included in the original code.
+var Forks = []string{"istanbul", "berlin", "london"}
+
+// RulesForFork returns the rules active at the given fork, London by default.
+// Notice: This function is not included in the original code.
+func RulesForFork(fork string) (Rules, error) {
+	switch strings.ToLower(fork) {
+	case "istanbul":
+		return Rules{IsIstanbul: true}, nil
+	case "berlin":
+		return Rules{IsIstanbul: true, IsBerlin: true}, nil
+	case "london", "":
+		return Rules{IsIstanbul: true, IsBerlin: true, IsLondon: true}, nil
+	}
+	return Rules{}, fmt.Errorf("unsupported fork %q, expected one of %s", fork, strings.Join(Forks, ", "))
+}
+
+// Name returns the name of the latest fork enabled by the rules.
+// Notice: This function is not included in the original code.
+func (r Rules) Name() string {
+	switch {
+	case r.IsLondon:
+		return "london"
+	case r.IsBerlin:
+		return "berlin"
+	case r.IsIstanbul:
+		return "istanbul"
+	}
+	return "unknown"
+}
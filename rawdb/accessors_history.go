@@ -0,0 +1,54 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"storage_extract/ethdb"
+)
+
+// ReadTrieHistory retrieves the encoded trie node history with the given id,
+// nil if it's not found.
+// Notice: This function is not included in the original code.
+func ReadTrieHistory(db ethdb.KeyValueReader, id uint64) []byte {
+	data, _ := db.Get(trieHistoryKey(id))
+	return data
+}
+
+// WriteTrieHistory stores the encoded trie node history with the given id.
+// Notice: This function is not included in the original code.
+func WriteTrieHistory(db ethdb.KeyValueWriter, id uint64, blob []byte) error {
+	if err := db.Put(trieHistoryKey(id), blob); err != nil {
+		return fmt.Errorf("failed to store trie history: %v", err)
+	}
+	return nil
+}
+
+// DeleteTrieHistory removes the trie node history with the given id.
+// Notice: This function is not included in the original code.
+func DeleteTrieHistory(db ethdb.KeyValueWriter, id uint64) error {
+	if err := db.Delete(trieHistoryKey(id)); err != nil {
+		return fmt.Errorf("failed to delete trie history: %v", err)
+	}
+	return nil
+}
+
+// ReadTrieHistoryTail retrieves the id of the last pruned trie node history,
+// 0 if none was pruned.
+// Notice: This function is not included in the original code.
+func ReadTrieHistoryTail(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(trieHistoryTailKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteTrieHistoryTail stores the id of the last pruned trie node history.
+// Notice: This function is not included in the original code.
+func WriteTrieHistoryTail(db ethdb.KeyValueWriter, id uint64) error {
+	if err := db.Put(trieHistoryTailKey, binary.BigEndian.AppendUint64(nil, id)); err != nil {
+		return fmt.Errorf("failed to store trie history tail: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package rawdb
+
+import (
+	"fmt"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+)
+
+// ReadHeadStateRoot retrieves the state root of the latest committed version,
+// an empty hash if nothing was committed yet.
+// Notice: This function is not included in the original code.
+func ReadHeadStateRoot(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headStateRootKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteHeadStateRoot stores the state root of the latest committed version.
+// Notice: This function is not included in the original code.
+func WriteHeadStateRoot(db ethdb.KeyValueWriter, root common.Hash) error {
+	if err := db.Put(headStateRootKey, root.Bytes()); err != nil {
+		return fmt.Errorf("failed to store head state root: %v", err)
+	}
+	return nil
+}
+
+// ReadVersion retrieves the encoded committed version with the given number,
+// nil if it's not found.
+// Notice: This function is not included in the original code.
+func ReadVersion(db ethdb.KeyValueReader, number uint64) []byte {
+	data, _ := db.Get(versionKey(number))
+	return data
+}
+
+// WriteVersion stores the encoded committed version with the given number.
+// Notice: This function is not included in the original code.
+func WriteVersion(db ethdb.KeyValueWriter, number uint64, blob []byte) error {
+	if err := db.Put(versionKey(number), blob); err != nil {
+		return fmt.Errorf("failed to store version: %v", err)
+	}
+	return nil
+}
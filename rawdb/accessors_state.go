@@ -0,0 +1,62 @@
+package rawdb
+
+import (
+	"fmt"
+	"storage_extract/common"
+	"storage_extract/ethdb"
+)
+
+// ReadPreimage retrieves a single preimage of the provided hash.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_state.go line 28
+func ReadPreimage(db ethdb.KeyValueReader, hash common.Hash) []byte {
+	data, _ := db.Get(preimageKey(hash))
+	return data
+}
+
+// WritePreimages writes the provided set of preimages to the database.
+// Different from the original code, a failed write is returned instead of
+// crashing the process.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_state.go line 39
+func WritePreimages(db ethdb.KeyValueWriter, preimages map[common.Hash][]byte) error {
+	for hash, preimage := range preimages {
+		if err := db.Put(preimageKey(hash), preimage); err != nil {
+			return fmt.Errorf("failed to store trie preimage: %v", err)
+		}
+	}
+	return nil
+}
+
+// ReadCode retrieves the contract code of the provided code hash.
+// Different from the original code, the legacy scheme (code keyed by its bare
+// hash) is not supported since it has never been used by this database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_state.go line 49
+func ReadCode(db ethdb.KeyValueReader, hash common.Hash) []byte {
+	data, _ := db.Get(codeKey(hash))
+	return data
+}
+
+// HasCode checks if the contract code corresponding to the
+// provided code hash is present in the db.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_state.go line 70
+func HasCode(db ethdb.KeyValueReader, hash common.Hash) bool {
+	ok, _ := db.Has(codeKey(hash))
+	return ok
+}
+
+// WriteCode writes the provided contract code database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_state.go line 89
+func WriteCode(db ethdb.KeyValueWriter, hash common.Hash, code []byte) error {
+	if err := db.Put(codeKey(hash), code); err != nil {
+		return fmt.Errorf("failed to store contract code: %v", err)
+	}
+	return nil
+}
+
+// DeleteCode deletes the specified contract code from the database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_state.go line 96
+func DeleteCode(db ethdb.KeyValueWriter, hash common.Hash) error {
+	if err := db.Delete(codeKey(hash)); err != nil {
+		return fmt.Errorf("failed to delete contract code: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package rawdb contains the low level accessors for the data stored in the
+// key-value database.
+package rawdb
+
+import (
+	"fmt"
+	"storage_extract/common"
+	"storage_extract/ethdb"
+)
+
+// HashScheme is the legacy hash-based state scheme with which trie nodes are
+// stored in the disk with node hash as the database key. The advantage of this
+// scheme is that different versions of trie nodes can be stored in disk, which
+// is very beneficial for constructing archive nodes. The drawback is it will
+// store different trie nodes on the same path to different locations on the disk
+// with no data locality, and it's unfriendly for designing state pruning.
+const HashScheme = "hash"
+
+// PathScheme is the new path-based state scheme with which trie nodes are stored
+// in the disk with node path as the database key. This scheme will only store one
+// version of state data in the disk, which means that the state pruning operation
+// is native. At the same time, this scheme will put adjacent trie nodes in the same
+// area of the disk with good data locality property.
+const PathScheme = "path"
+
+// ReadAccountTrieNode retrieves the account trie node with the specified node path.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 67
+func ReadAccountTrieNode(db ethdb.KeyValueReader, path []byte) []byte {
+	data, _ := db.Get(accountTrieNodeKey(path))
+	return data
+}
+
+// WriteAccountTrieNode writes the provided account trie node into database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 84
+func WriteAccountTrieNode(db ethdb.KeyValueWriter, path []byte, node []byte) error {
+	if err := db.Put(accountTrieNodeKey(path), node); err != nil {
+		return fmt.Errorf("failed to store account trie node: %v", err)
+	}
+	return nil
+}
+
+// DeleteAccountTrieNode deletes the specified account trie node from the database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 91
+func DeleteAccountTrieNode(db ethdb.KeyValueWriter, path []byte) error {
+	if err := db.Delete(accountTrieNodeKey(path)); err != nil {
+		return fmt.Errorf("failed to delete account trie node: %v", err)
+	}
+	return nil
+}
+
+// ReadStorageTrieNode retrieves the storage trie node with the specified node path.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 98
+func ReadStorageTrieNode(db ethdb.KeyValueReader, accountHash common.Hash, path []byte) []byte {
+	data, _ := db.Get(storageTrieNodeKey(accountHash, path))
+	return data
+}
+
+// WriteStorageTrieNode writes the provided storage trie node into database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 115
+func WriteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte, node []byte) error {
+	if err := db.Put(storageTrieNodeKey(accountHash, path), node); err != nil {
+		return fmt.Errorf("failed to store storage trie node: %v", err)
+	}
+	return nil
+}
+
+// DeleteStorageTrieNode deletes the specified storage trie node from the database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 122
+func DeleteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte) error {
+	if err := db.Delete(storageTrieNodeKey(accountHash, path)); err != nil {
+		return fmt.Errorf("failed to delete storage trie node: %v", err)
+	}
+	return nil
+}
+
+// ReadLegacyTrieNode retrieves the legacy trie node with the given
+// associated node hash.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 129
+func ReadLegacyTrieNode(db ethdb.KeyValueReader, hash common.Hash) []byte {
+	data, err := db.Get(hash.Bytes())
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// HasLegacyTrieNode checks if the trie node with the provided hash is present in db.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 138
+func HasLegacyTrieNode(db ethdb.KeyValueReader, hash common.Hash) bool {
+	ok, _ := db.Has(hash.Bytes())
+	return ok
+}
+
+// WriteLegacyTrieNode writes the provided legacy trie node to database.
+// Different from the original code, the error is returned instead of
+// crashing the process.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 144
+func WriteLegacyTrieNode(db ethdb.KeyValueWriter, hash common.Hash, node []byte) error {
+	if err := db.Put(hash.Bytes(), node); err != nil {
+		return fmt.Errorf("failed to store legacy trie node: %v", err)
+	}
+	return nil
+}
+
+// DeleteLegacyTrieNode deletes the specified legacy trie node from database.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/accessors_trie.go line 151
+func DeleteLegacyTrieNode(db ethdb.KeyValueWriter, hash common.Hash) error {
+	if err := db.Delete(hash.Bytes()); err != nil {
+		return fmt.Errorf("failed to delete legacy trie node: %v", err)
+	}
+	return nil
+}
+
+// TrieNodeKey returns the database key of the trie node in the given scheme.
+// Nodes are keyed by their hash in the hash scheme, and by the owner plus the
+// node path in the path scheme.
+// Notice: This function is not included in the original code.
+func TrieNodeKey(scheme string, owner common.Hash, path []byte, hash common.Hash) []byte {
+	if scheme == PathScheme {
+		if owner == (common.Hash{}) {
+			return accountTrieNodeKey(path)
+		}
+		return storageTrieNodeKey(owner, path)
+	}
+	return hash.Bytes()
+}
+
+// InspectTrieNodes iterates the whole database and reports the number of trie
+// nodes stored in the given scheme along with their total size (key + value).
+// Notice: This function is not included in the original code, it's a trimmed
+// down version of InspectDatabase.
+func InspectTrieNodes(db ethdb.Iteratee, scheme string) (int, common.StorageSize) {
+	var (
+		count int
+		size  common.StorageSize
+		it    = db.NewIterator(nil, nil)
+	)
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		switch scheme {
+		case HashScheme:
+			if !IsLegacyTrieNode(key, value) {
+				continue
+			}
+		case PathScheme:
+			if ok, _ := ResolveAccountTrieNodeKey(key); !ok {
+				if ok, _, _ := ResolveStorageTrieNode(key); !ok {
+					continue
+				}
+			}
+		default:
+			continue
+		}
+		count++
+		size += common.StorageSize(len(key) + len(value))
+	}
+	return count, size
+}
@@ -0,0 +1,108 @@
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+)
+
+// The fields below define the low level database schema prefixing.
+var (
+	TrieNodeAccountPrefix = []byte("A") // TrieNodeAccountPrefix + hexPath -> trie node
+	TrieNodeStoragePrefix = []byte("O") // TrieNodeStoragePrefix + accountHash + hexPath -> trie node
+	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+
+	PreimagePrefix = []byte("secure-key-") // PreimagePrefix + hash -> preimage
+
+	// Notice: The keys below are not included in the original code.
+	headStateRootKey   = []byte("LastStateRoot")         // headStateRootKey tracks the state root of the latest committed version
+	trieHistoryTailKey = []byte("LastPrunedTrieHistory") // trieHistoryTailKey tracks the id of the last pruned trie node history
+	VersionPrefix      = []byte("V")                     // VersionPrefix + num (uint64 big endian) -> committed version
+	TrieHistoryPrefix  = []byte("T")                     // TrieHistoryPrefix + id (uint64 big endian) -> trie node history
+)
+
+// preimageKey = PreimagePrefix + hash
+func preimageKey(hash common.Hash) []byte {
+	return append(PreimagePrefix, hash.Bytes()...)
+}
+
+// codeKey = CodePrefix + hash
+func codeKey(hash common.Hash) []byte {
+	return append(CodePrefix, hash.Bytes()...)
+}
+
+// versionKey = VersionPrefix + num (uint64 big endian)
+func versionKey(number uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, VersionPrefix...), number)
+}
+
+// trieHistoryKey = TrieHistoryPrefix + id (uint64 big endian)
+func trieHistoryKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, TrieHistoryPrefix...), id)
+}
+
+// accountTrieNodeKey = TrieNodeAccountPrefix + nodePath.
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+// storageTrieNodeKey = TrieNodeStoragePrefix + accountHash + nodePath.
+func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
+	buf := make([]byte, len(TrieNodeStoragePrefix)+common.HashLength+len(path))
+	n := copy(buf, TrieNodeStoragePrefix)
+	n += copy(buf[n:], accountHash.Bytes())
+	copy(buf[n:], path)
+	return buf
+}
+
+// IsLegacyTrieNode reports whether a provided database entry is a legacy trie
+// node. The characteristics of legacy trie node are:
+// - the key length is 32 bytes
+// - the key is the hash of val
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/schema.go line 278
+func IsLegacyTrieNode(key []byte, val []byte) bool {
+	if len(key) != common.HashLength {
+		return false
+	}
+	return bytes.Equal(key, crypto.Keccak256Hash(val).Bytes())
+}
+
+// ResolveAccountTrieNodeKey reports whether a provided database entry is an
+// account trie node in path-based state scheme, and returns the resolved
+// node path.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/schema.go line 288
+func ResolveAccountTrieNodeKey(key []byte) (bool, []byte) {
+	if !bytes.HasPrefix(key, TrieNodeAccountPrefix) {
+		return false, nil
+	}
+	// The remaining key should only consist a hex node path
+	// whose length is in the range 0 to 64 (64 is excluded
+	// since leaves are always wrapped with shortNode).
+	if len(key) >= len(TrieNodeAccountPrefix)+common.HashLength*2 {
+		return false, nil
+	}
+	return true, key[len(TrieNodeAccountPrefix):]
+}
+
+// ResolveStorageTrieNode reports whether a provided database entry is a storage
+// trie node in path-based state scheme, and returns the resolved account hash
+// and node path.
+// Original function: github.com/ethereum/go-ethereum/core/rawdb/schema.go line 311
+func ResolveStorageTrieNode(key []byte) (bool, common.Hash, []byte) {
+	if !bytes.HasPrefix(key, TrieNodeStoragePrefix) {
+		return false, common.Hash{}, nil
+	}
+	// The remaining key consists of 2 parts:
+	// - 32 bytes account hash
+	// - hex node path whose length is in the range 0 to 64
+	if len(key) < len(TrieNodeStoragePrefix)+common.HashLength {
+		return false, common.Hash{}, nil
+	}
+	if len(key) >= len(TrieNodeStoragePrefix)+common.HashLength+common.HashLength*2 {
+		return false, common.Hash{}, nil
+	}
+	accountHash := common.BytesToHash(key[len(TrieNodeStoragePrefix) : len(TrieNodeStoragePrefix)+common.HashLength])
+	return true, accountHash, key[len(TrieNodeStoragePrefix)+common.HashLength:]
+}
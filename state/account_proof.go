@@ -0,0 +1,105 @@
+package state
+
+import (
+	"math/big"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AccountResult is the result of an eth_getProof call (EIP-1186): an account
+// with the Merkle proof of it in the account trie, and the Merkle proofs of
+// the requested storage slots in its storage trie.
+// Original struct: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 335
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is a storage slot along with the Merkle proof of it.
+// Original struct: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 345
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// proofList implements ethdb.KeyValueWriter and collects the proofs as
+// hex-strings for delivery to rpc-caller.
+// Original type: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 353
+type proofList []string
+
+// Original function: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 355
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, hexutil.Encode(value))
+	return nil
+}
+
+// Original function: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 360
+func (n *proofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// GetProof returns the account and the storage values of the given address
+// along with their Merkle proofs, in the EIP-1186 format. The keys of the
+// storage proofs are encoded as 32-byte hashes.
+//
+// Different from the original code, the proofs are generated from the live
+// account and storage tries instead of ones reopened at a block's state root,
+// so they're against the state as of the last IntermediateRoot call, which
+// must follow any state change for the proofs to match the values.
+// Original function: github.com/ethereum/go-ethereum/internal/ethapi/api.go line 365 (BlockChainAPI.GetProof)
+func (s *StateDB) GetProof(addr common.Address, keys []common.Hash) (*AccountResult, error) {
+	var (
+		codeHash     = s.GetCodeHash(addr)
+		storageRoot  = s.GetStorageRoot(addr)
+		storageProof = make([]StorageResult, len(keys))
+	)
+	if len(keys) > 0 {
+		var storageTrie Trie
+		if storageRoot != types.EmptyRootHash && storageRoot != (common.Hash{}) {
+			st, err := s.getStateObject(addr).getTrie()
+			if err != nil {
+				return nil, err
+			}
+			storageTrie = st
+		}
+		// Create the proofs for the storageKeys.
+		for i, key := range keys {
+			outputKey := hexutil.Encode(key[:])
+			if storageTrie == nil {
+				storageProof[i] = StorageResult{outputKey, &hexutil.Big{}, []string{}}
+				continue
+			}
+			var proof proofList
+			if err := storageTrie.Prove(crypto.Keccak256Hash(key.Bytes()).Bytes(), &proof); err != nil {
+				return nil, err
+			}
+			value := (*hexutil.Big)(new(big.Int).SetBytes(s.GetState(addr, key).Bytes()))
+			storageProof[i] = StorageResult{outputKey, value, proof}
+		}
+	}
+	// Create the accountProof.
+	var accountProof proofList
+	if err := s.trie.Prove(crypto.Keccak256Hash(addr.Bytes()).Bytes(), &accountProof); err != nil {
+		return nil, err
+	}
+	balance := s.GetBalance(addr).ToBig()
+	return &AccountResult{
+		Address:      addr,
+		AccountProof: accountProof,
+		Balance:      (*hexutil.Big)(balance),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(s.GetNonce(addr)),
+		StorageHash:  storageRoot,
+		StorageProof: storageProof,
+	}, s.Error()
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/uint256"
+)
+
+// verifyProof checks the hex-encoded proof of the key against the root and
+// returns the proven value, nil if the proof is one of absence.
+func verifyProof(t *testing.T, root common.Hash, key []byte, proof []string) []byte {
+	t.Helper()
+
+	var nodes trienode.ProofList
+	for _, node := range proof {
+		blob, err := hexutil.Decode(node)
+		if err != nil {
+			t.Fatalf("invalid proof node %q: %v", node, err)
+		}
+		nodes = append(nodes, blob)
+	}
+	value, err := trie.VerifyProof(root, crypto.Keccak256Hash(key).Bytes(), nodes.Set())
+	if err != nil {
+		t.Fatalf("proof of %x doesn't verify against %x: %v", key, root, err)
+	}
+	return value
+}
+
+// Tests that the account and storage proofs of GetProof verify against the
+// state root and the storage root of the account, for a slot of the account,
+// a slot missing from it and an account missing from the state.
+func TestGetProof(t *testing.T) {
+	var (
+		state   = newTestState(t)
+		addr    = common.BytesToAddress([]byte("aa"))
+		missing = common.BytesToAddress([]byte("bb"))
+		slot    = common.BytesToHash([]byte{1})
+		absent  = common.BytesToHash([]byte{2})
+		value   = common.BytesToHash([]byte{0xff})
+	)
+	state.SetBalance(addr, uint256.NewInt(42))
+	state.SetNonce(addr, 3)
+	state.SetCode(addr, []byte("code"))
+	state.SetState(addr, slot, value)
+	state.SetState(addr, common.BytesToHash([]byte{3}), common.BytesToHash([]byte{3}))
+	state.SetBalance(common.BytesToAddress([]byte("cc")), uint256.NewInt(1))
+	root := state.IntermediateRoot(false)
+
+	result, err := state.GetProof(addr, []common.Hash{slot, absent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := verifyProof(t, root, addr.Bytes(), result.AccountProof)
+	if blob == nil {
+		t.Fatal("account proof is one of absence")
+	}
+	var account types.StateAccount
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Root != result.StorageHash {
+		t.Errorf("storage hash mismatch: have %x, proven %x", result.StorageHash, account.Root)
+	}
+	if account.Balance.ToBig().Cmp(result.Balance.ToInt()) != 0 || account.Nonce != uint64(result.Nonce) || !bytes.Equal(account.CodeHash, result.CodeHash[:]) {
+		t.Errorf("account mismatch: have %+v, proven %+v", result, account)
+	}
+
+	// The storage proof of the slot proves its value
+	if len(result.StorageProof) != 2 {
+		t.Fatalf("storage proof count mismatch: have %d, want 2", len(result.StorageProof))
+	}
+	if have := result.StorageProof[0].Value.ToInt(); have.Cmp(new(big.Int).SetBytes(value[:])) != 0 {
+		t.Errorf("slot value mismatch: have %v, want %x", have, value)
+	}
+	blob = verifyProof(t, result.StorageHash, slot[:], result.StorageProof[0].Proof)
+	if _, content, _, err := rlp.Split(blob); err != nil || common.BytesToHash(content) != value {
+		t.Errorf("proven slot value mismatch: have %x, want %x", content, value)
+	}
+
+	// The storage proof of the missing slot proves its absence
+	if have := result.StorageProof[1].Value.ToInt(); have.Sign() != 0 {
+		t.Errorf("missing slot value mismatch: have %v, want 0", have)
+	}
+	if len(result.StorageProof[1].Proof) == 0 {
+		t.Error("no absence proof for the missing slot")
+	}
+	if blob := verifyProof(t, result.StorageHash, absent[:], result.StorageProof[1].Proof); blob != nil {
+		t.Errorf("missing slot proven with value %x", blob)
+	}
+
+	// The account proof of the missing account proves its absence
+	result, err = state.GetProof(missing, []common.Hash{slot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob := verifyProof(t, root, missing.Bytes(), result.AccountProof); blob != nil {
+		t.Errorf("missing account proven with value %x", blob)
+	}
+	if have := result.StorageProof[0].Value.ToInt(); have.Sign() != 0 || len(result.StorageProof[0].Proof) != 0 {
+		t.Errorf("storage proof of a missing account: value %v, %d nodes", have, len(result.StorageProof[0].Proof))
+	}
+	if state.Exist(missing) {
+		t.Error("proof created the missing account")
+	}
+}
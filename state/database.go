@@ -1,22 +1,54 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"storage_extract/common"
 	"storage_extract/crypto"
+	"storage_extract/ethdb"
+	"storage_extract/rawdb"
 	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb"
+	"storage_extract/types"
 )
 
 // Database wraps access to tries and contract code.
 type Database interface {
+	// OpenTrie opens the main account trie.
+	OpenTrie(root common.Hash) (Trie, error)
 
 	// OpenStorageTrie opens the storage trie of an account.
 	// TODO: Currently, one parameter is missing: trie Trie (used to check Verkle trie, so not used for now)
 	OpenStorageTrie(stateRoot common.Hash, address common.Address, root common.Hash) (Trie, error)
+
+	// ContractCode retrieves a particular contract's code.
+	ContractCode(addr common.Address, codeHash common.Hash) ([]byte, error)
+
+	// ContractCodeSize retrieves a particular contracts code's size.
+	ContractCodeSize(addr common.Address, codeHash common.Hash) (int, error)
+
+	// TrieDB returns the underlying trie database for managing trie nodes.
+	TrieDB() *triedb.Database
 }
 
 // Trie is a Ethereum Merkle Patricia trie.
 type Trie interface {
+	// GetAccount abstracts an account read from the trie. It retrieves the
+	// account blob from the trie with provided account address and decodes it
+	// with associated decoding algorithm. If the specified account is not in
+	// the trie, nil will be returned. If the trie is corrupted(e.g. some nodes
+	// are missing or the account blob is incorrect for decoding), an error will
+	// be returned.
+	// Implementation in secure_trie.go
+	GetAccount(address common.Address) (*types.StateAccount, error)
+
+	// GetStorage returns the value for key stored in the trie. The value bytes
+	// must not be modified by the caller. If a node was not found in the database,
+	// a trie.MissingNodeError is returned.
+	// Implementation in secure_trie.go
+	GetStorage(addr common.Address, key []byte) ([]byte, error)
+
 	// UpdateStorage associates key with value in the trie. If value has length zero,
 	// any existing value is deleted from the trie. The value bytes must not be modified
 	// by the caller while they are stored in the trie. If a node was not found in the
@@ -24,10 +56,54 @@ type Trie interface {
 	// Implementation in secure_trie.go
 	UpdateStorage(addr common.Address, key, value []byte) error
 
+	// UpdateAccount abstracts an account write to the trie. It encodes the
+	// provided account object with associated algorithm and then updates it
+	// in the trie with provided address.
+	// Implementation in secure_trie.go
+	UpdateAccount(address common.Address, account *types.StateAccount) error
+
+	// DeleteStorage removes any existing value for key from the trie. If a node
+	// was not found in the database, a trie.MissingNodeError is returned.
+	// Implementation in secure_trie.go
+	DeleteStorage(addr common.Address, key []byte) error
+
+	// DeleteAccount abstracts an account deletion from the trie.
+	// Implementation in secure_trie.go
+	DeleteAccount(address common.Address) error
+
 	// Hash returns the root hash of the trie. It does not write to the database and
 	// can be used even if the trie doesn't have one.
 	Hash() common.Hash
 
+	// Commit collects all dirty nodes in the trie and replace them with the
+	// corresponding node hash. All collected nodes (including dirty leaves if
+	// collectLeaf is true) will be encapsulated into a nodeset for return.
+	// The returned nodeset can be nil if the trie is clean (nothing to commit).
+	// Once the trie is committed, it's not usable anymore. A new trie must
+	// be created with new root and updated trie database for following usage
+	Commit(collectLeaf bool) (common.Hash, *trienode.NodeSet)
+
+	// GetKey returns the sha3 preimage of a hashed key that was previously used
+	// to store a value.
+	// Implementation in secure_trie.go
+	GetKey([]byte) []byte
+
+	// NodeIterator returns an iterator that returns nodes of the trie. Iteration
+	// starts at the key after the given start key. And error will be returned
+	// if fails to create node iterator.
+	// Implementation in secure_trie.go
+	NodeIterator(startKey []byte) (trie.NodeIterator, error)
+
+	// Prove constructs a Merkle proof for key. The result contains all encoded nodes
+	// on the path to the value at key. The value itself is also included in the last
+	// node and can be retrieved by verifying the proof.
+	//
+	// If the trie does not contain a value for key, the returned proof contains all
+	// nodes of the longest existing prefix of the key (at least the root), ending
+	// with the node that proves the absence of the key.
+	// Implementation in proof.go
+	Prove(key []byte, proofDb ethdb.KeyValueWriter) error
+
 	// PrintTrie prints the structure of the trie in a human-readable format.
 	// It recursively traverses the trie and displays each node with proper indentation.
 	// Notice: This function is not included in the original code.
@@ -36,17 +112,80 @@ type Trie interface {
 
 // CachingDB is an implementation of Database interface.
 type CachingDB struct {
-	// disk          ethdb.KeyValueStore TODO: provide an mock underlying keyvalue store db
+	disk   ethdb.KeyValueStore
+	triedb *triedb.Database
+}
+
+// NewDatabase creates a state database with the provided key-value store as
+// the underlying disk layer. The hash-based trie database is used by default.
+func NewDatabase(disk ethdb.KeyValueStore) *CachingDB {
+	// The hash-based scheme loads nothing from the store, so it can't fail
+	db, _ := NewDatabaseWithConfig(disk, nil)
+	return db
+}
+
+// NewDatabaseWithConfig creates a state database with the provided key-value
+// store and the trie database configuration, e.g. triedb.PathDefaults for
+// storing trie nodes by path instead of by hash.
+func NewDatabaseWithConfig(disk ethdb.KeyValueStore, config *triedb.Config) (*CachingDB, error) {
+	tdb, err := triedb.NewDatabase(disk, config)
+	if err != nil {
+		return nil, err
+	}
+	return &CachingDB{
+		disk:   disk,
+		triedb: tdb,
+	}, nil
+}
+
+// DiskDB returns the underlying key-value disk database.
+func (db *CachingDB) DiskDB() ethdb.KeyValueStore {
+	return db.disk
+}
+
+// OpenTrie opens the main account trie at a specific root hash.
+// Original function: github.com/ethereum/go-ethereum/core/state/database.go line 212
+func (db *CachingDB) OpenTrie(root common.Hash) (Trie, error) {
+	// Verkle trie case ignored for now
+	tr, err := trie.NewStateTrie(trie.StateTrieID(root), db.triedb)
+	if err != nil {
+		return nil, err
+	}
+	return tr, nil
 }
 
 // OpenStorageTrie opens the storage trie of an account.
+// Original function: github.com/ethereum/go-ethereum/core/state/database.go line 224
 func (db *CachingDB) OpenStorageTrie(stateRoot common.Hash, address common.Address, root common.Hash) (Trie, error) {
 	// Verkle trie case ignored for now
-	// TODO: Implement db.triedb paramter for the trie
 	fmt.Println("Opening storage trie for address:", (address.Bytes()), "with state root:", stateRoot.Hex(), "and root:", root.Hex())
-	tr, err := trie.NewStateTrie(trie.StorageTrieID(stateRoot, crypto.Keccak256Hash(address.Bytes()), root))
+	tr, err := trie.NewStateTrie(trie.StorageTrieID(stateRoot, crypto.Keccak256Hash(address.Bytes()), root), db.triedb)
 	if err != nil {
 		return nil, err
 	}
 	return tr, nil
 }
+
+// ContractCode retrieves a particular contract's code.
+// Different from the original code, there is no code cache in front of the
+// disk database, the code is always loaded from the key-value store.
+// Original function: github.com/ethereum/go-ethereum/core/state/reader.go line 100
+func (db *CachingDB) ContractCode(addr common.Address, codeHash common.Hash) ([]byte, error) {
+	code := rawdb.ReadCode(db.disk, codeHash)
+	if len(code) > 0 {
+		return code, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// ContractCodeSize retrieves a particular contracts code's size.
+// Original function: github.com/ethereum/go-ethereum/core/state/reader.go line 115
+func (db *CachingDB) ContractCodeSize(addr common.Address, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addr, codeHash)
+	return len(code), err
+}
+
+// TrieDB retrieves any intermediate trie-node caching layer.
+func (db *CachingDB) TrieDB() *triedb.Database {
+	return db.triedb
+}
@@ -1,11 +1,56 @@
 package state
 
-import "storage_extract/common"
+import (
+	"fmt"
+	"sort"
+	"storage_extract/common"
+	"storage_extract/crypto"
 
+	"github.com/holiman/uint256"
+)
+
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// journalEntry is a modification entry in the state change journal that can be
+// reverted on demand.
 type journalEntry interface {
+	revert(*StateDB)          // revert undoes the changes introduced by this journal entry.
 	dirtied() *common.Address // dirtied returns the Ethereum address modified by this journal entry.
 }
 
+type createObjectChange struct {
+	account common.Address
+}
+
+type balanceChange struct {
+	account common.Address
+	prev    *uint256.Int
+}
+
+type nonceChange struct {
+	account common.Address
+	prev    uint64
+}
+
+type codeChange struct {
+	account  common.Address
+	prevCode []byte
+}
+
+// createContractChange represents an account becoming a contract-account.
+// This event happens prior to executing initcode. The journal-event simply
+// manages the created-flag, in order to allow same-tx destruction.
+type createContractChange struct {
+	account common.Address
+}
+
+type selfDestructChange struct {
+	account common.Address
+}
+
 type storageChange struct {
 	account   common.Address
 	key       common.Hash
@@ -13,10 +58,37 @@ type storageChange struct {
 	origvalue common.Hash
 }
 
+type refundChange struct {
+	prev uint64
+}
+
+type touchChange struct {
+	account common.Address
+}
+
+// Changes to the access list
+type accessListAddAccountChange struct {
+	address common.Address
+}
+
+type accessListAddSlotChange struct {
+	address common.Address
+	slot    common.Hash
+}
+
+// Changes to transient storage
+type transientStorageChange struct {
+	account       common.Address
+	key, prevalue common.Hash
+}
+
 // journal contains the list of state modifications applied since the last state commit.
 type journal struct {
 	entries []journalEntry         // Current changes tracked by the journal
 	dirties map[common.Address]int // Dirty accounts and the number of changes
+
+	validRevisions []revision
+	nextRevisionId int
 }
 
 // newJournal creates a new journal instance.
@@ -34,6 +106,120 @@ func (j *journal) append(entry journalEntry) {
 	}
 }
 
+// reset clears the journal, after this operation the journal can be used anew.
+// It is semantically similar to calling 'newJournal', but the underlying slices
+// can be reused.
+// Original function: github.com/ethereum/go-ethereum/core/state/journal.go line 69
+func (j *journal) reset() {
+	j.entries = j.entries[:0]
+	j.validRevisions = j.validRevisions[:0]
+	clear(j.dirties)
+	j.nextRevisionId = 0
+}
+
+// snapshot returns an identifier for the current revision of the state.
+// Original function: github.com/ethereum/go-ethereum/core/state/journal.go line 77
+func (j *journal) snapshot() int {
+	id := j.nextRevisionId
+	j.nextRevisionId++
+	j.validRevisions = append(j.validRevisions, revision{id, j.length()})
+	return id
+}
+
+// revertToSnapshot reverts all state changes made since the given revision.
+// Original function: github.com/ethereum/go-ethereum/core/state/journal.go line 85
+func (j *journal) revertToSnapshot(revid int, s *StateDB) {
+	// Find the snapshot in the stack of valid snapshots.
+	idx, err := j.revisionIndex(revid)
+	if err != nil {
+		panic(err)
+	}
+	snapshot := j.validRevisions[idx].journalIndex
+
+	// Replay the journal to undo changes and remove invalidated snapshots
+	j.revert(s, snapshot)
+	j.validRevisions = j.validRevisions[:idx]
+}
+
+// revisionIndex returns the position of the given revision in the stack of
+// valid revisions, or an error if the revision is unknown or already reverted.
+// Notice: This function is not included in the original code.
+func (j *journal) revisionIndex(revid int) (int, error) {
+	idx := sort.Search(len(j.validRevisions), func(i int) bool {
+		return j.validRevisions[i].id >= revid
+	})
+	if idx == len(j.validRevisions) || j.validRevisions[idx].id != revid {
+		return 0, fmt.Errorf("revision id %v cannot be reverted", revid)
+	}
+	return idx, nil
+}
+
+// revert undoes a batch of journalled modifications along with any reverted
+// dirty handling too.
+// Original function: github.com/ethereum/go-ethereum/core/state/journal.go line 109
+func (j *journal) revert(statedb *StateDB, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		// Undo the changes made by the operation
+		j.entries[i].revert(statedb)
+
+		// Drop any dirty tracking induced by the change
+		if addr := j.entries[i].dirtied(); addr != nil {
+			if j.dirties[*addr]--; j.dirties[*addr] == 0 {
+				delete(j.dirties, *addr)
+			}
+		}
+	}
+	j.entries = j.entries[:snapshot]
+}
+
+// length returns the current number of entries in the journal.
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+func (j *journal) createObject(addr common.Address) {
+	j.append(createObjectChange{account: addr})
+}
+
+func (j *journal) createContract(addr common.Address) {
+	j.append(createContractChange{account: addr})
+}
+
+func (j *journal) destruct(addr common.Address) {
+	j.append(selfDestructChange{account: addr})
+}
+
+func (j *journal) refundChange(previous uint64) {
+	j.append(refundChange{prev: previous})
+}
+
+func (j *journal) touchChange(address common.Address) {
+	j.append(touchChange{
+		account: address,
+	})
+}
+
+func (j *journal) balanceChange(addr common.Address, previous *uint256.Int) {
+	j.append(balanceChange{
+		account: addr,
+		prev:    previous.Clone(),
+	})
+}
+
+func (j *journal) setCode(address common.Address, prevCode []byte) {
+	j.append(codeChange{
+		account:  address,
+		prevCode: prevCode,
+	})
+}
+
+func (j *journal) nonceChange(address common.Address, prev uint64) {
+	j.append(nonceChange{
+		account: address,
+		prev:    prev,
+	})
+}
+
 func (j *journal) storageChange(addr common.Address, key, prev, origin common.Hash) {
 	j.append(storageChange{
 		account:   addr,
@@ -43,6 +229,128 @@ func (j *journal) storageChange(addr common.Address, key, prev, origin common.Ha
 	})
 }
 
+func (j *journal) accessListAddAccount(addr common.Address) {
+	j.append(accessListAddAccountChange{addr})
+}
+
+func (j *journal) accessListAddSlot(addr common.Address, slot common.Hash) {
+	j.append(accessListAddSlotChange{
+		address: addr,
+		slot:    slot,
+	})
+}
+
+func (j *journal) transientStateChange(addr common.Address, key, prev common.Hash) {
+	j.append(transientStorageChange{
+		account:  addr,
+		key:      key,
+		prevalue: prev,
+	})
+}
+
+func (ch storageChange) revert(s *StateDB) {
+	s.getStateObject(ch.account).setState(ch.key, ch.prevvalue, ch.origvalue)
+}
+
 func (ch storageChange) dirtied() *common.Address {
 	return &ch.account
 }
+
+func (ch createObjectChange) revert(s *StateDB) {
+	delete(s.stateObjects, ch.account)
+}
+
+func (ch createObjectChange) dirtied() *common.Address {
+	return &ch.account
+}
+
+func (ch createContractChange) revert(s *StateDB) {
+	s.getStateObject(ch.account).newContract = false
+}
+
+func (ch createContractChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch selfDestructChange) revert(s *StateDB) {
+	obj := s.getStateObject(ch.account)
+	if obj != nil {
+		obj.selfDestructed = false
+	}
+}
+
+func (ch selfDestructChange) dirtied() *common.Address {
+	return &ch.account
+}
+
+func (ch balanceChange) revert(s *StateDB) {
+	s.getStateObject(ch.account).setBalance(ch.prev)
+}
+
+func (ch balanceChange) dirtied() *common.Address {
+	return &ch.account
+}
+
+func (ch nonceChange) revert(s *StateDB) {
+	s.getStateObject(ch.account).setNonce(ch.prev)
+}
+
+func (ch nonceChange) dirtied() *common.Address {
+	return &ch.account
+}
+
+func (ch codeChange) revert(s *StateDB) {
+	s.getStateObject(ch.account).setCode(crypto.Keccak256Hash(ch.prevCode), ch.prevCode)
+}
+
+func (ch codeChange) dirtied() *common.Address {
+	return &ch.account
+}
+
+func (ch transientStorageChange) revert(s *StateDB) {
+	s.setTransientState(ch.account, ch.key, ch.prevalue)
+}
+
+func (ch transientStorageChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch touchChange) revert(s *StateDB) {
+}
+
+func (ch touchChange) dirtied() *common.Address {
+	return &ch.account
+}
+
+func (ch refundChange) revert(s *StateDB) {
+	s.refund = ch.prev
+}
+
+func (ch refundChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch accessListAddAccountChange) revert(s *StateDB) {
+	/*
+		One important invariant here, is that whenever a (addr, slot) is added, if the
+		addr is not already present, the add causes two journal entries:
+		- one for the address,
+		- one for the (address,slot)
+		Therefore, when unrolling the change, we can always blindly delete the
+		(addr) at this point, since no storage adds can remain when come upon
+		a single (addr) change.
+	*/
+	s.accessList.DeleteAddress(ch.address)
+}
+
+func (ch accessListAddAccountChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch accessListAddSlotChange) revert(s *StateDB) {
+	s.accessList.DeleteSlot(ch.address, ch.slot)
+}
+
+func (ch accessListAddSlotChange) dirtied() *common.Address {
+	return nil
+}
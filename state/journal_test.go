@@ -0,0 +1,292 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/types"
+
+	"github.com/holiman/uint256"
+)
+
+// newTestState creates an empty state on top of an in-memory database.
+func newTestState(t *testing.T) *StateDB {
+	t.Helper()
+
+	state, err := New(types.EmptyRootHash, NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// Original function: github.com/ethereum/go-ethereum/core/state/state_test.go line 155
+func TestSnapshot(t *testing.T) {
+	stateobjaddr := common.BytesToAddress([]byte("aa"))
+	var storageaddr common.Hash
+	data1 := common.BytesToHash([]byte{42})
+	data2 := common.BytesToHash([]byte{43})
+	state := newTestState(t)
+
+	// snapshot the genesis state
+	genesis := state.Snapshot()
+
+	// set initial state object value
+	state.SetState(stateobjaddr, storageaddr, data1)
+	snapshot := state.Snapshot()
+
+	// set a new state object value, revert it and ensure correct content
+	state.SetState(stateobjaddr, storageaddr, data2)
+	state.RevertToSnapshot(snapshot)
+
+	if v := state.GetState(stateobjaddr, storageaddr); v != data1 {
+		t.Errorf("wrong storage value %v, want %v", v, data1)
+	}
+	if v := state.GetCommittedState(stateobjaddr, storageaddr); v != (common.Hash{}) {
+		t.Errorf("wrong committed storage value %v, want %v", v, common.Hash{})
+	}
+
+	// revert up to the genesis state and ensure correct content
+	state.RevertToSnapshot(genesis)
+	if v := state.GetState(stateobjaddr, storageaddr); v != (common.Hash{}) {
+		t.Errorf("wrong storage value %v, want %v", v, common.Hash{})
+	}
+	if v := state.GetCommittedState(stateobjaddr, storageaddr); v != (common.Hash{}) {
+		t.Errorf("wrong committed storage value %v, want %v", v, common.Hash{})
+	}
+}
+
+// Original function: github.com/ethereum/go-ethereum/core/state/state_test.go line 190
+func TestSnapshotEmpty(t *testing.T) {
+	state := newTestState(t)
+	state.RevertToSnapshot(state.Snapshot())
+}
+
+// Original function: github.com/ethereum/go-ethereum/core/state/state_test.go line 195
+func TestCreateObjectRevert(t *testing.T) {
+	state := newTestState(t)
+	addr := common.BytesToAddress([]byte("so0"))
+	snap := state.Snapshot()
+
+	state.CreateAccount(addr)
+	state.SetBalance(addr, uint256.NewInt(42))
+	state.SetNonce(addr, 43)
+	state.SetCode(addr, []byte{'c', 'a', 'f', 'e'})
+
+	state.RevertToSnapshot(snap)
+	if state.Exist(addr) {
+		t.Error("Unexpected account after revert")
+	}
+}
+
+// TestDeleteCreateRevert tests a weird state transition corner case that we hit
+// while changing the internals of StateDB. The workflow is that a contract is
+// self-destructed, then in a follow-up transaction (but same block) it's created
+// again and the transaction reverted.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb_test.go line 939
+func TestDeleteCreateRevert(t *testing.T) {
+	// Create an initial state with a single contract
+	state := newTestState(t)
+
+	addr := common.BytesToAddress([]byte("so"))
+	state.SetBalance(addr, uint256.NewInt(1))
+
+	root, _ := state.Commit(0, false)
+	state, _ = New(root, state.db)
+
+	// Simulate self-destructing in one transaction, then create-reverting in another
+	state.SelfDestruct(addr)
+	state.Finalise(true)
+
+	id := state.Snapshot()
+	state.SetBalance(addr, uint256.NewInt(2))
+	state.RevertToSnapshot(id)
+
+	// Commit the entire state and make sure we don't crash and have the correct state
+	root, _ = state.Commit(0, true)
+	state, _ = New(root, state.db)
+
+	if state.getStateObject(addr) != nil {
+		t.Fatalf("self-destructed contract came alive")
+	}
+}
+
+// accountView is everything a transaction can observe of an account.
+type accountView struct {
+	exists, destructed bool
+	balance            uint256.Int
+	nonce              uint64
+	code               string
+	slots              [2]common.Hash
+	committed          [2]common.Hash
+	transient          common.Hash
+	warm               bool
+	warmSlots          [2]bool
+}
+
+// Tests that reverting to a snapshot undoes every kind of change journalled
+// since, leaving the state as it was when the snapshot was taken.
+func TestJournalRevert(t *testing.T) {
+	var (
+		addr  = common.BytesToAddress([]byte("aa"))
+		other = common.BytesToAddress([]byte("bb"))
+		slots = [2]common.Hash{common.BytesToHash([]byte{1}), common.BytesToHash([]byte{2})}
+	)
+	view := func(state *StateDB) ([]accountView, uint64) {
+		var views []accountView
+		for _, a := range []common.Address{addr, other} {
+			v := accountView{
+				exists:     state.Exist(a),
+				destructed: state.HasSelfDestructed(a),
+				balance:    *state.GetBalance(a),
+				nonce:      state.GetNonce(a),
+				code:       string(state.GetCode(a)),
+				transient:  state.GetTransientState(a, slots[0]),
+				warm:       state.AddressInAccessList(a),
+			}
+			for i, slot := range slots {
+				v.slots[i] = state.GetState(a, slot)
+				v.committed[i] = state.GetCommittedState(a, slot)
+				_, v.warmSlots[i] = state.SlotInAccessList(a, slot)
+			}
+			views = append(views, v)
+		}
+		return views, state.GetRefund()
+	}
+	tests := []struct {
+		name   string
+		change func(state *StateDB)
+	}{
+		{"update slot", func(state *StateDB) { state.SetState(addr, slots[0], common.Hash{2}) }},
+		{"delete slot", func(state *StateDB) { state.SetState(addr, slots[0], common.Hash{}) }},
+		{"create slot", func(state *StateDB) { state.SetState(addr, slots[1], common.Hash{3}) }},
+		{"rewrite slot", func(state *StateDB) {
+			state.SetState(addr, slots[0], common.Hash{2})
+			state.SetState(addr, slots[0], common.Hash{3})
+			state.SetState(addr, slots[0], common.Hash{})
+		}},
+		{"set balance", func(state *StateDB) { state.SetBalance(addr, uint256.NewInt(2)) }},
+		{"add balance", func(state *StateDB) { state.AddBalance(addr, uint256.NewInt(2)) }},
+		{"sub balance", func(state *StateDB) { state.SubBalance(addr, uint256.NewInt(1)) }},
+		{"set nonce", func(state *StateDB) { state.SetNonce(addr, 2) }},
+		{"set code", func(state *StateDB) { state.SetCode(addr, []byte("edoc")) }},
+		{"create account", func(state *StateDB) {
+			state.CreateAccount(other)
+			state.SetBalance(other, uint256.NewInt(1))
+			state.SetState(other, slots[0], common.Hash{1})
+		}},
+		{"create contract", func(state *StateDB) {
+			state.CreateAccount(other)
+			state.CreateContract(other)
+			state.SetCode(other, []byte("code"))
+		}},
+		{"self-destruct", func(state *StateDB) { state.SelfDestruct(addr) }},
+		{"self-destruct twice", func(state *StateDB) {
+			state.SelfDestruct(addr)
+			state.AddBalance(addr, uint256.NewInt(5))
+			state.SelfDestruct(addr)
+		}},
+		{"transient storage", func(state *StateDB) { state.SetTransientState(addr, slots[0], common.Hash{1}) }},
+		{"refund", func(state *StateDB) { state.AddRefund(100) }},
+		{"access list address", func(state *StateDB) { state.AddAddressToAccessList(other) }},
+		{"access list slot", func(state *StateDB) { state.AddSlotToAccessList(addr, slots[0]) }},
+		{"access list slot of a cold address", func(state *StateDB) { state.AddSlotToAccessList(other, slots[1]) }},
+	}
+	for _, tt := range tests {
+		state := newTestState(t)
+		state.SetBalance(addr, uint256.NewInt(1))
+		state.SetNonce(addr, 1)
+		state.SetCode(addr, []byte("code"))
+		state.SetState(addr, slots[0], common.Hash{1})
+		root, err := state.Commit(0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, err = New(root, state.db); err != nil {
+			t.Fatal(err)
+		}
+		// Start from a transaction which already changed the state, so that
+		// the revert has to stop at the snapshot
+		state.SetState(addr, slots[1], common.Hash{4})
+		state.AddRefund(50)
+		state.AddAddressToAccessList(addr)
+
+		wantAccounts, wantRefund := view(state)
+		id := state.Snapshot()
+		tt.change(state)
+		if accounts, refund := view(state); reflect.DeepEqual(accounts, wantAccounts) && refund == wantRefund {
+			t.Fatalf("%s: the change has no effect", tt.name)
+		}
+		state.RevertToSnapshot(id)
+		accounts, refund := view(state)
+		if !reflect.DeepEqual(accounts, wantAccounts) {
+			t.Errorf("%s: accounts mismatch after revert:\nhave %+v\nwant %+v", tt.name, accounts, wantAccounts)
+		}
+		if refund != wantRefund {
+			t.Errorf("%s: refund mismatch after revert: have %d, want %d", tt.name, refund, wantRefund)
+		}
+	}
+}
+
+// Tests that nested snapshots are reverted innermost first: reverting the inner
+// one keeps the changes made before it, and the slots changed since a snapshot
+// are reported with the values it restores.
+func TestNestedRevert(t *testing.T) {
+	var (
+		state = newTestState(t)
+		addr  = common.BytesToAddress([]byte("aa"))
+		a, b  = common.BytesToHash([]byte{1}), common.BytesToHash([]byte{2})
+	)
+	outer := state.Snapshot()
+	state.SetState(addr, a, common.Hash{1})
+
+	inner := state.Snapshot()
+	state.SetState(addr, b, common.Hash{2})
+	state.SetState(addr, a, common.Hash{3})
+	state.SetState(addr, a, common.Hash{4})
+
+	want := []StorageChange{
+		{Address: addr, Key: b, Prev: common.Hash{}},
+		{Address: addr, Key: a, Prev: common.Hash{1}},
+	}
+	if have, err := state.StorageChangesSince(inner); err != nil || !reflect.DeepEqual(have, want) {
+		t.Fatalf("changes since the inner snapshot mismatch:\nhave %v, %v\nwant %v", have, err, want)
+	}
+	want = []StorageChange{
+		{Address: addr, Key: a, Prev: common.Hash{}},
+		{Address: addr, Key: b, Prev: common.Hash{}},
+	}
+	if have, err := state.StorageChangesSince(outer); err != nil || !reflect.DeepEqual(have, want) {
+		t.Fatalf("changes since the outer snapshot mismatch:\nhave %v, %v\nwant %v", have, err, want)
+	}
+
+	state.RevertToSnapshot(inner)
+	if have := state.GetState(addr, a); have != (common.Hash{1}) {
+		t.Fatalf("slot written before the inner snapshot reads %x after its revert", have)
+	}
+	if have := state.GetState(addr, b); have != (common.Hash{}) {
+		t.Fatalf("slot written after the inner snapshot reads %x after its revert", have)
+	}
+	// The inner snapshot is gone along with the changes
+	if _, err := state.StorageChangesSince(inner); err == nil {
+		t.Fatal("no error for the changes since a reverted snapshot")
+	}
+	if _, err := state.StorageChangesSince(inner + 100); err == nil {
+		t.Fatal("no error for the changes since an unknown snapshot")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("reverting to a reverted snapshot didn't panic")
+			}
+		}()
+		state.RevertToSnapshot(inner)
+	}()
+
+	state.RevertToSnapshot(outer)
+	if state.Exist(addr) {
+		t.Fatal("account created after the outer snapshot exists after its revert")
+	}
+}
@@ -1,10 +1,15 @@
 package state
 
 import (
+	"bytes"
 	"fmt"
+	"slices"
 	"storage_extract/common"
 	"storage_extract/crypto"
+	"storage_extract/trie/trienode"
 	"storage_extract/types"
+
+	"github.com/holiman/uint256"
 )
 
 // Storage represents a map of storage keys to their values.
@@ -19,8 +24,10 @@ type StateObject struct {
 	origin   *types.StateAccount // original state account
 	data     types.StateAccount  // Account data with all mutations applied in the scope of block
 
-	trie Trie // storage trie, which becomes non-nil on first access
+	trie Trie   // storage trie, which becomes non-nil on first access
+	code []byte // contract bytecode, which gets set when code is loaded
 
+	originStorage  Storage // Storage entries that have been accessed within the current block
 	dirtyStorage   Storage // dirty storage changes
 	pendingStorage Storage // Storage entries that have been modified within the current block
 
@@ -35,6 +42,32 @@ type StateObject struct {
 	// made within the block.
 
 	uncommittedStorage Storage
+
+	// deletedStorage holds the slots removed from the storage trie by the
+	// last updateTrie, i.e. the slots cleared to zero whose committed value
+	// was non-zero.
+	// Notice: This field is not included in the original code.
+	deletedStorage []common.Hash
+
+	// Cache flags.
+	dirtyCode bool // true if the code was updated
+
+	// Flag whether the account was marked as self-destructed. The self-destructed
+	// account is still accessible in the scope of same transaction.
+	selfDestructed bool
+
+	// This is an EIP-6780 flag indicating whether the object is eligible for
+	// self-destruct according to EIP-6780. The flag could be set either when
+	// the contract is just created within the current transaction, or when the
+	// object was previously existent and is being deployed as a contract within
+	// the current transaction.
+	newContract bool
+}
+
+// empty returns whether the account is considered empty.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 89
+func (s *StateObject) empty() bool {
+	return s.data.Nonce == 0 && s.data.Balance.IsZero() && bytes.Equal(s.data.CodeHash, types.EmptyCodeHash.Bytes())
 }
 
 // newObject creates a new state object with the given address and account.
@@ -51,16 +84,29 @@ func newObject(db *StateDB, addr common.Address, acct *types.StateAccount) *Stat
 		addrHash:           crypto.Keccak256Hash(addr[:]),
 		origin:             origin,
 		data:               *acct,
+		originStorage:      make(Storage),
 		dirtyStorage:       make(Storage),
 		uncommittedStorage: make(Storage),
 		pendingStorage:     make(Storage),
 	}
 }
 
+// markSelfdestructed flags the account as self-destructed, it's deleted along
+// with its storage at the end of the transaction.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 112
+func (s *StateObject) markSelfdestructed() {
+	s.selfDestructed = true
+}
+
+// touch marks the account as dirty without changing it, so that EIP-161 can
+// delete it at the end of the transaction if it's empty.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 116
+func (s *StateObject) touch() {
+	s.db.journal.touchChange(s.address)
+}
+
 // getTrie returns the associated storage trie. The trie will be opened if it's
 // not loaded previously. An error will be returned if trie can't be loaded.
-//
-// TODO: Support read trie from the database and triedb parameter.
 // Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 124
 func (s *StateObject) getTrie() (Trie, error) {
 	if s.trie == nil {
@@ -102,11 +148,28 @@ func (s *StateObject) getState(key common.Hash) (common.Hash, common.Hash) {
 // without any mutations caused in the current execution.
 // Orignal function: github.com/ethereum/go-ethereum/core/state/state_object.go line 170
 func (s *StateObject) GetCommittedState(key common.Hash) common.Hash {
+	// If we have a pending write or clean cached, return that
 	if value, pending := s.pendingStorage[key]; pending {
 		return value
 	}
-	// TODO: follow the original code and read from the database, the current implementation only read from the pendingStorage
-	return common.Hash{}
+	if value, cached := s.originStorage[key]; cached {
+		return value
+	}
+	// The snapshot is not supported, load the slot from the storage trie.
+	tr, err := s.getTrie()
+	if err != nil {
+		s.db.setError(err)
+		return common.Hash{}
+	}
+	val, err := tr.GetStorage(s.address, key.Bytes())
+	if err != nil {
+		s.db.setError(err)
+		return common.Hash{}
+	}
+	var value common.Hash
+	value.SetBytes(val)
+	s.originStorage[key] = value
+	return value
 }
 
 // SetState updates a value in account storage.
@@ -156,8 +219,7 @@ func (s *StateObject) finalise() {
 		} else {
 			// The slot is different from its original value and hasn't been
 			// tracked for commit yet.
-			// TODO: Get committed state from the database
-			s.uncommittedStorage[key] = common.Hash{}
+			s.uncommittedStorage[key] = s.GetCommittedState(key)
 		}
 		// Aggregate the dirty storage slots into the pending area. It might
 		// be possible that the value of tracked slot here is same with the
@@ -173,8 +235,10 @@ func (s *StateObject) finalise() {
 	if len(s.dirtyStorage) > 0 {
 		s.dirtyStorage = make(Storage) // Reset the dirty storage
 	}
-
-	// s.newContract = false (may not needed)
+	// Revoke the flag at the end of the transaction. It finalizes the status
+	// of the newly-created object as it's no longer eligible for self-destruct
+	// by EIP-6780. For non-newly-created objects, it's a no-op.
+	s.newContract = false
 }
 
 // updateTrie is responsible for persisting cached storage changes into the
@@ -188,6 +252,9 @@ func (s *StateObject) finalise() {
 func (s *StateObject) updateTrie() (Trie, error) {
 	// The logic is different from the original code where it checks witness of db
 
+	// Reset the deletions reported by the previous update
+	s.deletedStorage = nil
+
 	if len(s.uncommittedStorage) == 0 {
 		// Short circuit if nothing changed, don't bother with hashing anything
 		return s.trie, nil
@@ -195,17 +262,22 @@ func (s *StateObject) updateTrie() (Trie, error) {
 	var err error
 	tr, err := s.getTrie()
 	if err != nil {
-		// TODO: handle error (db)
+		s.db.setError(err)
 		return nil, err
 	}
-	// 	var (
-	// 	deletions []common.Hash
-	// 	used      = make([]common.Hash, 0, len(s.uncommittedStorage))
-	// ) (Not used in the current implementation)
-
-	// The logic of handling updates is different from the original code.
-	// The process of checking whether the value is same as the original value is ignored for now.
+	// Perform trie updates before deletions. This prevents resolution of unnecessary trie nodes
+	// in circumstances similar to the following:
+	//
+	// Consider nodes `A` and `B` who share the same full node parent `P` and have no other siblings.
+	// During the execution of a block:
+	// - `A` is deleted,
+	// - `C` is created, and also shares the parent `P`.
+	// If the deletion is handled first, then `P` would be left with only one child, thus collapsed
+	// into a shortnode. This requires `B` to be resolved from disk.
+	// Whereas if the created node is handled first, then the collapse is avoided, and `B` is not resolved.
+	var deletions []common.Hash
 	for key, origin := range s.uncommittedStorage {
+		// Skip noop changes, persist actual changes
 		value, exist := s.pendingStorage[key]
 		fmt.Println("Updating storage for key:", key, "Origin:", origin, "Value:", value, "Exist:", exist)
 		if value == origin {
@@ -216,12 +288,22 @@ func (s *StateObject) updateTrie() (Trie, error) {
 		}
 		if (value != common.Hash{}) {
 			if err := tr.UpdateStorage(s.address, key[:], common.TrimLeftZeroes(value[:])); err != nil {
-				// TODO: handle error (s.db.setError(err))
+				s.db.setError(err)
 				return nil, err
 			}
+			s.db.StorageUpdated.Add(1)
+		} else {
+			deletions = append(deletions, key)
+		}
+	}
+	for _, key := range deletions {
+		if err := tr.DeleteStorage(s.address, key[:]); err != nil {
+			s.db.setError(err)
+			return nil, err
 		}
+		s.db.StorageDeleted.Add(1)
 	}
-	// TODO: handle deletions
+	s.deletedStorage = deletions
 	s.uncommittedStorage = make(Storage) // empties the commit markers
 	return tr, nil
 }
@@ -246,11 +328,191 @@ func (s *StateObject) updateRoot() {
 	s.data.Root = tr.Hash()
 }
 
+// commitStorage overwrites the clean storage with the storage changes and
+// reports whether any slot was actually changed. The pending area is
+// emptied afterwards.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 378
+func (s *StateObject) commitStorage() bool {
+	changed := false
+	for key, val := range s.pendingStorage {
+		// Skip the noop storage changes, it might be possible the value
+		// of tracked slot is same in originStorage and pendingStorage
+		// map, e.g. the storage slot is modified in tx_a and then reset
+		// back in tx_b.
+		if val == s.originStorage[key] {
+			continue
+		}
+		changed = true
+
+		// Overwrite the clean value of storage slots
+		s.originStorage[key] = val
+	}
+	s.pendingStorage = make(Storage)
+	return changed
+}
+
+// commit obtains the account changes (metadata, storage slots, code) caused by
+// state execution along with the dirty storage trie nodes.
+//
+// Note, commit may run concurrently across all the state objects. Do not assume
+// thread-safe access to the statedb.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 424
+func (s *StateObject) commit() (*accountUpdate, *trienode.NodeSet, error) {
+	// commit the account metadata changes
+	op := &accountUpdate{
+		address: s.address,
+	}
+	// commit the contract code if it's modified
+	if s.dirtyCode {
+		op.code = &contractCode{
+			hash: common.BytesToHash(s.CodeHash()),
+			blob: s.code,
+		}
+		s.dirtyCode = false // reset the dirty flag
+	}
+	// Commit storage changes and the associated storage trie
+	if !s.commitStorage() {
+		// nothing changed, don't bother to commit the trie
+		s.origin = s.data.Copy()
+		return op, nil, nil
+	}
+	root, nodes := s.trie.Commit(false)
+	s.data.Root = root
+	s.origin = s.data.Copy()
+	return op, nodes, nil
+}
+
+// AddBalance adds amount to s's balance.
+// It is used to add funds to the destination account of a transfer.
+// returns the previous balance
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 457
+func (s *StateObject) AddBalance(amount *uint256.Int) uint256.Int {
+	// EIP161: We must check emptiness for the objects such that the account
+	// clearing (0,0,0 objects) can take effect.
+	if amount.IsZero() {
+		if s.empty() {
+			s.touch()
+		}
+		return *(s.Balance())
+	}
+	return s.SetBalance(new(uint256.Int).Add(s.Balance(), amount))
+}
+
+// SetBalance sets the balance for the object, and returns the previous balance.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 470
+func (s *StateObject) SetBalance(amount *uint256.Int) uint256.Int {
+	prev := *s.data.Balance
+	s.db.journal.balanceChange(s.address, s.data.Balance)
+	s.setBalance(amount)
+	return prev
+}
+
+func (s *StateObject) setBalance(amount *uint256.Int) {
+	s.data.Balance = amount
+}
+
+//
+// Attribute accessors
+//
+
+// Address returns the address of the contract/account
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 508
+func (s *StateObject) Address() common.Address {
+	return s.address
+}
+
+// Code returns the contract code associated with this object, if any.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 513
+func (s *StateObject) Code() []byte {
+	if len(s.code) != 0 {
+		return s.code
+	}
+	if bytes.Equal(s.CodeHash(), types.EmptyCodeHash.Bytes()) {
+		return nil
+	}
+	code, err := s.db.db.ContractCode(s.address, common.BytesToHash(s.CodeHash()))
+	if err != nil {
+		s.db.setError(fmt.Errorf("can't load code hash %x: %v", s.CodeHash(), err))
+	}
+	if len(code) == 0 {
+		s.db.setError(fmt.Errorf("code is not found %x", s.CodeHash()))
+	}
+	s.code = code
+	return code
+}
+
+// CodeSize returns the size of the contract code associated with this object,
+// or zero if none.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 534
+func (s *StateObject) CodeSize() int {
+	if len(s.code) != 0 {
+		return len(s.code)
+	}
+	if bytes.Equal(s.CodeHash(), types.EmptyCodeHash.Bytes()) {
+		return 0
+	}
+	size, err := s.db.db.ContractCodeSize(s.address, common.BytesToHash(s.CodeHash()))
+	if err != nil {
+		s.db.setError(fmt.Errorf("can't load code size %x: %v", s.CodeHash(), err))
+	}
+	if size == 0 {
+		s.db.setError(fmt.Errorf("code is not found %x", s.CodeHash()))
+	}
+	return size
+}
+
+// SetCode sets the contract code of the object, and returns the previous code.
+// Different from the original code, the previous code is loaded from the
+// database if it's not cached yet, so that a revert restores it correctly.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 551
+func (s *StateObject) SetCode(codeHash common.Hash, code []byte) (prev []byte) {
+	prev = slices.Clone(s.Code())
+	s.db.journal.setCode(s.address, prev)
+	s.setCode(codeHash, code)
+	return prev
+}
+
+func (s *StateObject) setCode(codeHash common.Hash, code []byte) {
+	s.code = code
+	s.data.CodeHash = codeHash[:]
+	s.dirtyCode = true
+}
+
+// SetNonce sets the nonce of the object.
+// Original function: github.com/ethereum/go-ethereum/core/state/state_object.go line 564
+func (s *StateObject) SetNonce(nonce uint64) {
+	s.db.journal.nonceChange(s.address, s.data.Nonce)
+	s.setNonce(nonce)
+}
+
+func (s *StateObject) setNonce(nonce uint64) {
+	s.data.Nonce = nonce
+}
+
+// CodeHash returns the hash of the contract code.
+func (s *StateObject) CodeHash() []byte {
+	return s.data.CodeHash
+}
+
+// Balance returns the balance of the account.
+func (s *StateObject) Balance() *uint256.Int {
+	return s.data.Balance
+}
+
+// Nonce returns the nonce of the account.
+func (s *StateObject) Nonce() uint64 {
+	return s.data.Nonce
+}
+
 //------------------------------------------------------------------------------------------------------------------------
 // Below are the additional methods that are not part of the original code but used in the test code snippet.
 
-// GetAddress returns the address of the state object.
+// GetTrie returns the storage trie of the state object, opening it from the
+// database if it's not loaded yet, e.g. after the state was committed.
 func (s *StateObject) GetTrie() *Trie {
+	if _, err := s.getTrie(); err != nil {
+		s.db.setError(err)
+	}
 	return &s.trie
 }
 
@@ -258,3 +520,9 @@ func (s *StateObject) GetTrie() *Trie {
 func (s *StateObject) GetRoot() common.Hash {
 	return s.data.Root
 }
+
+// DeletedStorage returns the slots removed from the storage trie by the last
+// trie update, in the order they were deleted.
+func (s *StateObject) DeletedStorage() []common.Hash {
+	return s.deletedStorage
+}
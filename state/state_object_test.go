@@ -0,0 +1,68 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/types"
+)
+
+// Tests that zeroing a committed slot deletes it from the storage trie: the
+// slot is reported as deleted by the trie update, isn't in the committed trie,
+// and the storage root is the one of a trie built without it. Zeroing a slot
+// which is already zero in the trie deletes nothing.
+func TestDeletedStorage(t *testing.T) {
+	var (
+		addr               = common.BytesToAddress([]byte("aa"))
+		kept1, gone, kept2 = common.BytesToHash([]byte{1}), common.BytesToHash([]byte{2}), common.BytesToHash([]byte{3})
+		zero, transient    = common.BytesToHash([]byte{4}), common.BytesToHash([]byte{5})
+	)
+	state := newTestState(t)
+	for _, key := range []common.Hash{kept1, gone, kept2} {
+		state.SetState(addr, key, common.Hash{1})
+	}
+	root, err := state.Commit(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err = New(root, state.db); err != nil {
+		t.Fatal(err)
+	}
+	state.SetState(addr, gone, common.Hash{})
+	state.SetState(addr, zero, common.Hash{})
+	state.SetState(addr, transient, common.Hash{1})
+	state.SetState(addr, transient, common.Hash{})
+	state.IntermediateRoot(false)
+
+	if have, want := state.GetStateObject(addr).DeletedStorage(), []common.Hash{gone}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("deleted slots mismatch: have %x, want %x", have, want)
+	}
+	if root, err = state.Commit(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if state, err = New(root, state.db); err != nil {
+		t.Fatal(err)
+	}
+	result, err := state.StorageRange(addr, common.Hash{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Storage[crypto.Keccak256Hash(gone[:])]; ok {
+		t.Fatal("deleted slot still in the storage trie")
+	}
+	if len(result.Storage) != 2 {
+		t.Fatalf("slot count mismatch: have %d, want 2", len(result.Storage))
+	}
+
+	// The storage root is the one of the trie built without the slot
+	expect := newTestState(t)
+	for _, key := range []common.Hash{kept1, kept2} {
+		expect.SetState(addr, key, common.Hash{1})
+	}
+	expect.IntermediateRoot(false)
+	if have, want := state.GetStorageRoot(addr), expect.GetStorageRoot(addr); have != want || have == types.EmptyRootHash {
+		t.Fatalf("storage root mismatch: have %x, want %x", have, want)
+	}
+}
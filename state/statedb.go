@@ -1,9 +1,22 @@
 package state
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
 	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/rawdb"
+	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/types"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/uint256"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -25,8 +38,35 @@ func (m *mutation) isDelete() bool {
 
 type StateDB struct {
 	db           Database
+	trie         Trie
 	stateObjects map[common.Address]*StateObject
-	journal      *journal
+
+	// This map holds 'deleted' objects. An object with the same address
+	// might also occur in the 'stateObjects' map due to account
+	// resurrection. The account value is tracked as the original value
+	// before the transition. This map is populated at the transaction
+	// boundaries.
+	stateObjectsDestruct map[common.Address]*StateObject
+
+	journal *journal
+
+	// The refund counter, also used by state transitioning.
+	refund uint64
+
+	// Per-transaction access list
+	accessList *accessList
+
+	// Transient storage
+	transientStorage transientStorage
+
+	// DB error.
+	// State objects are used by the consensus core and VM which are
+	// unable to deal with database-level errors. Any error that occurs
+	// during a database read is memoized here and will eventually be
+	// returned by StateDB.Commit. Notably, this error is also shared
+	// by all cached state objects in case the database failure occurs
+	// when accessing state of accounts.
+	dbErr error
 
 	// originalRoot is the pre-state root, before any changes were made.
 	// It will be updated when the Commit is called.
@@ -38,23 +78,305 @@ type StateDB struct {
 	// perspective. This map is populated at the transaction boundaries.
 	mutations map[common.Address]*mutation
 
+	AccountUpdates time.Duration // Time taken for account updates
+	AccountHashes  time.Duration // Time taken for account trie hashing
+	AccountCommits time.Duration // Time taken for account commits
 	StorageUpdates time.Duration // Time taken for storage updates
+	StorageCommits time.Duration // Time taken for storage commits
+	TrieDBCommits  time.Duration // Time taken for trie database commits
+
+	StorageUpdated atomic.Int64 // Number of storage slots updated in the storage tries
+	StorageDeleted atomic.Int64 // Number of storage slots deleted from the storage tries
 }
 
 // New creates a new state from a given trie.
 // Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 161
 func New(root common.Hash, db Database) (*StateDB, error) {
-	// Current implementation ignored the trie loading and doesn't support many elements used in the original code.
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	// Current implementation doesn't support many elements used in the original code (e.g. state reader).
 	sdb := &StateDB{
-		db:           db,
-		stateObjects: make(map[common.Address]*StateObject),
-		journal:      newJournal(),
-		mutations:    make(map[common.Address]*mutation),
-		originalRoot: root,
+		db:                   db,
+		trie:                 tr,
+		stateObjects:         make(map[common.Address]*StateObject),
+		stateObjectsDestruct: make(map[common.Address]*StateObject),
+		journal:              newJournal(),
+		accessList:           newAccessList(),
+		transientStorage:     newTransientStorage(),
+		mutations:            make(map[common.Address]*mutation),
+		originalRoot:         root,
 	}
 	return sdb, nil
 }
 
+// setError remembers the first non-nil error it is called with.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 226
+func (s *StateDB) setError(err error) {
+	if s.dbErr == nil {
+		s.dbErr = err
+	}
+}
+
+// Error returns the memorized database failure occurred earlier.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 233
+func (s *StateDB) Error() error {
+	return s.dbErr
+}
+
+// AddRefund adds gas to the refund counter
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 279
+func (s *StateDB) AddRefund(gas uint64) {
+	s.journal.refundChange(s.refund)
+	s.refund += gas
+}
+
+// SubRefund removes gas from the refund counter.
+// This method will panic if the refund counter goes below zero
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 286
+func (s *StateDB) SubRefund(gas uint64) {
+	s.journal.refundChange(s.refund)
+	if gas > s.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", gas, s.refund))
+	}
+	s.refund -= gas
+}
+
+// Exist reports whether the given account address exists in the state.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 296
+func (s *StateDB) Exist(addr common.Address) bool {
+	return s.getStateObject(addr) != nil
+}
+
+// Empty returns whether the state object is either non-existent
+// or empty according to the EIP161 specification (balance = nonce = code = 0)
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 302
+func (s *StateDB) Empty(addr common.Address) bool {
+	so := s.getStateObject(addr)
+	return so == nil || so.empty()
+}
+
+// GetBalance retrieves the balance from the given address or 0 if object not found
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 308
+func (s *StateDB) GetBalance(addr common.Address) *uint256.Int {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.Balance()
+	}
+	return new(uint256.Int)
+}
+
+// GetNonce retrieves the nonce from the given address or 0 if object not found
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 317
+func (s *StateDB) GetNonce(addr common.Address) uint64 {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.Nonce()
+	}
+
+	return 0
+}
+
+// GetCode retrieves the contract code of the given address or nil if object
+// not found.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 341
+func (s *StateDB) GetCode(addr common.Address) []byte {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.Code()
+	}
+	return nil
+}
+
+// GetCodeSize retrieves the contract code size of the given address or 0 if
+// object not found.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 352
+func (s *StateDB) GetCodeSize(addr common.Address) int {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.CodeSize()
+	}
+	return 0
+}
+
+// GetCodeHash retrieves the contract code hash of the given address or the
+// zero hash if object not found.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 363
+func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return common.BytesToHash(stateObject.CodeHash())
+	}
+	return common.Hash{}
+}
+
+// GetStorageRoot retrieves the storage root from the given address or empty
+// if object not found.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 328
+func (s *StateDB) GetStorageRoot(addr common.Address) common.Hash {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.GetRoot()
+	}
+	return common.Hash{}
+}
+
+// AddBalance adds amount to the account associated with addr.
+// Different from the original code, the balance change reason used by the
+// tracers is omitted.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 408
+func (s *StateDB) AddBalance(addr common.Address, amount *uint256.Int) uint256.Int {
+	stateObject := s.getOrNewStateObject(addr)
+	if stateObject == nil {
+		return uint256.Int{}
+	}
+	return stateObject.AddBalance(amount)
+}
+
+// SubBalance subtracts amount from the account associated with addr.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 417
+func (s *StateDB) SubBalance(addr common.Address, amount *uint256.Int) uint256.Int {
+	stateObject := s.getOrNewStateObject(addr)
+	if stateObject == nil {
+		return uint256.Int{}
+	}
+	if amount.IsZero() {
+		return *(stateObject.Balance())
+	}
+	return stateObject.SetBalance(new(uint256.Int).Sub(stateObject.Balance(), amount))
+}
+
+// SetBalance sets the balance of the account associated with addr.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 428
+func (s *StateDB) SetBalance(addr common.Address, amount *uint256.Int) {
+	stateObject := s.getOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetBalance(amount)
+	}
+}
+
+// SetNonce sets the nonce of the account associated with addr.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 435
+func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
+	stateObject := s.getOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetNonce(nonce)
+	}
+}
+
+// SetCode sets the contract code of the account associated with addr, and
+// returns the previous code.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 442
+func (s *StateDB) SetCode(addr common.Address, code []byte) (prev []byte) {
+	stateObject := s.getOrNewStateObject(addr)
+	if stateObject != nil {
+		return stateObject.SetCode(crypto.Keccak256Hash(code), code)
+	}
+	return nil
+}
+
+// GetState retrieves the value associated with the specific key.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 372
+func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.GetState(hash)
+	}
+	return common.Hash{}
+}
+
+// GetCommittedState retrieves the value associated with the specific key
+// without any mutations caused in the current execution.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 382
+func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.GetCommittedState(hash)
+	}
+	return common.Hash{}
+}
+
+// HasSelfDestructed reports whether the account was marked as self-destructed
+// in the current transaction.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 395
+func (s *StateDB) HasSelfDestructed(addr common.Address) bool {
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.selfDestructed
+	}
+	return false
+}
+
+// SelfDestruct marks the given account as selfdestructed.
+// This clears the account balance.
+//
+// The account's state object is still available until the state is committed,
+// getStateObject will return a non-nil account after SelfDestruct.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 491
+func (s *StateDB) SelfDestruct(addr common.Address) uint256.Int {
+	stateObject := s.getStateObject(addr)
+	var prevBalance uint256.Int
+	if stateObject == nil {
+		return prevBalance
+	}
+	prevBalance = *(stateObject.Balance())
+	// Regardless of whether it is already destructed or not, we do have to
+	// journal the balance-change, if we set it to zero here.
+	if !stateObject.Balance().IsZero() {
+		stateObject.SetBalance(new(uint256.Int))
+	}
+	// If it is already marked as self-destructed, we do not need to add it
+	// for journalling a second time.
+	if !stateObject.selfDestructed {
+		s.journal.destruct(addr)
+		stateObject.markSelfdestructed()
+	}
+	return prevBalance
+}
+
+// SelfDestruct6780 marks the given account as selfdestructed following the
+// EIP-6780 rules, only the contracts created in the same transaction are
+// actually destructed. It returns the balance of the account and whether the
+// account was destructed.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 512
+func (s *StateDB) SelfDestruct6780(addr common.Address) (uint256.Int, bool) {
+	stateObject := s.getStateObject(addr)
+	if stateObject == nil {
+		return uint256.Int{}, false
+	}
+	if stateObject.newContract {
+		return s.SelfDestruct(addr), true
+	}
+	return *(stateObject.Balance()), false
+}
+
+// SetTransientState sets transient storage for a given account. It
+// adds the change to the journal so that it can be rolled back
+// to its previous value if there is a revert.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 526
+func (s *StateDB) SetTransientState(addr common.Address, key, value common.Hash) {
+	prev := s.GetTransientState(addr, key)
+	if prev == value {
+		return
+	}
+	s.journal.transientStateChange(addr, key, prev)
+	s.setTransientState(addr, key, value)
+}
+
+// setTransientState is a lower level setter for transient storage. It
+// is called during a revert to prevent modifications to the journal.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 537
+func (s *StateDB) setTransientState(addr common.Address, key, value common.Hash) {
+	s.transientStorage.Set(addr, key, value)
+}
+
+// GetTransientState gets transient storage for a given account.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 542
+func (s *StateDB) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.transientStorage.Get(addr, key)
+}
+
 // SetState sets the state of the given address and key to the given value.
 // It retrieves the state object for the address, and if it doesn't exist, it creates a new one.
 // Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 450
@@ -65,16 +387,57 @@ func (s *StateDB) SetState(addr common.Address, key, value common.Hash) common.H
 	return common.Hash{}
 }
 
-// getStateObject retrieves the state object for the given address.
+// updateStateObject writes the given object to the trie.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 551
+func (s *StateDB) updateStateObject(obj *StateObject) {
+	// Encode the account and update the account trie
+	addr := obj.address
+	if err := s.trie.UpdateAccount(addr, &obj.data); err != nil {
+		s.setError(fmt.Errorf("updateStateObject (%x) error: %v", addr[:], err))
+	}
+}
+
+// deleteStateObject removes the given object from the state trie.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 563
+func (s *StateDB) deleteStateObject(addr common.Address) {
+	if err := s.trie.DeleteAccount(addr); err != nil {
+		s.setError(fmt.Errorf("deleteStateObject (%x) error: %v", addr[:], err))
+	}
+}
+
+// getStateObject retrieves a state object given by the address, returning nil if
+// the object is not found.
+// Different from the original code, the account is read from the account trie
+// directly since the state reader and the prefetcher are not implemented.
 // Orginal function: github.com/ethereum/go-ethereum/core/state/statedb.go line 573
 func (s *StateDB) getStateObject(addr common.Address) *StateObject {
+	// Prefer live objects if any is available
 	if obj := s.stateObjects[addr]; obj != nil {
 		return obj
 	}
-	// TODO: The current implementation only checks the stateObjects map.
-	// in the original code, it reads from the database if the object is not found.
-	// If the account found in the database, it will be added to the prefetch list and insert into the stateObjects map.
-	return nil
+	// Short circuit if the account is already destructed in this block.
+	if _, ok := s.stateObjectsDestruct[addr]; ok {
+		return nil
+	}
+	acct, err := s.trie.GetAccount(addr)
+	if err != nil {
+		s.setError(fmt.Errorf("getStateObject (%x) error: %w", addr.Bytes(), err))
+		return nil
+	}
+	// Short circuit if the account is not found
+	if acct == nil {
+		return nil
+	}
+	// Insert into the live set
+	obj := newObject(s, addr, acct)
+	s.setStateObject(obj)
+	return obj
+}
+
+// setStateObject inserts the state object into the live set.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 606
+func (s *StateDB) setStateObject(object *StateObject) {
+	s.stateObjects[object.address] = object
 }
 
 // getOrNewStateObject retrieves a state object or create a new state object if nil.
@@ -92,15 +455,52 @@ func (s *StateDB) getOrNewStateObject(addr common.Address) *StateObject {
 // Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 622
 func (s *StateDB) createObject(addr common.Address) *StateObject {
 	obj := newObject(s, addr, nil)
-	//TODO: s.journal.createObject(addr)
-	// Current implementation: add the object to the stateObjects map
-	// This is different from the original code,
-	// where calls another function (setStateObject) to add the object to the stateObjects map.
-	// Here, directly add it to the map.
-	s.stateObjects[addr] = obj
+	s.journal.createObject(addr)
+	s.setStateObject(obj)
 	return obj
 }
 
+// CreateAccount explicitly creates a new state object, assuming that the
+// account did not previously exist in the state. If the account already
+// exists, this function will silently overwrite it which might lead to a
+// consensus bug eventually.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 632
+func (s *StateDB) CreateAccount(addr common.Address) {
+	s.createObject(addr)
+}
+
+// CreateContract is used whenever a contract is created. This may be preceded
+// by CreateAccount, but that is not required if it already existed in the
+// state due to funds sent beforehand.
+// This operation sets the 'newContract'-flag, which is required in order to
+// correctly handle EIP-6780 'delete-in-same-transaction' logic.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 641
+func (s *StateDB) CreateContract(addr common.Address) {
+	obj := s.getStateObject(addr)
+	if !obj.newContract {
+		obj.newContract = true
+		s.journal.createContract(addr)
+	}
+}
+
+// Snapshot returns an identifier for the current revision of the state.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 711
+func (s *StateDB) Snapshot() int {
+	return s.journal.snapshot()
+}
+
+// RevertToSnapshot reverts all state changes made since the given revision.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 716
+func (s *StateDB) RevertToSnapshot(revid int) {
+	s.journal.revertToSnapshot(revid, s)
+}
+
+// GetRefund returns the current value of the refund counter.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 721
+func (s *StateDB) GetRefund() uint64 {
+	return s.refund
+}
+
 // Finalise finalises the state by removing the destructed objects and clears
 // the journal as well as the refunds. Finalise, however, will not push any updates
 // into the tries just yet. Only IntermediateRoot or Commit will do that.
@@ -112,11 +512,30 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 		if !exist {
 			continue
 		}
-		// TODO: delete logic
-		obj.finalise()
-		s.markUpdate(addr)
+		if obj.selfDestructed || (deleteEmptyObjects && obj.empty()) {
+			delete(s.stateObjects, obj.address)
+			s.markDelete(addr)
+			// We need to maintain account deletions explicitly (will remain
+			// set indefinitely). Note only the first occurred self-destruct
+			// event is tracked.
+			if _, ok := s.stateObjectsDestruct[obj.address]; !ok {
+				s.stateObjectsDestruct[obj.address] = obj
+			}
+		} else {
+			obj.finalise()
+			s.markUpdate(addr)
+		}
 	}
-	// TODO: Clear the journal
+	// Invalidate journal because reverting across transactions is not allowed.
+	s.journal.reset()
+	s.refund = 0
+
+	// Different from the original code, the access list and the transient
+	// storage are discarded here at the end of the transaction instead of in
+	// Prepare at the start of the next one, since there is no transaction
+	// processing to call it.
+	s.accessList = newAccessList()
+	s.transientStorage = newTransientStorage()
 }
 
 // IntermediateRoot computes the current root hash of the state trie.
@@ -153,27 +572,227 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	s.StorageUpdates += time.Since(start)
 
 	// Trie prefetching is not implemented in the current version.
+	start = time.Now()
+
+	// Perform updates before deletions.  This prevents resolution of unnecessary trie nodes
+	// in circumstances similar to the following:
+	//
+	// Consider nodes `A` and `B` who share the same full node parent `P` and have no other siblings.
+	// During the execution of a block:
+	// - `A` self-destructs,
+	// - `C` is created, and also shares the parent `P`.
+	// If the self-destruct is handled first, then `P` would be left with only one child, thus collapsed
+	// into a shortnode. This requires `B` to be resolved from disk.
+	// Whereas if the created node is handled first, then the collapse is avoided, and `B` is not resolved.
+	var deletedAddrs []common.Address
+	for addr, op := range s.mutations {
+		if op.applied {
+			continue
+		}
+		op.applied = true
 
-	// var (
-	// 	usedAddrs    []common.Address
-	// 	deletedAddrs []common.Address
-	//) (not needed for now)
+		if op.isDelete() {
+			deletedAddrs = append(deletedAddrs, addr)
+		} else {
+			s.updateStateObject(s.stateObjects[addr])
+		}
+	}
+	for _, deletedAddr := range deletedAddrs {
+		s.deleteStateObject(deletedAddr)
+	}
+	s.AccountUpdates += time.Since(start)
 
-	// TODO: Perform updates for Accounts' state
-	// for addr, op := range s.mutations {
-	// }
+	// Track the amount of time wasted on hashing the account trie
+	defer func(start time.Time) { s.AccountHashes += time.Since(start) }(time.Now())
 
-	return common.Hash{}
+	return s.trie.Hash()
+}
+
+// deleteStorage is designed to delete the storage trie of a designated account.
+// All the nodes of the trie are marked as deleted in the returned node set.
+//
+// Different from the original code, there is no state snapshot, so the
+// persisted nodes are always collected by iterating the storage trie (the
+// slowDeleteStorage strategy of the original code), and the deleted slots
+// are not tracked since there is no state history to feed.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 976 (slowDeleteStorage)
+func (s *StateDB) deleteStorage(addr common.Address, addrHash common.Hash, root common.Hash) (*trienode.NodeSet, error) {
+	tr, err := s.db.OpenStorageTrie(s.originalRoot, addr, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage trie, err: %w", err)
+	}
+	it, err := tr.NodeIterator(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage iterator, err: %w", err)
+	}
+	nodes := trienode.NewNodeSet(addrHash) // the set for trie node mutations (value is nil)
+	for it.Next(true) {
+		if it.Leaf() {
+			continue
+		}
+		if it.Hash() == (common.Hash{}) {
+			continue
+		}
+		nodes.AddNode(it.Path(), trienode.NewDeleted())
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// handleDestruction processes all destruction markers and deletes the account
+// and associated storage slots if necessary. There are four potential scenarios
+// as following:
+//
+//	(a) the account was not existent and be marked as destructed
+//	(b) the account was not existent and be marked as destructed,
+//	    however, it's resurrected later in the same block.
+//	(c) the account was existent and be marked as destructed
+//	(d) the account was existent and be marked as destructed,
+//	    however it's resurrected later in the same block.
+//
+// In case (a), nothing needs be deleted, nil to nil transition can be ignored.
+// In case (b), nothing needs be deleted, nil is used as the original value for
+// newly created account and storages
+// In case (c), **original** account along with its storages should be deleted,
+// with their values be tracked as original value.
+// In case (d), **original** account along with its storages should be deleted,
+// with their values be tracked as original value.
+//
+// Different from the original code, only the node deletions of the storage
+// tries are returned, the account trie is already updated in IntermediateRoot.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1053
+func (s *StateDB) handleDestruction() ([]*trienode.NodeSet, error) {
+	var nodes []*trienode.NodeSet
+	for addr, prevObj := range s.stateObjectsDestruct {
+		prev := prevObj.origin
+
+		// The account was non-existent, and it's marked as destructed in the scope
+		// of block. It can be either case (a) or (b) and will be interpreted as
+		// null->null state transition.
+		// - for (a), skip it without doing anything
+		// - for (b), the resurrected account with nil as original will be handled afterwards
+		if prev == nil {
+			continue
+		}
+		// Short circuit if the origin storage was empty.
+		if prev.Root == types.EmptyRootHash {
+			continue
+		}
+		// Remove storage slots belonging to the account.
+		set, err := s.deleteStorage(addr, prevObj.addrHash, prev.Root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete storage, err: %w", err)
+		}
+		// Aggregate the associated trie node changes.
+		nodes = append(nodes, set)
+	}
+	return nodes, nil
 }
 
 // commit gathers the state mutations accumulated along with the associated
 // trie changes, resetting all internal flags with the new state as the base.
 // Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1100
 func (s *StateDB) commit(deleteEmptyObjects bool) (*stateUpdate, error) {
-	// TODO: Error check of db before executing the commit
+	// Short circuit in case any database failure occurred earlier.
+	if s.dbErr != nil {
+		return nil, fmt.Errorf("commit aborted due to earlier error: %v", s.dbErr)
+	}
+	// Finalize any pending changes and merge everything into the tries
 	s.IntermediateRoot(deleteEmptyObjects)
-	// TODO: Intermediate processing
-	return nil, nil
+
+	// Short circuit if any error occurs within the IntermediateRoot.
+	if s.dbErr != nil {
+		return nil, fmt.Errorf("commit aborted due to database error: %v", s.dbErr)
+	}
+	// Commit objects to the trie, measuring the elapsed time
+	var (
+		lock    sync.Mutex                                               // protect two maps below
+		nodes   = trienode.NewMergedNodeSet()                            // aggregated trie nodes
+		updates = make(map[common.Hash]*accountUpdate, len(s.mutations)) // aggregated account updates
+
+		// merge aggregates the dirty trie nodes into the global set.
+		// merge run concurrently across all the state objects.
+		merge = func(set *trienode.NodeSet) error {
+			if set == nil {
+				return nil
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			return nodes.Merge(set)
+		}
+	)
+	// Given that some accounts could be destroyed and then recreated within
+	// the same block, account deletions must be processed first. This ensures
+	// that the storage trie nodes deleted during destruction and recreated
+	// during subsequent resurrection can be combined correctly.
+	delNodes, err := s.handleDestruction()
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range delNodes {
+		if err := merge(set); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		start   = time.Now()
+		root    common.Hash
+		workers errgroup.Group
+	)
+	// Schedule the account trie first since that will be the biggest, so give
+	// it the most time to crunch.
+	workers.Go(func() error {
+		// Write the account trie changes, measuring the amount of wasted time
+		newroot, set := s.trie.Commit(true)
+		root = newroot
+
+		if err := merge(set); err != nil {
+			return err
+		}
+		s.AccountCommits = time.Since(start)
+		return nil
+	})
+	// Schedule each of the storage tries that need to be updated, so they can
+	// run concurrently to one another.
+	for addr, op := range s.mutations {
+		if op.isDelete() {
+			continue
+		}
+		obj := s.stateObjects[addr]
+		if obj == nil {
+			return nil, errors.New("missing state object")
+		}
+		// Run the storage updates concurrently to one another
+		workers.Go(func() error {
+			// Write any storage changes in the state object to its storage trie
+			update, set, err := obj.commit()
+			if err != nil {
+				return err
+			}
+			if err := merge(set); err != nil {
+				return err
+			}
+			lock.Lock()
+			updates[obj.addrHash] = update
+			s.StorageCommits = time.Since(start) // overwrite with the longest storage commit runtime
+			lock.Unlock()
+			return nil
+		})
+	}
+	// Wait for everything to finish
+	if err := workers.Wait(); err != nil {
+		return nil, err
+	}
+	// Clear all internal flags and update state root at the end.
+	s.mutations = make(map[common.Address]*mutation)
+	s.stateObjectsDestruct = make(map[common.Address]*StateObject)
+
+	origin := s.originalRoot
+	s.originalRoot = root
+
+	return newStateUpdate(origin, root, updates, nodes), nil
 }
 
 // commitAndFlush is a wrapper of commit which also commits the state mutations
@@ -181,8 +800,38 @@ func (s *StateDB) commit(deleteEmptyObjects bool) (*stateUpdate, error) {
 // Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1260
 func (s *StateDB) commitAndFlush(block uint64, deleteEmptyObjects bool) (*stateUpdate, error) {
 	ret, err := s.commit(deleteEmptyObjects)
-	// TODO: Intermediate processing
-	return ret, err
+	if err != nil {
+		return nil, err
+	}
+	// Commit dirty contract code if any exists
+	if db := s.db.TrieDB().Disk(); db != nil && len(ret.codes) > 0 {
+		batch := db.NewBatch()
+		for _, code := range ret.codes {
+			if err := rawdb.WriteCode(batch, code.hash, code.blob); err != nil {
+				return nil, err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return nil, err
+		}
+	}
+	if ret.empty() {
+		return ret, nil
+	}
+	// If trie database is enabled, commit the state update as a new layer
+	if db := s.db.TrieDB(); db != nil {
+		start := time.Now()
+		if err := db.Update(ret.root, ret.originRoot, block, ret.nodes); err != nil {
+			return nil, err
+		}
+		// Different from the original code, the new state is flushed to disk
+		// right away as there is no block processing on top to decide when.
+		if err := db.Commit(ret.root); err != nil {
+			return nil, err
+		}
+		s.TrieDBCommits += time.Since(start)
+	}
+	return ret, nil
 }
 
 // Commit writes the state mutations into the configured data stores.
@@ -192,16 +841,60 @@ func (s *StateDB) commitAndFlush(block uint64, deleteEmptyObjects bool) (*stateU
 // commit states.
 // The associated block number of the state transition is also provided
 // for more chain context.
-// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1317
-// TODO: Current implementation doesn't support deleteEmptyObjects. Now, it's a placeholder.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1321
 func (s *StateDB) Commit(block uint64, deleteEmptyObjects bool) (common.Hash, error) {
-	// Placeholder
-	deleteEmptyObjects = false
-	_, err := s.commitAndFlush(block, deleteEmptyObjects)
+	ret, err := s.commitAndFlush(block, deleteEmptyObjects)
 	if err != nil {
 		return common.Hash{}, err
 	}
-	return common.Hash{}, nil
+	return ret.root, nil
+}
+
+// AddAddressToAccessList adds the given address to the access list
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1374
+func (s *StateDB) AddAddressToAccessList(addr common.Address) {
+	if s.accessList.AddAddress(addr) {
+		s.journal.accessListAddAccount(addr)
+	}
+}
+
+// AddSlotToAccessList adds the given (address, slot)-tuple to the access list
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1381
+func (s *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	addrMod, slotMod := s.accessList.AddSlot(addr, slot)
+	if addrMod {
+		// In practice, this should not happen, since there is no way to enter the
+		// scope of 'address' without having the 'address' become already added
+		// to the access list (via call-variant, create, etc).
+		// Better safe than sorry, though
+		s.journal.accessListAddAccount(addr)
+	}
+	if slotMod {
+		s.journal.accessListAddSlot(addr, slot)
+	}
+}
+
+// AddressInAccessList returns true if the given address is in the access list.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1396
+func (s *StateDB) AddressInAccessList(addr common.Address) bool {
+	return s.accessList.ContainsAddress(addr)
+}
+
+// SlotInAccessList returns true if the given (address, slot)-tuple is in the access list.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1401
+func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressPresent bool, slotPresent bool) {
+	return s.accessList.Contains(addr, slot)
+}
+
+// markDelete marks the given address as deleted and its account and storage
+// need to be removed from the stateDB.
+// Original function: github.com/ethereum/go-ethereum/core/state/statedb.go line 1408
+func (s *StateDB) markDelete(addr common.Address) {
+	if _, ok := s.mutations[addr]; !ok {
+		s.mutations[addr] = &mutation{}
+	}
+	s.mutations[addr].applied = false
+	s.mutations[addr].typ = deletion
 }
 
 // markUpdate marks the given address as mutated and needs to be updated in the stateDB.
@@ -221,3 +914,156 @@ func (s *StateDB) markUpdate(addr common.Address) {
 func (s *StateDB) GetStateObject(addr common.Address) *StateObject {
 	return s.getOrNewStateObject(addr)
 }
+
+// ReadStateObject retrieves the state object for the given address without
+// creating the account. An account that doesn't exist is returned as an empty
+// object which isn't part of the state, so that it can be inspected like any
+// other while the state is left untouched. Changes made to it are lost.
+func (s *StateDB) ReadStateObject(addr common.Address) *StateObject {
+	if obj := s.getStateObject(addr); obj != nil {
+		return obj
+	}
+	return newObject(s, addr, nil)
+}
+
+// StorageChange describes a storage slot modified after a snapshot was taken.
+type StorageChange struct {
+	Address common.Address
+	Key     common.Hash
+	Prev    common.Hash // value of the slot when the snapshot was taken
+}
+
+// StorageChangesSince returns the storage slots modified since the given
+// revision, in the order they were first changed. Slots changed several times
+// are reported once with the value they held when the snapshot was taken,
+// which is exactly what RevertToSnapshot would restore. An error is returned
+// if the revision is unknown or already reverted.
+func (s *StateDB) StorageChangesSince(revid int) ([]StorageChange, error) {
+	idx, err := s.journal.revisionIndex(revid)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		start   = s.journal.validRevisions[idx].journalIndex
+		seen    = make(map[StorageChange]bool)
+		changes []StorageChange
+	)
+	for _, entry := range s.journal.entries[start:] {
+		ch, ok := entry.(storageChange)
+		if !ok {
+			continue
+		}
+		slot := StorageChange{Address: ch.account, Key: ch.key}
+		if seen[slot] {
+			continue
+		}
+		seen[slot] = true
+		slot.Prev = ch.prevvalue
+		changes = append(changes, slot)
+	}
+	return changes, nil
+}
+
+// PendingStorageChanges returns the storage slots modified since the state was
+// last committed, ordered by account and key. Every slot is reported with its
+// committed value, slots written back to that value are left out. The slots
+// of the accounts deleted since, by self-destruct or EIP-161, are reported as
+// changed to zero, as far as the preimages of their hashed keys are known.
+func (s *StateDB) PendingStorageChanges() ([]StorageChange, error) {
+	wiped, err := s.wipedStorage()
+	if err != nil {
+		return nil, err
+	}
+	var changes []StorageChange
+	for addr, obj := range s.stateObjects {
+		for key, value := range obj.pendingStorage {
+			// The committed value of a slot of a resurrected account is the
+			// one of the deleted account
+			prev, ok := wiped[addr][key]
+			if ok {
+				delete(wiped[addr], key)
+			} else {
+				prev = obj.originStorage[key]
+			}
+			if prev != value {
+				changes = append(changes, StorageChange{Address: addr, Key: key, Prev: prev})
+			}
+		}
+	}
+	for addr, slots := range wiped {
+		for key, prev := range slots {
+			changes = append(changes, StorageChange{Address: addr, Key: key, Prev: prev})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if c := bytes.Compare(changes[i].Address[:], changes[j].Address[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(changes[i].Key[:], changes[j].Key[:]) < 0
+	})
+	return changes, nil
+}
+
+// wipedStorage returns the committed slots of the accounts deleted since the
+// state was last committed, keyed by the preimages of the hashed keys. The
+// slots whose preimage is unknown are left out.
+func (s *StateDB) wipedStorage() (map[common.Address]map[common.Hash]common.Hash, error) {
+	origins := make(map[common.Address]*types.StateAccount)
+	for addr, obj := range s.stateObjectsDestruct {
+		origins[addr] = obj.origin
+	}
+	// Finalise marks every deleted account as destructed, the accounts only
+	// marked as deleted are read from the committed account trie
+	var accounts Trie
+	for addr, op := range s.mutations {
+		if _, ok := origins[addr]; ok || !op.isDelete() {
+			continue
+		}
+		if accounts == nil {
+			tr, err := s.db.OpenTrie(s.originalRoot)
+			if err != nil {
+				return nil, err
+			}
+			accounts = tr
+		}
+		acct, err := accounts.GetAccount(addr)
+		if err != nil {
+			return nil, err
+		}
+		origins[addr] = acct
+	}
+	wiped := make(map[common.Address]map[common.Hash]common.Hash)
+	for addr, origin := range origins {
+		if origin == nil || origin.Root == types.EmptyRootHash {
+			continue
+		}
+		tr, err := s.db.OpenStorageTrie(s.originalRoot, addr, origin.Root)
+		if err != nil {
+			return nil, err
+		}
+		nodeIt, err := tr.NodeIterator(nil)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			it    = trie.NewIterator(nodeIt)
+			slots = make(map[common.Hash]common.Hash)
+		)
+		for it.Next() {
+			preimage := tr.GetKey(it.Key)
+			if preimage == nil {
+				continue
+			}
+			_, content, _, err := rlp.Split(it.Value)
+			if err != nil {
+				return nil, err
+			}
+			slots[common.BytesToHash(preimage)] = common.BytesToHash(content)
+		}
+		if it.Err != nil {
+			return nil, it.Err
+		}
+		wiped[addr] = slots
+	}
+	return wiped, nil
+}
@@ -0,0 +1,214 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	gethrawdb "github.com/ethereum/go-ethereum/core/rawdb"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	gethtrie "github.com/ethereum/go-ethereum/trie"
+	gethtriedb "github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+)
+
+// Tests that a zero-value transfer touches an empty account, which EIP-161
+// deletes at the end of the transaction, but only when empty objects are
+// deleted.
+func TestTouchEmptyAccount(t *testing.T) {
+	addr := common.BytesToAddress([]byte("empty"))
+	for _, deleteEmptyObjects := range []bool{true, false} {
+		// Commit the empty account without deleting it, so that it's loaded
+		// clean from the trie below
+		state := newTestState(t)
+		state.CreateAccount(addr)
+		root, err := state.Commit(0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, err = New(root, state.db); err != nil {
+			t.Fatal(err)
+		}
+		if !state.Exist(addr) {
+			t.Fatal("committed empty account doesn't exist")
+		}
+		state.AddBalance(addr, new(uint256.Int))
+		state.Finalise(deleteEmptyObjects)
+
+		if exist := state.Exist(addr); exist == deleteEmptyObjects {
+			t.Errorf("account existence mismatch after Finalise(%v): have %v, want %v", deleteEmptyObjects, exist, !deleteEmptyObjects)
+		}
+	}
+}
+
+// Tests that a zero-value transfer to an account which isn't empty doesn't
+// delete it.
+func TestTouchNonEmptyAccount(t *testing.T) {
+	addr := common.BytesToAddress([]byte("funded"))
+
+	state := newTestState(t)
+	state.SetBalance(addr, uint256.NewInt(1))
+	root, err := state.Commit(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err = New(root, state.db); err != nil {
+		t.Fatal(err)
+	}
+	state.AddBalance(addr, new(uint256.Int))
+	state.Finalise(true)
+	if !state.Exist(addr) {
+		t.Fatal("non-empty account deleted by a zero-value transfer")
+	}
+}
+
+// Tests that the committed slots of the accounts deleted since the last commit
+// are reported as pending changes to zero, unless a resurrected account writes
+// them back.
+func TestPendingStorageChangesOfDeletedAccounts(t *testing.T) {
+	var (
+		addr = common.BytesToAddress([]byte("deleted"))
+		one  = common.BytesToHash([]byte{1})
+		two  = common.BytesToHash([]byte{2})
+	)
+	tests := []struct {
+		name   string
+		nonce  uint64
+		delete func(state *StateDB)
+		want   []StorageChange
+	}{
+		{
+			name:   "self-destruct",
+			nonce:  1,
+			delete: func(state *StateDB) { state.SelfDestruct(addr) },
+			want:   []StorageChange{{addr, one, common.HexToHash("0xa")}, {addr, two, common.HexToHash("0xb")}},
+		},
+		{
+			name:   "EIP-161",
+			delete: func(state *StateDB) { state.AddBalance(addr, new(uint256.Int)) },
+			want:   []StorageChange{{addr, one, common.HexToHash("0xa")}, {addr, two, common.HexToHash("0xb")}},
+		},
+		{
+			name:  "resurrected",
+			nonce: 1,
+			delete: func(state *StateDB) {
+				state.SelfDestruct(addr)
+				state.Finalise(true)
+				state.SetNonce(addr, 1)
+				state.SetState(addr, one, common.HexToHash("0xa"))
+				state.SetState(addr, common.BytesToHash([]byte{3}), common.HexToHash("0xc"))
+			},
+			want: []StorageChange{{addr, two, common.HexToHash("0xb")}, {addr, common.BytesToHash([]byte{3}), common.Hash{}}},
+		},
+	}
+	for _, tt := range tests {
+		state := newTestState(t)
+		state.SetNonce(addr, tt.nonce)
+		state.SetState(addr, one, common.HexToHash("0xa"))
+		state.SetState(addr, two, common.HexToHash("0xb"))
+		root, err := state.Commit(0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, err = New(root, state.db); err != nil {
+			t.Fatal(err)
+		}
+		tt.delete(state)
+		state.Finalise(true)
+
+		changes, err := state.PendingStorageChanges()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(changes, tt.want) {
+			t.Errorf("%s: changes mismatch: have %v, want %v", tt.name, changes, tt.want)
+		}
+	}
+}
+
+// Tests that the state root is the root of the go-ethereum account trie built
+// directly from the RLP-encoded accounts, each with the root of its storage
+// trie, both from IntermediateRoot and from Commit.
+func TestStateRoot(t *testing.T) {
+	type account struct {
+		balance uint64
+		nonce   uint64
+		code    []byte
+		storage map[common.Hash]common.Hash
+	}
+	accounts := map[common.Address]account{
+		common.BytesToAddress([]byte("balance")): {balance: 42},
+		common.BytesToAddress([]byte("nonce")):   {nonce: 7},
+		common.BytesToAddress([]byte("contract")): {
+			balance: 1,
+			nonce:   1,
+			code:    []byte{0x60, 0x00, 0x54},
+			storage: map[common.Hash]common.Hash{
+				common.BytesToHash([]byte{1}): common.BytesToHash([]byte{0xff}),
+				common.BytesToHash([]byte{2}): common.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303132"),
+			},
+		},
+		common.BytesToAddress([]byte("storage")): {
+			balance: 5,
+			storage: map[common.Hash]common.Hash{common.BytesToHash([]byte{3}): common.BytesToHash([]byte{3})},
+		},
+	}
+	state := newTestState(t)
+	want := gethtrie.NewEmpty(gethtriedb.NewDatabase(gethrawdb.NewMemoryDatabase(), nil))
+	for addr, acc := range accounts {
+		state.SetBalance(addr, uint256.NewInt(acc.balance))
+		state.SetNonce(addr, acc.nonce)
+		if acc.code != nil {
+			state.SetCode(addr, acc.code)
+		}
+		storage := gethtrie.NewEmpty(gethtriedb.NewDatabase(gethrawdb.NewMemoryDatabase(), nil))
+		for key, value := range acc.storage {
+			state.SetState(addr, key, value)
+
+			blob, err := rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			storage.MustUpdate(crypto.Keccak256Hash(key[:]).Bytes(), blob)
+		}
+		blob, err := rlp.EncodeToBytes(&gethtypes.StateAccount{
+			Nonce:    acc.nonce,
+			Balance:  uint256.NewInt(acc.balance),
+			Root:     gethcommon.Hash(storage.Hash()),
+			CodeHash: crypto.Keccak256Hash(acc.code).Bytes(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.MustUpdate(crypto.Keccak256Hash(addr[:]).Bytes(), blob)
+	}
+	if have := state.IntermediateRoot(false); have != common.Hash(want.Hash()) {
+		t.Fatalf("intermediate root mismatch: have %x, want %x", have, want.Hash())
+	}
+	root, err := state.Commit(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != common.Hash(want.Hash()) {
+		t.Fatalf("committed root mismatch: have %x, want %x", root, want.Hash())
+	}
+	// The committed accounts are read back from the trie
+	if state, err = New(root, state.db); err != nil {
+		t.Fatal(err)
+	}
+	for addr, acc := range accounts {
+		if have := state.GetBalance(addr).Uint64(); have != acc.balance {
+			t.Errorf("account %x: balance mismatch: have %d, want %d", addr, have, acc.balance)
+		}
+		if have := state.GetNonce(addr); have != acc.nonce {
+			t.Errorf("account %x: nonce mismatch: have %d, want %d", addr, have, acc.nonce)
+		}
+		if have := state.GetCodeHash(addr); have != crypto.Keccak256Hash(acc.code) {
+			t.Errorf("account %x: code hash mismatch: have %x, want %x", addr, have, crypto.Keccak256Hash(acc.code))
+		}
+	}
+}
@@ -1,8 +1,53 @@
 package state
 
-import "storage_extract/common"
+import (
+	"storage_extract/common"
+	"storage_extract/trie/trienode"
+)
 
+// contractCode represents a contract code with associated metadata.
+type contractCode struct {
+	hash common.Hash // hash is the cryptographic hash of the contract code.
+	blob []byte      // blob is the binary representation of the contract code.
+}
+
+// accountUpdate represents an operation for updating an Ethereum account.
+// Different from the original code, only the mutated contract code is tracked
+// since there is no snapshot or state history to feed.
+type accountUpdate struct {
+	address common.Address // address is the unique account identifier
+	code    *contractCode  // code represents mutated contract code; nil means it's not modified.
+}
+
+// stateUpdate represents the difference between two states resulting from state
+// execution. It contains information about mutated contract codes, accounts,
+// and storage slots, along with their original values.
 type stateUpdate struct {
-	originRoot common.Hash // hash of the state before applying mutation
-	root       common.Hash // hash of the state after applying mutation
+	originRoot common.Hash                     // hash of the state before applying mutation
+	root       common.Hash                     // hash of the state after applying mutation
+	codes      map[common.Address]contractCode // codes contains the set of dirty codes
+	nodes      *trienode.MergedNodeSet         // Aggregated dirty nodes caused by state changes
+}
+
+// newStateUpdate constructs a state update object, representing the differences
+// between two states by performing state execution.
+// Original function: github.com/ethereum/go-ethereum/core/state/stateupdate.go line 98
+func newStateUpdate(originRoot common.Hash, root common.Hash, updates map[common.Hash]*accountUpdate, nodes *trienode.MergedNodeSet) *stateUpdate {
+	codes := make(map[common.Address]contractCode)
+	for _, op := range updates {
+		if op.code != nil {
+			codes[op.address] = *op.code
+		}
+	}
+	return &stateUpdate{
+		originRoot: originRoot,
+		root:       root,
+		codes:      codes,
+		nodes:      nodes,
+	}
+}
+
+// empty returns a flag indicating the state transition is empty or not.
+func (sc *stateUpdate) empty() bool {
+	return sc.originRoot == sc.root
 }
@@ -0,0 +1,172 @@
+package state
+
+import (
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/types"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// StorageRangeResult is the result of a debug_storageRangeAt API call.
+// Different from the original code, the types are exported as they're
+// defined in the state package instead of the API one.
+// Original struct: github.com/ethereum/go-ethereum/eth/api_debug.go line 200
+type StorageRangeResult struct {
+	Storage StorageMap   `json:"storage"`
+	NextKey *common.Hash `json:"nextKey"` // nil if Storage includes the last key in the trie.
+}
+
+// StorageMap maps the hashed slot keys to their entries.
+// Original type: github.com/ethereum/go-ethereum/eth/api_debug.go line 205
+type StorageMap map[common.Hash]StorageEntry
+
+// StorageEntry is a storage slot along with its preimage, which is nil if
+// the preimage of the hashed key is unknown.
+// Original struct: github.com/ethereum/go-ethereum/eth/api_debug.go line 207
+type StorageEntry struct {
+	Key   *common.Hash `json:"key"`
+	Value common.Hash  `json:"value"`
+}
+
+// StorageRange returns at most maxResult storage slots of the account in the
+// order of their hashed keys, starting at the given hashed key, along with
+// the hashed key to resume from.
+//
+// Different from the original code, the live storage trie of the account is
+// iterated instead of one reopened from the database, since the tries are
+// usually not committed. The slots reflect the state as of the last
+// IntermediateRoot call.
+// Original function: github.com/ethereum/go-ethereum/eth/api_debug.go line 232 (storageRangeAt)
+func (s *StateDB) StorageRange(addr common.Address, start common.Hash, maxResult int) (StorageRangeResult, error) {
+	obj := s.getStateObject(addr)
+	if obj == nil {
+		return StorageRangeResult{}, nil // non-existent account
+	}
+	storageRoot := obj.data.Root
+	if storageRoot == types.EmptyRootHash || storageRoot == (common.Hash{}) {
+		return StorageRangeResult{}, nil // empty storage
+	}
+	tr, err := obj.getTrie()
+	if err != nil {
+		return StorageRangeResult{}, err
+	}
+	trieIt, err := tr.NodeIterator(start.Bytes())
+	if err != nil {
+		return StorageRangeResult{}, err
+	}
+	it := trie.NewIterator(trieIt)
+	result := StorageRangeResult{Storage: StorageMap{}}
+	for i := 0; i < maxResult && it.Next(); i++ {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return StorageRangeResult{}, err
+		}
+		e := StorageEntry{Value: common.BytesToHash(content)}
+		if preimage := tr.GetKey(it.Key); preimage != nil {
+			preimage := common.BytesToHash(preimage)
+			e.Key = &preimage
+		}
+		result.Storage[common.BytesToHash(it.Key)] = e
+	}
+	if it.Err != nil {
+		return StorageRangeResult{}, it.Err
+	}
+	// Add the 'next key' so clients can continue downloading.
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		result.NextKey = &next
+	}
+	return result, nil
+}
+
+// StorageRangeProof is a contiguous range of storage slots along with the edge
+// proofs which prove it against the storage root, in the form snap sync serves
+// storage ranges.
+// Notice: This struct is not included in the original code.
+type StorageRangeProof struct {
+	Root   common.Hash        // Storage root the range is proven against
+	Origin common.Hash        // Hashed key the range starts at
+	Keys   []common.Hash      // Hashed slot keys in increasing order
+	Values [][]byte           // RLP-encoded slot values as stored in the trie
+	Proof  trienode.ProofList // Edge proofs of the origin and the last key, nil for the whole storage
+}
+
+// StorageRangeProof returns at most maxResult storage slots of the account in
+// the order of their hashed keys, starting at the given hashed key, together
+// with the Merkle proofs of the origin and of the last returned key. Like snap
+// sync, the proofs are only added if the range doesn't cover the whole storage,
+// which can be verified by rebuilding the trie from the slots alone.
+//
+// Different from the original code, the live storage trie of the account is
+// proven instead of one reopened from the database, see StorageRange.
+// Original code: github.com/ethereum/go-ethereum/eth/protocols/snap/handler.go line 329 (ServiceGetStorageRangesQuery)
+func (s *StateDB) StorageRangeProof(addr common.Address, origin common.Hash, maxResult int) (*StorageRangeProof, error) {
+	result := &StorageRangeProof{Root: types.EmptyRootHash, Origin: origin}
+	obj := s.getStateObject(addr)
+	if obj == nil {
+		return result, nil // non-existent account, the storage is empty
+	}
+	tr, err := obj.getTrie()
+	if err != nil {
+		return nil, err
+	}
+	result.Root = tr.Hash()
+
+	trieIt, err := tr.NodeIterator(origin.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		it    = trie.NewIterator(trieIt)
+		abort bool
+	)
+	for it.Next() {
+		if len(result.Keys) >= maxResult {
+			abort = true
+			break
+		}
+		result.Keys = append(result.Keys, common.BytesToHash(it.Key))
+		result.Values = append(result.Values, common.CopyBytes(it.Value))
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+	// Generate the Merkle proofs for the first and last storage slot, but
+	// only if the response was capped. If the entire storage trie included
+	// in the response, no need for any proofs.
+	if origin != (common.Hash{}) || (abort && len(result.Keys) > 0) {
+		proof := trienode.NewProofSet()
+		if err := tr.Prove(origin[:], proof); err != nil {
+			return nil, err
+		}
+		if len(result.Keys) > 0 {
+			last := result.Keys[len(result.Keys)-1]
+			if err := tr.Prove(last[:], proof); err != nil {
+				return nil, err
+			}
+		}
+		for _, node := range proof.List() {
+			result.Proof = append(result.Proof, node)
+		}
+	}
+	return result, nil
+}
+
+// Verify checks the range against its storage root the way snap sync does,
+// rebuilding the part of the trie between the two edge proofs from the slots.
+// It returns whether more slots follow the range in the trie.
+// Notice: This function is not included in the original code.
+func (p *StorageRangeProof) Verify() (bool, error) {
+	keys := make([][]byte, len(p.Keys))
+	for i := range p.Keys {
+		keys[i] = p.Keys[i][:]
+	}
+	var proof ethdb.KeyValueReader
+	if len(p.Proof) > 0 {
+		proof = p.Proof.Set()
+	}
+	return trie.VerifyRangeProof(p.Root, p.Origin[:], keys, p.Values, proof)
+}
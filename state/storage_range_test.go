@@ -0,0 +1,117 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+)
+
+// Tests that paging through the storage of an account with a small maxResult
+// returns every slot exactly once, in the order of the hashed keys, along with
+// its preimage, both from the live trie and from the committed one.
+func TestStorageRange(t *testing.T) {
+	var (
+		state = newTestState(t)
+		addr  = common.BytesToAddress([]byte("aa"))
+		slots = make(map[common.Hash]common.Hash)
+	)
+	for i := byte(1); i <= 10; i++ {
+		key, value := common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i})
+		state.SetState(addr, key, value)
+		slots[key] = value
+	}
+	state.IntermediateRoot(false)
+	checkStorageRange(t, "live", state, addr, slots)
+
+	root, err := state.Commit(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err = New(root, state.db); err != nil {
+		t.Fatal(err)
+	}
+	checkStorageRange(t, "committed", state, addr, slots)
+}
+
+// checkStorageRange pages through the storage of the account three slots at a
+// time and checks that the pages cover the given slots.
+func checkStorageRange(t *testing.T, name string, state *StateDB, addr common.Address, slots map[common.Hash]common.Hash) {
+	t.Helper()
+
+	var (
+		seen  = make(map[common.Hash]bool)
+		start common.Hash
+		last  []byte
+	)
+	for pages := 0; ; pages++ {
+		if pages > len(slots) {
+			t.Fatalf("%s: paging doesn't terminate", name)
+		}
+		result, err := state.StorageRange(addr, start, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(result.Storage) > 3 {
+			t.Fatalf("%s: %d slots returned, want at most 3", name, len(result.Storage))
+		}
+		for hash, entry := range result.Storage {
+			// Every hashed key of the page follows the ones of the previous
+			// pages and precedes the next key
+			if bytes.Compare(hash[:], start[:]) < 0 || (last != nil && bytes.Compare(hash[:], last) <= 0) {
+				t.Errorf("%s: hashed key %x out of order", name, hash)
+			}
+			if result.NextKey != nil && bytes.Compare(hash[:], result.NextKey[:]) >= 0 {
+				t.Errorf("%s: hashed key %x not before the next key %x", name, hash, *result.NextKey)
+			}
+			if entry.Key == nil {
+				t.Fatalf("%s: no preimage for hashed key %x", name, hash)
+			}
+			if crypto.Keccak256Hash(entry.Key[:]) != hash {
+				t.Errorf("%s: preimage %x doesn't hash to %x", name, *entry.Key, hash)
+			}
+			if want, ok := slots[*entry.Key]; !ok || entry.Value != want {
+				t.Errorf("%s: slot %x value mismatch: have %x, want %x", name, *entry.Key, entry.Value, want)
+			}
+			if seen[*entry.Key] {
+				t.Errorf("%s: slot %x returned twice", name, *entry.Key)
+			}
+			seen[*entry.Key] = true
+		}
+		for hash := range result.Storage {
+			if last == nil || bytes.Compare(hash[:], last) > 0 {
+				last = common.CopyBytes(hash[:])
+			}
+		}
+		if result.NextKey == nil {
+			break
+		}
+		start = *result.NextKey
+	}
+	if len(seen) != len(slots) {
+		t.Fatalf("%s: %d slots returned, want %d", name, len(seen), len(slots))
+	}
+}
+
+// Tests that the storage range of an account without storage and of a missing
+// account is empty.
+func TestStorageRangeEmpty(t *testing.T) {
+	state := newTestState(t)
+	empty := common.BytesToAddress([]byte("empty"))
+	state.CreateAccount(empty)
+	state.IntermediateRoot(false)
+
+	for _, addr := range []common.Address{empty, common.BytesToAddress([]byte("missing"))} {
+		result, err := state.StorageRange(addr, common.Hash{}, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Storage) != 0 || result.NextKey != nil {
+			t.Errorf("account %x: non-empty range: %d slots, next key %v", addr, len(result.Storage), result.NextKey)
+		}
+	}
+	if state.Exist(common.BytesToAddress([]byte("missing"))) {
+		t.Error("storage range created the missing account")
+	}
+}
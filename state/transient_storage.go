@@ -0,0 +1,43 @@
+package state
+
+import (
+	"storage_extract/common"
+)
+
+// transientStorage is a representation of EIP-1153 "Transient Storage".
+// Original struct: github.com/ethereum/go-ethereum/core/state/transient_storage.go line 28
+type transientStorage map[common.Address]Storage
+
+// newTransientStorage creates a new instance of a transientStorage.
+// Original function: github.com/ethereum/go-ethereum/core/state/transient_storage.go line 31
+func newTransientStorage() transientStorage {
+	return make(transientStorage)
+}
+
+// Set sets the transient-storage `value` for `key` at the given `addr`.
+// Original function: github.com/ethereum/go-ethereum/core/state/transient_storage.go line 36
+func (t transientStorage) Set(addr common.Address, key, value common.Hash) {
+	if value == (common.Hash{}) { // this is a 'delete'
+		if _, ok := t[addr]; ok {
+			delete(t[addr], key)
+			if len(t[addr]) == 0 {
+				delete(t, addr)
+			}
+		}
+	} else {
+		if _, ok := t[addr]; !ok {
+			t[addr] = make(Storage)
+		}
+		t[addr][key] = value
+	}
+}
+
+// Get gets the transient storage for `key` at the given `addr`.
+// Original function: github.com/ethereum/go-ethereum/core/state/transient_storage.go line 53
+func (t transientStorage) Get(addr common.Address, key common.Hash) common.Hash {
+	val, ok := t[addr]
+	if !ok {
+		return common.Hash{}
+	}
+	return val[key]
+}
@@ -0,0 +1,173 @@
+package trie
+
+import (
+	"bytes"
+
+	"storage_extract/common"
+	"storage_extract/triedb/database"
+)
+
+// LeafDiff is a leaf whose value differs between two tries.
+type LeafDiff struct {
+	Key   []byte // Key of the leaf, i.e. the hashed slot key in storage tries
+	Prev  []byte // Value in the old trie, nil if the leaf was added
+	Value []byte // Value in the new trie, nil if the leaf was removed
+}
+
+// TrieDiff is the difference between two tries: the leaves added, removed and
+// modified, and the nodes rewritten to get from the old trie to the new one.
+// A node is identified by its path, so a node of the old trie replaced at the
+// same path is both orphaned and created.
+type TrieDiff struct {
+	Added    []*LeafDiff
+	Removed  []*LeafDiff
+	Modified []*LeafDiff
+
+	Created  map[string]common.Hash // Nodes of the new trie not in the old one, by path
+	Orphaned map[string]common.Hash // Nodes of the old trie not in the new one, by path
+}
+
+// Diff compares the tries with the given ids, which are loaded from the node
+// database. Both tries are iterated in lockstep in the order of the node
+// paths, like the difference iterator of the original code (NewDifferenceIterator)
+// does, and the iterators skip the children of the nodes with the same hash on
+// both sides, so the cost is proportional to the size of the change rather
+// than of the tries. The nodes embedded in their parent are reported with an
+// empty hash. Each trie is read at the state root of its id, so an older trie
+// of the path scheme is read through the trie node history like any
+// historical state.
+// Notice: This function is not included in the original code.
+func Diff(oldID, newID *ID, db database.NodeDatabase) (*TrieDiff, error) {
+	oldTrie, err := New(oldID, db)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := New(newID, db)
+	if err != nil {
+		return nil, err
+	}
+	a, err := oldTrie.NodeIterator(nil)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newTrie.NodeIterator(nil)
+	if err != nil {
+		return nil, err
+	}
+	diff := &TrieDiff{
+		Created:  make(map[string]common.Hash),
+		Orphaned: make(map[string]common.Hash),
+	}
+	aNext, bNext := a.Next(true), b.Next(true)
+	for aNext || bNext {
+		cmp := 0
+		switch {
+		case !aNext:
+			cmp = 1
+		case !bNext:
+			cmp = -1
+		default:
+			cmp = comparePaths(a.Path(), b.Path())
+		}
+		switch {
+		case cmp < 0:
+			// The node of the old trie has no counterpart at its path
+			diff.remove(a)
+			aNext = a.Next(true)
+
+		case cmp > 0:
+			// The node of the new trie has no counterpart at its path
+			diff.add(b)
+			bNext = b.Next(true)
+
+		case a.Leaf():
+			// Leaves only share the path with leaves, since their paths
+			// end with the terminator
+			if prev, value := a.LeafBlob(), b.LeafBlob(); !bytes.Equal(prev, value) {
+				diff.Modified = append(diff.Modified, &LeafDiff{
+					Key:   a.LeafKey(),
+					Prev:  common.CopyBytes(prev),
+					Value: common.CopyBytes(value),
+				})
+			}
+			aNext, bNext = a.Next(true), b.Next(true)
+
+		case sameNode(a, b):
+			// Skip the identical subtrees without loading them
+			aNext, bNext = a.Next(false), b.Next(false)
+
+		default:
+			diff.remove(a)
+			diff.add(b)
+			aNext, bNext = a.Next(true), b.Next(true)
+		}
+	}
+	if err := a.Error(); err != nil {
+		return nil, err
+	}
+	if err := b.Error(); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// remove records the node the iterator of the old trie is at as orphaned, or
+// as a removed leaf.
+func (d *TrieDiff) remove(it NodeIterator) {
+	if it.Leaf() {
+		d.Removed = append(d.Removed, &LeafDiff{Key: it.LeafKey(), Prev: common.CopyBytes(it.LeafBlob())})
+		return
+	}
+	d.Orphaned[string(it.Path())] = it.Hash()
+}
+
+// add records the node the iterator of the new trie is at as created, or as an
+// added leaf.
+func (d *TrieDiff) add(it NodeIterator) {
+	if it.Leaf() {
+		d.Added = append(d.Added, &LeafDiff{Key: it.LeafKey(), Value: common.CopyBytes(it.LeafBlob())})
+		return
+	}
+	d.Created[string(it.Path())] = it.Hash()
+}
+
+// sameNode reports whether the two iterators are at the same subtree, both
+// being at the same path. The nodes are compared by hash, or by encoding for
+// the nodes embedded in their parent, which have no hash.
+func sameNode(a, b NodeIterator) bool {
+	if ha, hb := a.Hash(), b.Hash(); ha != (common.Hash{}) || hb != (common.Hash{}) {
+		return ha == hb
+	}
+	return bytes.Equal(embeddedBlob(a), embeddedBlob(b))
+}
+
+// embeddedBlob returns the encoding of the embedded node the iterator is at.
+// An embedded node is too small to reference a hashed child, so its encoding
+// determines the whole subtree.
+func embeddedBlob(it NodeIterator) []byte {
+	stack := it.(*nodeIterator).stack
+	return nodeToBytes(stack[len(stack)-1].node)
+}
+
+// comparePaths compares two node paths in the order the iterator visits the
+// nodes: a parent before its children, and the value of a full node, whose
+// path ends with the terminator, before the other children. Different from
+// the original code, which compares the paths as bytes, the keys may be of any
+// length, so a key can end at a full node.
+func comparePaths(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] == b[i]:
+			continue
+		case a[i] == 16:
+			return -1
+		case b[i] == 16:
+			return 1
+		case a[i] < b[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,202 @@
+package trie_test
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/trie"
+	"storage_extract/triedb"
+	"storage_extract/types"
+)
+
+// keyNibbles converts a key into its hex-nibble path, without the terminator.
+func keyNibbles(key []byte) string {
+	nibbles := make([]byte, 0, len(key)*2)
+	for _, b := range key {
+		nibbles = append(nibbles, b/16, b%16)
+	}
+	return string(nibbles)
+}
+
+// trieNodes lists the nodes of the trie at the given root by path, identified
+// by their hash, or for the nodes embedded in their parent by the entries
+// below them: both determine the node at a given path.
+func trieNodes(t *testing.T, db *triedb.Database, root common.Hash, content map[string][]byte) map[string]string {
+	t.Helper()
+
+	tr, err := trie.New(trie.StateTrieID(root), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := tr.NodeIterator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]string)
+	for it.Next(true) {
+		if it.Leaf() {
+			continue
+		}
+		path := string(it.Path())
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			nodes[path] = "hash:" + string(hash.Bytes())
+			continue
+		}
+		var id strings.Builder
+		id.WriteString("embedded:")
+		for _, key := range sortedKeys(content) {
+			if strings.HasPrefix(keyNibbles([]byte(key)), path) {
+				id.WriteString(key + "=" + string(content[key]) + ";")
+			}
+		}
+		nodes[path] = id.String()
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
+
+// checkDiff compares the diff of the tries at the two roots with the one
+// worked out by iterating over both of them in full.
+func checkDiff(t *testing.T, db *triedb.Database, oldRoot, newRoot common.Hash, oldContent, newContent map[string][]byte) {
+	t.Helper()
+
+	diff, err := trie.Diff(trie.StateTrieID(oldRoot), trie.StateTrieID(newRoot), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check the leaves
+	var added, removed, modified []string
+	for _, key := range sortedKeys(newContent) {
+		prev, ok := oldContent[key]
+		if !ok {
+			added = append(added, key)
+		} else if !bytes.Equal(prev, newContent[key]) {
+			modified = append(modified, key)
+		}
+	}
+	for _, key := range sortedKeys(oldContent) {
+		if _, ok := newContent[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	for _, check := range []struct {
+		name   string
+		leaves []*trie.LeafDiff
+		want   []string
+	}{{"added", diff.Added, added}, {"removed", diff.Removed, removed}, {"modified", diff.Modified, modified}} {
+		if len(check.leaves) != len(check.want) {
+			t.Fatalf("%s leaf count mismatch: have %d, want %d", check.name, len(check.leaves), len(check.want))
+		}
+		for i, leaf := range check.leaves {
+			key := check.want[i]
+			if string(leaf.Key) != key {
+				t.Fatalf("%s leaf %d: key mismatch: have %x, want %x", check.name, i, leaf.Key, key)
+			}
+			if prev := oldContent[key]; !bytes.Equal(leaf.Prev, prev) {
+				t.Fatalf("%s leaf %x: previous value mismatch: have %x, want %x", check.name, key, leaf.Prev, prev)
+			}
+			if value := newContent[key]; !bytes.Equal(leaf.Value, value) {
+				t.Fatalf("%s leaf %x: value mismatch: have %x, want %x", check.name, key, leaf.Value, value)
+			}
+		}
+	}
+	// Check the nodes: a node is created or orphaned unless the same node is
+	// found at the same path on the other side
+	oldNodes, newNodes := trieNodes(t, db, oldRoot, oldContent), trieNodes(t, db, newRoot, newContent)
+	for _, check := range []struct {
+		name  string
+		nodes map[string]common.Hash
+		from  map[string]string
+		other map[string]string
+	}{{"created", diff.Created, newNodes, oldNodes}, {"orphaned", diff.Orphaned, oldNodes, newNodes}} {
+		count := 0
+		for path, id := range check.from {
+			if other, ok := check.other[path]; ok && other == id {
+				continue
+			}
+			count++
+			hash, ok := check.nodes[path]
+			if !ok {
+				t.Fatalf("%s node %x missing", check.name, path)
+			}
+			want := common.Hash{}
+			if strings.HasPrefix(id, "hash:") {
+				want = common.BytesToHash([]byte(id[len("hash:"):]))
+			}
+			if hash != want {
+				t.Fatalf("%s node %x: hash mismatch: have %x, want %x", check.name, path, hash, want)
+			}
+		}
+		if len(check.nodes) != count {
+			t.Fatalf("%s node count mismatch: have %d, want %d", check.name, len(check.nodes), count)
+		}
+	}
+}
+
+// Tests the diff of consecutive random versions of a trie, as well as of every
+// version with the empty trie and of the last one with the first one, in the
+// hash and the path scheme databases.
+func TestDiff(t *testing.T) {
+	for _, config := range []*triedb.Config{triedb.HashDefaults, triedb.PathDefaults} {
+		t.Run(newDatabase(t, memorydb.New(), config).Scheme(), func(t *testing.T) {
+			testDiff(t, config)
+		})
+	}
+}
+
+func testDiff(t *testing.T, config *triedb.Config) {
+	rnd := rand.New(rand.NewSource(20))
+	tr, db := newEmpty(t, config)
+
+	var (
+		roots    = []common.Hash{types.EmptyRootHash}
+		contents = []map[string][]byte{{}}
+	)
+	for block := uint64(1); block <= 40; block++ {
+		content := make(map[string][]byte)
+		for key, value := range contents[len(contents)-1] {
+			content[key] = value
+		}
+		// Vary the size of the change, down to a single slot
+		for op := 0; op < 1+rnd.Intn(30); op++ {
+			key := randomKey(rnd)
+			if rnd.Intn(3) == 0 {
+				if err := tr.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+				delete(content, string(key))
+			} else {
+				value := randomValue(rnd)
+				if err := tr.Update(key, value); err != nil {
+					t.Fatal(err)
+				}
+				content[string(key)] = value
+			}
+		}
+		var root common.Hash
+		tr, root = commit(t, tr, db, roots[len(roots)-1], block)
+		roots, contents = append(roots, root), append(contents, content)
+	}
+	for i := 1; i < len(roots); i++ {
+		checkDiff(t, db, roots[i-1], roots[i], contents[i-1], contents[i])
+		checkDiff(t, db, types.EmptyRootHash, roots[i], contents[0], contents[i])
+		checkDiff(t, db, roots[i], types.EmptyRootHash, contents[i], contents[0])
+	}
+	last := len(roots) - 1
+	checkDiff(t, db, roots[1], roots[last], contents[1], contents[last])
+
+	// A trie has no difference with itself
+	diff, err := trie.Diff(trie.StateTrieID(roots[last]), trie.StateTrieID(roots[last]), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(diff.Added) + len(diff.Removed) + len(diff.Modified) + len(diff.Created) + len(diff.Orphaned); n != 0 {
+		t.Fatalf("diff of a trie with itself has %d entries", n)
+	}
+}
@@ -46,6 +46,21 @@ func keybytesToHex(str []byte) []byte {
 	return nibbles
 }
 
+// hexToKeybytes turns hex nibbles into key bytes.
+// This can only be used for keys of even length.
+// Original function: github.com/ethereum/go-ethereum/trie/encoding.go line 121
+func hexToKeybytes(hex []byte) []byte {
+	if hasTerm(hex) {
+		hex = hex[:len(hex)-1]
+	}
+	if len(hex)&1 != 0 {
+		panic("can't convert hex key of odd length")
+	}
+	key := make([]byte, len(hex)/2)
+	decodeNibbles(hex, key)
+	return key
+}
+
 func decodeNibbles(nibbles []byte, bytes []byte) {
 	for bi, ni := 0, 0; ni < len(nibbles); bi, ni = bi+1, ni+2 {
 		bytes[bi] = nibbles[ni]<<4 | nibbles[ni+1]
@@ -0,0 +1,36 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"storage_extract/common"
+)
+
+// ErrCommitted is returned when an already committed trie is requested for usage.
+// The potential usages can be `Get`, `Update`, `Delete`, `NodeIterator`, `Prove`
+// and so on.
+var ErrCommitted = errors.New("trie is already committed")
+
+// MissingNodeError is returned by the trie functions (Get, Update, Delete)
+// in the case where a trie node is not present in the local database. It contains
+// information necessary for retrieving the missing node.
+// Original struct: github.com/ethereum/go-ethereum/trie/errors.go line 32
+type MissingNodeError struct {
+	Owner    common.Hash // owner of the trie if it's 2-layered trie
+	NodeHash common.Hash // hash of the missing node
+	Path     []byte      // hex-encoded path to the missing node
+	err      error       // concrete error for missing trie node
+}
+
+// Unwrap returns the concrete error for missing trie node which
+// allows us for further analysis outside.
+func (err *MissingNodeError) Unwrap() error {
+	return err.err
+}
+
+func (err *MissingNodeError) Error() string {
+	if err.Owner == (common.Hash{}) {
+		return fmt.Sprintf("missing trie node %x (path %x) %v", err.NodeHash, err.Path, err.err)
+	}
+	return fmt.Sprintf("missing trie node %x (owner %x) (path %x) %v", err.NodeHash, err.Owner, err.Path, err.err)
+}
@@ -0,0 +1,131 @@
+package trie
+
+import (
+	"bytes"
+
+	"storage_extract/common"
+)
+
+// TraceKind is the kind of a structural decision taken by the trie while a key
+// is written.
+type TraceKind string
+
+const (
+	TraceResolve      TraceKind = "resolve"       // A node referenced by hash is loaded from the database
+	TraceDescend      TraceKind = "descend"       // The key covers the whole key of a shortNode, which is descended into
+	TraceSplit        TraceKind = "split"         // The key diverges inside a shortNode, which is split at the match length
+	TraceCreateBranch TraceKind = "create-branch" // A fullNode is created where the keys diverge
+	TraceMove         TraceKind = "move"          // The rest of a split shortNode is moved below the new fullNode
+	TraceNewLeaf      TraceKind = "new-leaf"      // A leaf holding the value is created in an empty slot
+	TraceExtension    TraceKind = "extension"     // A shortNode holding the common prefix is put above the new fullNode
+	TraceUpdateValue  TraceKind = "update-value"  // The value of an existing leaf is replaced
+	TraceCopyBranch   TraceKind = "copy-branch"   // A fullNode on the path is copied before one of its children is replaced
+	TraceDeleteLeaf   TraceKind = "delete-leaf"   // The leaf holding the key is removed
+	TraceMerge        TraceKind = "merge"         // A shortNode is merged with the shortNode left below it
+	TraceReduceBranch TraceKind = "reduce-branch" // A fullNode left with a single child is reduced to a shortNode
+)
+
+// TraceEvent is a structural decision taken by the trie while a key is written.
+type TraceEvent struct {
+	Kind     TraceKind
+	Path     []byte // Hex-nibble path of the node the decision is taken at
+	NodeKey  []byte // Key of the shortNode involved, if any
+	MatchLen int    // Length of the prefix shared by the key and a split shortNode
+	Index    int    // Slot of the fullNode involved, -1 if none
+}
+
+// TraceStep is the write of a single key, with the decisions it took and the
+// trie it resulted in.
+type TraceStep struct {
+	Key    []byte // Key as written into the trie, i.e. the hashed key of a StateTrie
+	Delete bool   // Whether the key was deleted
+	Events []*TraceEvent
+	Root   *TrieNode // Trie after the write
+}
+
+// InsertTrace records the structural decisions taken by a trie while keys are
+// inserted and deleted, one step per key, so that the restructuring of the
+// trie can be replayed. The recorder is optional: a trie without one records
+// nothing.
+//
+// Note InsertTrace is not thread-safe, like the trie it's attached to.
+// Notice: This struct is not included in the original code.
+type InsertTrace struct {
+	Initial *TrieNode // Trie when the recorder was attached
+	Steps   []*TraceStep
+
+	key []byte // Hex-nibble key being written, with the terminator
+}
+
+// NewInsertTrace creates an empty trace recorder.
+func NewInsertTrace() *InsertTrace {
+	return &InsertTrace{}
+}
+
+// SetInsertTrace attaches the recorder to the trie, which records the following
+// writes into it along with the trie they start from. A nil recorder detaches
+// the current one.
+// Notice: This function is not included in the original code.
+func (t *Trie) SetInsertTrace(trace *InsertTrace) {
+	if trace != nil {
+		trace.Initial = convertNodeToTrieNode(t.root, 0, -1, nil, nil)
+	}
+	t.trace = trace
+}
+
+// SetInsertTrace attaches the recorder to the trie, see Trie.SetInsertTrace.
+func (t *StateTrie) SetInsertTrace(trace *InsertTrace) {
+	t.trie.SetInsertTrace(trace)
+}
+
+// begin starts the step of the given hex-nibble key.
+func (r *InsertTrace) begin(key []byte, deletion bool) {
+	if r == nil {
+		return
+	}
+	r.key = key
+	r.Steps = append(r.Steps, &TraceStep{
+		Key:    hexToKeybytes(key),
+		Delete: deletion,
+		Events: []*TraceEvent{},
+	})
+}
+
+// end completes the current step with the resulting trie.
+func (r *InsertTrace) end(root node) {
+	if r == nil || len(r.Steps) == 0 {
+		return
+	}
+	r.Steps[len(r.Steps)-1].Root = convertNodeToTrieNode(root, 0, -1, nil, nil)
+	r.key = nil
+}
+
+// abort drops the current step, whose write failed and left the trie as it was.
+func (r *InsertTrace) abort() {
+	if r == nil || len(r.Steps) == 0 {
+		return
+	}
+	r.Steps = r.Steps[:len(r.Steps)-1]
+	r.key = nil
+}
+
+// onEvent records a decision of the current step at the given path.
+func (r *InsertTrace) onEvent(kind TraceKind, path []byte, nodeKey []byte, matchLen, index int) {
+	if r == nil || len(r.Steps) == 0 {
+		return
+	}
+	step := r.Steps[len(r.Steps)-1]
+	step.Events = append(step.Events, &TraceEvent{
+		Kind:     kind,
+		Path:     common.CopyBytes(path),
+		NodeKey:  common.CopyBytes(nodeKey),
+		MatchLen: matchLen,
+		Index:    index,
+	})
+}
+
+// isKey reports whether the given full path is the key being written, rather
+// than the one of a node moved by the write.
+func (r *InsertTrace) isKey(path []byte) bool {
+	return r != nil && bytes.Equal(path, r.key)
+}
@@ -0,0 +1,209 @@
+package trie_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/trie"
+	"storage_extract/triedb"
+	"storage_extract/types"
+)
+
+// Tests that a write failing on a missing node leaves no step in the trace, and
+// that the following writes are traced as usual.
+func TestInsertTraceFailedWrite(t *testing.T) {
+	disk := memorydb.New()
+	db := newDatabase(t, disk, triedb.HashDefaults)
+	tr, err := trie.New(trie.StateTrieID(types.EmptyRootHash), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := make([]byte, 40)
+	for _, key := range []string{"\x00dog", "\x10cat", "\x20cow"} {
+		if err := tr.Update([]byte(key), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr, root := commit(t, tr, db, types.EmptyRootHash, 1)
+
+	// Drop every node but the root, so that the writes below it fail
+	it := disk.NewIterator(nil, nil)
+	for it.Next() {
+		if string(it.Key()) != string(root.Bytes()) {
+			disk.Delete(it.Key())
+		}
+	}
+	it.Release()
+
+	trace := trie.NewInsertTrace()
+	tr.SetInsertTrace(trace)
+	if err := tr.Update([]byte("\x00dog"), []byte{1}); err == nil {
+		t.Fatal("update below a missing node succeeded")
+	}
+	if err := tr.Delete([]byte("\x10cat")); err == nil {
+		t.Fatal("delete below a missing node succeeded")
+	}
+	if len(trace.Steps) != 0 {
+		t.Fatalf("failed writes left %d steps in the trace", len(trace.Steps))
+	}
+	if err := tr.Update([]byte("\x30fox"), []byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Steps) != 1 || trace.Steps[0].Root == nil {
+		t.Fatalf("write after the failed ones not traced: %d steps", len(trace.Steps))
+	}
+}
+
+// Tests the decisions traced for every structural case of a write, from the
+// trie holding the given keys. The values are long enough for every node to
+// be stored by hash, so that the tries reopened from their commit resolve
+// the nodes they write through, all but the root which is resolved on open.
+func TestInsertTraceEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		commit bool
+		key    string
+		delete bool
+		want   []trie.TraceKind
+	}{
+		{
+			name: "leaf into the empty trie",
+			key:  "\x12",
+			want: []trie.TraceKind{trie.TraceNewLeaf},
+		},
+		{
+			name: "value of an existing leaf",
+			keys: []string{"\x12"},
+			key:  "\x12",
+			want: []trie.TraceKind{trie.TraceDescend, trie.TraceUpdateValue},
+		},
+		{
+			name: "shortNode split without common prefix",
+			keys: []string{"\x12"},
+			key:  "\x34",
+			want: []trie.TraceKind{trie.TraceSplit, trie.TraceCreateBranch, trie.TraceMove, trie.TraceNewLeaf},
+		},
+		{
+			name: "shortNode split below an extension",
+			keys: []string{"\x12"},
+			key:  "\x13",
+			want: []trie.TraceKind{trie.TraceSplit, trie.TraceCreateBranch, trie.TraceMove, trie.TraceNewLeaf, trie.TraceExtension},
+		},
+		{
+			name: "leaf into an empty slot of a fullNode",
+			keys: []string{"\x12", "\x34"},
+			key:  "\x56",
+			want: []trie.TraceKind{trie.TraceNewLeaf, trie.TraceCopyBranch},
+		},
+		{
+			name: "shortNode split below a fullNode",
+			keys: []string{"\x12", "\x34"},
+			key:  "\x35",
+			want: []trie.TraceKind{trie.TraceSplit, trie.TraceCreateBranch, trie.TraceMove, trie.TraceNewLeaf, trie.TraceCopyBranch},
+		},
+		{
+			name:   "missing key",
+			keys:   []string{"\x12"},
+			key:    "\x34",
+			delete: true,
+			want:   []trie.TraceKind{},
+		},
+		{
+			name:   "only leaf",
+			keys:   []string{"\x12"},
+			key:    "\x12",
+			delete: true,
+			want:   []trie.TraceKind{trie.TraceDeleteLeaf},
+		},
+		{
+			name:   "fullNode reduced into its remaining leaf",
+			keys:   []string{"\x12", "\x34"},
+			key:    "\x34",
+			delete: true,
+			want:   []trie.TraceKind{trie.TraceDeleteLeaf, trie.TraceCopyBranch, trie.TraceReduceBranch},
+		},
+		{
+			name:   "fullNode reduced to an extension of its remaining fullNode",
+			keys:   []string{"\x12", "\x13", "\x34"},
+			key:    "\x34",
+			delete: true,
+			want:   []trie.TraceKind{trie.TraceDeleteLeaf, trie.TraceCopyBranch, trie.TraceReduceBranch},
+		},
+		{
+			name:   "fullNode left with several children",
+			keys:   []string{"\x12", "\x34", "\x56"},
+			key:    "\x34",
+			delete: true,
+			want:   []trie.TraceKind{trie.TraceDeleteLeaf, trie.TraceCopyBranch},
+		},
+		{
+			name:   "extension merged with the reduced fullNode",
+			keys:   []string{"\x12", "\x13"},
+			key:    "\x13",
+			delete: true,
+			want:   []trie.TraceKind{trie.TraceDescend, trie.TraceDeleteLeaf, trie.TraceCopyBranch, trie.TraceReduceBranch, trie.TraceMerge},
+		},
+		{
+			name:   "value of a resolved leaf",
+			keys:   []string{"\x12", "\x34"},
+			commit: true,
+			key:    "\x34",
+			want:   []trie.TraceKind{trie.TraceResolve, trie.TraceDescend, trie.TraceUpdateValue, trie.TraceCopyBranch},
+		},
+		{
+			name:   "shortNode split below a resolved extension",
+			keys:   []string{"\x12", "\x13"},
+			commit: true,
+			key:    "\x14",
+			want:   []trie.TraceKind{trie.TraceDescend, trie.TraceResolve, trie.TraceNewLeaf, trie.TraceCopyBranch},
+		},
+		{
+			name:   "resolved leaf",
+			keys:   []string{"\x12", "\x34"},
+			commit: true,
+			key:    "\x34",
+			delete: true,
+			want:   []trie.TraceKind{trie.TraceResolve, trie.TraceDeleteLeaf, trie.TraceCopyBranch, trie.TraceReduceBranch},
+		},
+	}
+	for _, tt := range tests {
+		tr, db := newEmpty(t, triedb.HashDefaults)
+		for _, key := range tt.keys {
+			if err := tr.Update([]byte(key), bytes.Repeat([]byte{1}, 40)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.commit {
+			tr, _ = commit(t, tr, db, types.EmptyRootHash, 1)
+		}
+		trace := trie.NewInsertTrace()
+		tr.SetInsertTrace(trace)
+
+		var err error
+		if tt.delete {
+			err = tr.Delete([]byte(tt.key))
+		} else {
+			err = tr.Update([]byte(tt.key), bytes.Repeat([]byte{2}, 40))
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(trace.Steps) != 1 {
+			t.Fatalf("%s: %d steps traced, want 1", tt.name, len(trace.Steps))
+		}
+		step := trace.Steps[0]
+		if string(step.Key) != tt.key || step.Delete != tt.delete {
+			t.Errorf("%s: step of key %x (delete %v), want %x (delete %v)", tt.name, step.Key, step.Delete, tt.key, tt.delete)
+		}
+		have := []trie.TraceKind{}
+		for _, event := range step.Events {
+			have = append(have, event.Kind)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s: events mismatch:\nhave %v\nwant %v", tt.name, have, tt.want)
+		}
+	}
+}
@@ -55,6 +55,16 @@ func decodeNode(hash, buf []byte) (node, error) {
 	return decodeNodeUnsafe(hash, common.CopyBytes(buf))
 }
 
+// mustDecodeNodeUnsafe is a wrapper of decodeNodeUnsafe and panic if any error is
+// encountered.
+func mustDecodeNodeUnsafe(hash, buf []byte) node {
+	n, err := decodeNodeUnsafe(hash, buf)
+	if err != nil {
+		panic(fmt.Sprintf("node %x: %v", hash, err))
+	}
+	return n
+}
+
 // decodeNodeUnsafe parses the RLP encoding of a trie node. The passed byte slice
 // will be directly referenced by node without bytes deep copy, so the input MUST
 // not be changed after.
@@ -0,0 +1,224 @@
+package trie
+
+import (
+	"fmt"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// NodeInfo describes a trie node the way it's persisted in the node database.
+type NodeInfo struct {
+	Path []byte      // Hex-nibble path of the node from the trie root
+	Hash common.Hash // Hash of the encoded node
+	Blob []byte      // RLP-encoded node with its children collapsed
+}
+
+// CollectNodes hashes the trie and returns all the nodes that would be stored
+// in the node database on commit, i.e. the root plus every node which is not
+// embedded in its parent. Nodes are returned in pre-order.
+// Notice: This function is not included in the original code.
+func (t *Trie) CollectNodes() ([]*NodeInfo, error) {
+	// Short circuit if the trie is already committed and not usable.
+	if t.committed {
+		return nil, ErrCommitted
+	}
+	if t.root == nil {
+		return nil, nil
+	}
+	t.Hash()
+
+	h := newHasher(false)
+	defer returnHasherToPool(h)
+
+	var (
+		nodes []*NodeInfo
+		walk  func(n node, path []byte) error
+	)
+	walk = func(n node, path []byte) error {
+		switch n := n.(type) {
+		case hashNode:
+			resolved, err := t.resolveAndTrack(n, path)
+			if err != nil {
+				return err
+			}
+			return walk(resolved, path)
+		case *shortNode, *fullNode:
+			collapsed, _ := h.proofHash(n)
+			blob := nodeToBytes(collapsed)
+
+			// The nodes smaller than 32 bytes are embedded in their parent,
+			// the root node is always stored no matter how small it is.
+			if len(blob) >= 32 || len(path) == 0 {
+				nodes = append(nodes, &NodeInfo{
+					Path: common.CopyBytes(path),
+					Hash: crypto.Keccak256Hash(blob),
+					Blob: blob,
+				})
+			}
+		}
+		switch n := n.(type) {
+		case *shortNode:
+			if _, ok := n.Val.(valueNode); ok {
+				return nil
+			}
+			return walk(n.Val, append(path, n.Key...))
+		case *fullNode:
+			for i := 0; i < 16; i++ {
+				if n.Children[i] == nil {
+					continue
+				}
+				if err := walk(n.Children[i], append(path, byte(i))); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(t.root, nil); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// CollectNodes returns all the nodes that would be stored in the node database
+// on commit, see Trie.CollectNodes.
+func (t *StateTrie) CollectNodes() ([]*NodeInfo, error) {
+	return t.trie.CollectNodes()
+}
+
+// ResolveAll loads every node of the trie from the database into memory, so
+// that the whole trie can be rendered, e.g. after it was committed or opened
+// at a historical root. The content and the hash of the trie don't change.
+// Notice: This function is not included in the original code.
+func (t *Trie) ResolveAll() error {
+	// Short circuit if the trie is already committed and not usable.
+	if t.committed {
+		return ErrCommitted
+	}
+	var resolve func(n node, path []byte) (node, error)
+	resolve = func(n node, path []byte) (node, error) {
+		switch n := n.(type) {
+		case hashNode:
+			resolved, err := t.resolveAndTrack(n, path)
+			if err != nil {
+				return nil, err
+			}
+			return resolve(resolved, path)
+		case *shortNode:
+			if _, ok := n.Val.(valueNode); ok {
+				return n, nil
+			}
+			child, err := resolve(n.Val, append(path, n.Key...))
+			if err != nil {
+				return nil, err
+			}
+			// The nodes are shared with the copies of the trie, so they're
+			// copied instead of modified in place.
+			n = n.copy()
+			n.Val = child
+			return n, nil
+		case *fullNode:
+			n = n.copy()
+			for i := 0; i < 16; i++ {
+				if n.Children[i] == nil {
+					continue
+				}
+				child, err := resolve(n.Children[i], append(path, byte(i)))
+				if err != nil {
+					return nil, err
+				}
+				n.Children[i] = child
+			}
+			return n, nil
+		default:
+			return n, nil
+		}
+	}
+	if t.root == nil {
+		return nil
+	}
+	root, err := resolve(t.root, nil)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// ResolveAll loads every node of the trie from the database into memory, see
+// Trie.ResolveAll.
+func (t *StateTrie) ResolveAll() error {
+	return t.trie.ResolveAll()
+}
+
+// Owner returns the owner of the trie, i.e. the hash of the account address
+// for storage tries.
+func (t *StateTrie) Owner() common.Hash {
+	return t.trie.owner
+}
+
+// DecodedNode is the decoded form of an RLP-encoded trie node, for clients
+// inspecting the nodes of a proof.
+// Notice: This struct is not included in the original code.
+type DecodedNode struct {
+	Type     string                 `json:"type"`               // "branch", "extension" or "leaf"
+	Key      string                 `json:"key,omitempty"`      // Key nibbles of an extension or a leaf
+	Value    hexutil.Bytes          `json:"value,omitempty"`    // Value of a leaf, or the value slot of a branch
+	Child    *DecodedRef            `json:"child,omitempty"`    // Child of an extension
+	Children map[string]*DecodedRef `json:"children,omitempty"` // Non-empty children of a branch, by slot
+}
+
+// DecodedRef is the reference of a node to a child, which is either the hash
+// of the child or the child itself, embedded in the parent because its
+// encoding is shorter than 32 bytes.
+// Notice: This struct is not included in the original code.
+type DecodedRef struct {
+	Hash     *common.Hash `json:"hash,omitempty"`
+	Embedded *DecodedNode `json:"embedded,omitempty"`
+}
+
+// DecodeNode decodes an RLP-encoded trie node, e.g. a proof element.
+// Notice: This function is not included in the original code.
+func DecodeNode(blob []byte) (*DecodedNode, error) {
+	n, err := decodeNode(nil, blob)
+	if err != nil {
+		return nil, err
+	}
+	return describeNode(n), nil
+}
+
+// describeNode converts a decoded node into its DecodedNode form.
+func describeNode(n node) *DecodedNode {
+	switch n := n.(type) {
+	case *shortNode:
+		if value, ok := n.Val.(valueNode); ok {
+			return &DecodedNode{Type: "leaf", Key: FormatNibbles(n.Key), Value: hexutil.Bytes(value)}
+		}
+		return &DecodedNode{Type: "extension", Key: FormatNibbles(n.Key), Child: describeRef(n.Val)}
+	case *fullNode:
+		decoded := &DecodedNode{Type: "branch", Children: make(map[string]*DecodedRef)}
+		for i := 0; i < 16; i++ {
+			if n.Children[i] != nil {
+				decoded.Children[fmt.Sprintf("%x", i)] = describeRef(n.Children[i])
+			}
+		}
+		if value, ok := n.Children[16].(valueNode); ok {
+			decoded.Value = hexutil.Bytes(value)
+		}
+		return decoded
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// describeRef converts the child reference of a node into its DecodedRef form.
+func describeRef(n node) *DecodedRef {
+	if hash, ok := n.(hashNode); ok {
+		h := common.BytesToHash(hash)
+		return &DecodedRef{Hash: &h}
+	}
+	return &DecodedRef{Embedded: describeNode(n)}
+}
@@ -20,6 +20,7 @@ type TrieNode struct {
 	Depth           int             `json:"depth,omitempty"`
 	IsLeaf          bool            `json:"isLeaf,omitempty"`          // Is this a leaf node
 	KeyPath         string          `json:"keyPath,omitempty"`         // Full path to this node
+	Path            string          `json:"path"`                      // Hex-nibble path of the node from the root, one character per nibble
 	HashedKeyPath   string          `json:"hashedKeyPath,omitempty"`   // Hashed version of the path
 	SlotMap         map[string]bool `json:"slotMap,omitempty"`         // Map of all slots in a branch node (filled and empty)
 	FilledSlotCount int             `json:"filledSlotCount,omitempty"` // Number of filled slots in a branch
@@ -74,7 +75,21 @@ func (t *Trie) ConvertToJSONWithOriginalKeys(originalKeys map[string]string, ori
 
 // convertNodeToTrieNode convert the internal node to a frontend-friendly TrieNode structure
 func convertNodeToTrieNode(n node, depth int, branchIndex int, originalKeys map[string]string, originalValues map[string]string) *TrieNode {
-	return convertNodeToTrieNodeWithPath(n, depth, branchIndex, originalKeys, originalValues, "")
+	return convertNodeToTrieNodeWithPath(n, depth, branchIndex, originalKeys, originalValues, "", nil)
+}
+
+// FormatNibbles formats a hex-nibble path with one hex character per nibble,
+// e.g. []byte{0x0a, 0x03} as "a3".
+// Notice: This function is not included in the original code.
+func FormatNibbles(nibbles []byte) string {
+	const digits = "0123456789abcdef"
+	var b strings.Builder
+	for _, n := range nibbles {
+		if n < 16 {
+			b.WriteByte(digits[n])
+		}
+	}
+	return b.String()
 }
 
 // hexToNibbles converts a hex-encoded byte array to nibble array (each nibble becomes a byte)
@@ -88,7 +103,7 @@ func hexToNibbles(hexBytes []byte) []byte {
 }
 
 // convertNodeToTrieNodeWithPath recursive convert the node to a frontend-friendly TrieNode structure, and track the full path
-func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalKeys map[string]string, originalValues map[string]string, currentPath string) *TrieNode {
+func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalKeys map[string]string, originalValues map[string]string, currentPath string, nibblePath []byte) *TrieNode {
 	if n == nil {
 		return nil
 	}
@@ -102,6 +117,7 @@ func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalK
 			Type:        "short",
 			Key:         keyHex,
 			KeyPath:     fullKeyPath,
+			Path:        FormatNibbles(nibblePath),
 			Depth:       depth,
 			BranchIndex: branchIndex,
 		}
@@ -206,7 +222,7 @@ func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalK
 		} else {
 			// This is a shortNode with another node (an extension node)
 			node.Type = "shortNode_extension"
-			childNode := convertNodeToTrieNodeWithPath(n.Val, depth+1, -1, originalKeys, originalValues, fullKeyPath)
+			childNode := convertNodeToTrieNodeWithPath(n.Val, depth+1, -1, originalKeys, originalValues, fullKeyPath, concat(nibblePath, n.Key...))
 			if childNode != nil {
 				node.Children = []*TrieNode{childNode}
 			}
@@ -223,6 +239,7 @@ func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalK
 		branchNode := &TrieNode{
 			Type:            "branch",
 			KeyPath:         currentPath,
+			Path:            FormatNibbles(nibblePath),
 			Depth:           depth,
 			BranchIndex:     branchIndex,
 			FilledSlotCount: countFilledSlots(n.Children),
@@ -234,7 +251,7 @@ func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalK
 			if child != nil {
 				childPath := fmt.Sprintf("%s%x", currentPath, i)
 				branchNode.SlotMap[fmt.Sprintf("%x", i)] = true
-				branchNode.Children = append(branchNode.Children, convertNodeToTrieNodeWithPath(child, depth+1, i, originalKeys, originalValues, childPath))
+				branchNode.Children = append(branchNode.Children, convertNodeToTrieNodeWithPath(child, depth+1, i, originalKeys, originalValues, childPath, concat(nibblePath, byte(i))))
 			} else {
 				branchNode.SlotMap[fmt.Sprintf("%x", i)] = false
 			}
@@ -245,6 +262,7 @@ func convertNodeToTrieNodeWithPath(n node, depth int, branchIndex int, originalK
 		return &TrieNode{
 			Type: "hash",
 			Hash: fmt.Sprintf("%x", []byte(n)),
+			Path: FormatNibbles(nibblePath),
 		}
 
 	case valueNode:
@@ -0,0 +1,227 @@
+package trie_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/trie"
+	"storage_extract/triedb"
+
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	gethtrie "github.com/ethereum/go-ethereum/trie"
+)
+
+// proofContent returns the content of a proof database as a map.
+func proofContent(db *memorydb.Database) map[string]string {
+	content := make(map[string]string)
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		content[string(it.Key())] = string(it.Value())
+	}
+	return content
+}
+
+// equalProofs reports whether the two proof databases hold the same nodes.
+func equalProofs(a, b *memorydb.Database) bool {
+	ca, cb := proofContent(a), proofContent(b)
+	if len(ca) != len(cb) {
+		return false
+	}
+	for key, value := range ca {
+		if cb[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// newRandomTries fills a trie and its go-ethereum counterpart with the same
+// random entries, with the keys of the given length (random if 0), and
+// returns the trie committed into a hash scheme database along with the
+// entries sorted by key.
+func newRandomTries(t *testing.T, rnd *rand.Rand, n int, keyLen int) (*trie.Trie, *gethtrie.Trie, [][]byte, [][]byte) {
+	t.Helper()
+
+	tr, db := newEmpty(t, triedb.HashDefaults)
+	geth := newGethEmpty()
+	content := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		key := randomKey(rnd)
+		if keyLen > 0 {
+			key = make([]byte, keyLen)
+			rnd.Read(key)
+		}
+		value := randomValue(rnd)
+		if err := tr.Update(key, value); err != nil {
+			t.Fatal(err)
+		}
+		geth.MustUpdate(key, value)
+		content[string(key)] = value
+	}
+	tr, _ = commit(t, tr, db, common.Hash{}, 1)
+
+	var keys, values [][]byte
+	for _, key := range sortedKeys(content) {
+		keys = append(keys, []byte(key))
+		values = append(values, content[key])
+	}
+	return tr, geth, keys, values
+}
+
+// Tests that the inclusion proof of every key holds the same nodes as the
+// go-ethereum one and verifies to the value of the key.
+func TestProof(t *testing.T) {
+	rnd := rand.New(rand.NewSource(10))
+	tr, geth, keys, values := newRandomTries(t, rnd, 300, 0)
+	root := tr.Hash()
+
+	for i, key := range keys {
+		proof, gethProof := memorydb.New(), memorydb.New()
+		if err := tr.Prove(key, proof); err != nil {
+			t.Fatalf("key %x: %v", key, err)
+		}
+		if err := geth.Prove(key, gethProof); err != nil {
+			t.Fatal(err)
+		}
+		if !equalProofs(proof, gethProof) {
+			t.Fatalf("key %x: proof mismatch", key)
+		}
+		value, err := trie.VerifyProof(root, key, proof)
+		if err != nil {
+			t.Fatalf("key %x: failed to verify the proof: %v", key, err)
+		}
+		if !bytes.Equal(value, values[i]) {
+			t.Fatalf("key %x: proven value mismatch: have %x, want %x", key, value, values[i])
+		}
+	}
+}
+
+// Tests that the proof of a key missing from the trie is the same as the
+// go-ethereum one and verifies as an absence proof, i.e. to no value.
+func TestAbsenceProof(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	tr, geth, keys, _ := newRandomTries(t, rnd, 300, 0)
+	root := tr.Hash()
+
+	present := make(map[string]bool)
+	for _, key := range keys {
+		present[string(key)] = true
+	}
+	for checked := 0; checked < 200; {
+		key := randomKey(rnd)
+		if present[string(key)] {
+			continue
+		}
+		checked++
+
+		proof, gethProof := memorydb.New(), memorydb.New()
+		if err := tr.Prove(key, proof); err != nil {
+			t.Fatalf("key %x: %v", key, err)
+		}
+		if err := geth.Prove(key, gethProof); err != nil {
+			t.Fatal(err)
+		}
+		if !equalProofs(proof, gethProof) {
+			t.Fatalf("key %x: proof mismatch", key)
+		}
+		value, err := trie.VerifyProof(root, key, proof)
+		if err != nil {
+			t.Fatalf("key %x: failed to verify the absence proof: %v", key, err)
+		}
+		if value != nil {
+			t.Fatalf("key %x: absent key proven to %x", key, value)
+		}
+	}
+}
+
+// Tests that a proof of a key fails to verify against a different root, and
+// that a proof missing a node fails to verify at all.
+func TestBadProof(t *testing.T) {
+	rnd := rand.New(rand.NewSource(12))
+	tr, _, keys, _ := newRandomTries(t, rnd, 100, 32)
+	root := tr.Hash()
+
+	for _, key := range keys[:20] {
+		proof := memorydb.New()
+		if err := tr.Prove(key, proof); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trie.VerifyProof(common.Hash{0x01}, key, proof); err == nil {
+			t.Fatalf("key %x: proof verified against a wrong root", key)
+		}
+		content := proofContent(proof)
+		for node := range content {
+			proof.Delete([]byte(node))
+			break
+		}
+		if _, err := trie.VerifyProof(root, key, proof); err == nil {
+			t.Fatalf("key %x: incomplete proof verified", key)
+		}
+	}
+}
+
+// Tests that random ranges of entries proven by the proofs of their edge keys
+// verify like they do in go-ethereum, that the whole trie needs no proof, and
+// that tampering with the range makes the verification fail.
+func TestRangeProof(t *testing.T) {
+	rnd := rand.New(rand.NewSource(13))
+	tr, _, keys, values := newRandomTries(t, rnd, 500, 32)
+	root := tr.Hash()
+
+	for round := 0; round < 200; round++ {
+		start := rnd.Intn(len(keys))
+		end := start + 1 + rnd.Intn(len(keys)-start)
+
+		proof := memorydb.New()
+		if err := tr.Prove(keys[start], proof); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Prove(keys[end-1], proof); err != nil {
+			t.Fatal(err)
+		}
+		more, err := trie.VerifyRangeProof(root, keys[start], keys[start:end], values[start:end], proof)
+		if err != nil {
+			t.Fatalf("range [%d, %d): failed to verify: %v", start, end, err)
+		}
+		gethMore, gethErr := gethtrie.VerifyRangeProof(gethcommon.Hash(root), keys[start], keys[start:end], values[start:end], proof)
+		if gethErr != nil {
+			t.Fatalf("range [%d, %d): go-ethereum failed to verify: %v", start, end, gethErr)
+		}
+		if more != gethMore || more != (end < len(keys)) {
+			t.Fatalf("range [%d, %d): more mismatch: have %v, go-ethereum %v", start, end, more, gethMore)
+		}
+
+		// Tamper with a value of the range
+		tampered := make([][]byte, end-start)
+		copy(tampered, values[start:end])
+		index := rnd.Intn(len(tampered))
+		tampered[index] = append(bytes.Clone(tampered[index]), 0x01)
+		if _, err := trie.VerifyRangeProof(root, keys[start], keys[start:end], tampered, proof); err == nil {
+			t.Fatalf("range [%d, %d): tampered value %d verified", start, end, index)
+		}
+		// Drop an entry from the middle of the range
+		if end-start > 2 {
+			index := start + 1 + rnd.Intn(end-start-2)
+			droppedKeys := append(append([][]byte{}, keys[start:index]...), keys[index+1:end]...)
+			droppedValues := append(append([][]byte{}, values[start:index]...), values[index+1:end]...)
+			if _, err := trie.VerifyRangeProof(root, keys[start], droppedKeys, droppedValues, proof); err == nil {
+				t.Fatalf("range [%d, %d): range missing entry %d verified", start, end, index)
+			}
+		}
+	}
+	// The whole trie is proven by its entries alone
+	more, err := trie.VerifyRangeProof(root, nil, keys, values, nil)
+	if err != nil {
+		t.Fatalf("failed to verify the whole trie: %v", err)
+	}
+	if more {
+		t.Fatal("more entries reported after the whole trie")
+	}
+	if _, err := trie.VerifyRangeProof(root, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatal("incomplete trie verified without a proof")
+	}
+}
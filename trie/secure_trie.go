@@ -3,10 +3,24 @@ package trie
 import (
 	"fmt"
 	"storage_extract/common"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb/database"
+	"storage_extract/types"
 
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
+// preimageStore wraps the methods of a backing store for reading and writing
+// trie node preimages.
+// Original interface: github.com/ethereum/go-ethereum/trie/secure_trie.go line 29
+type preimageStore interface {
+	// Preimage retrieves the preimage of the specified hash.
+	Preimage(hash common.Hash) []byte
+
+	// InsertPreimage commits a set of preimages along with their hashes.
+	InsertPreimage(preimages map[common.Hash][]byte)
+}
+
 // StateTrie wraps a trie with key hashing. In a stateTrie trie, all
 // access operations hash the key using keccak256. This prevents
 // calling code from creating long chains of nodes that
@@ -18,27 +32,77 @@ import (
 //
 // StateTrie is not safe for concurrent use.
 type StateTrie struct {
-	trie       Trie
-	hashKeyBuf [common.HashLength]byte // buffer for hashKey (hash of key)
-	// secKeyCache      map[string][]byte Not Implemented for now (may not be needed)
+	trie             Trie
+	preimages        preimageStore
+	hashKeyBuf       [common.HashLength]byte // buffer for hashKey (hash of key)
+	secKeyCache      map[string][]byte
+	secKeyCacheOwner *StateTrie // Pointer to self, replace the key cache on mismatch
 }
 
 // NewStateTrie creates a trie with an existing root node from a backing database.
 // If root is the zero hash or the sha3 hash of an empty string, the
 // trie is initially empty.
-// TODO: The current implementation doesn't not use db database.NodeDatabase as a parameter.
 // Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 77
-func NewStateTrie(id *ID) (*StateTrie, error) {
-	trie, err := New(id)
+func NewStateTrie(id *ID, db database.NodeDatabase) (*StateTrie, error) {
+	trie, err := New(id, db)
 	if err != nil {
 		return nil, err
 	}
 
 	tr := &StateTrie{trie: *trie}
 
-	// Preimage logic is not implemented in the current code.
+	// link the preimage store if it's supported
+	preimages, ok := db.(preimageStore)
+	if ok {
+		tr.preimages = preimages
+	}
 	return tr, nil
+}
 
+// GetStorage attempts to retrieve a storage slot with provided account address
+// and slot key. The value bytes must not be modified by the caller.
+// If the specified storage slot is not in the trie, nil will be returned.
+// If a trie node is not found in the database, a MissingNodeError is returned.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 107
+func (t *StateTrie) GetStorage(_ common.Address, key []byte) ([]byte, error) {
+	enc, err := t.trie.Get(t.hashKey(key))
+	if err != nil || len(enc) == 0 {
+		return nil, err
+	}
+	// Storage values are stored RLP-encoded, strip the encoding
+	_, content, _, err := rlp.Split(enc)
+	return content, err
+}
+
+// GetAccount attempts to retrieve an account with provided account address.
+// If the specified account is not in the trie, nil will be returned.
+// If a trie node is not found in the database, a MissingNodeError is returned.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 119
+func (t *StateTrie) GetAccount(address common.Address) (*types.StateAccount, error) {
+	res, err := t.trie.Get(t.hashKey(address.Bytes()))
+	if res == nil || err != nil {
+		return nil, err
+	}
+	ret := new(types.StateAccount)
+	err = rlp.DecodeBytes(res, ret)
+	return ret, err
+}
+
+// UpdateAccount will abstract the write of an account to the secure trie.
+// Different from the original code, the code length parameter is omitted as
+// it's only used by the verkle trie.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 185
+func (t *StateTrie) UpdateAccount(address common.Address, acc *types.StateAccount) error {
+	hk := t.hashKey(address.Bytes())
+	data, err := rlp.EncodeToBytes(acc)
+	if err != nil {
+		return err
+	}
+	if err := t.trie.Update(hk, data); err != nil {
+		return err
+	}
+	t.getSecKeyCache()[string(hk)] = address.Bytes()
+	return nil
 }
 
 // UpdateStorage associates key with value in the trie. Subsequent calls to
@@ -56,11 +120,41 @@ func (t *StateTrie) UpdateStorage(_ common.Address, key, value []byte) error {
 	if err != nil {
 		return err
 	}
-	// TODO: Logic for secKeyCache
-
+	t.getSecKeyCache()[string(hk)] = common.CopyBytes(key)
 	return nil
 }
 
+// DeleteStorage removes any existing storage slot from the trie.
+// If the specified trie node is not in the trie, nothing will be changed.
+// If a node is not found in the database, a MissingNodeError is returned.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 213
+func (t *StateTrie) DeleteStorage(_ common.Address, key []byte) error {
+	hk := t.hashKey(key)
+	delete(t.getSecKeyCache(), string(hk))
+	return t.trie.Delete(hk)
+}
+
+// DeleteAccount abstracts an account deletion from the trie.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 220
+func (t *StateTrie) DeleteAccount(address common.Address) error {
+	hk := t.hashKey(address.Bytes())
+	delete(t.getSecKeyCache(), string(hk))
+	return t.trie.Delete(hk)
+}
+
+// GetKey returns the sha3 preimage of a hashed key that was
+// previously used to store a value.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 228
+func (t *StateTrie) GetKey(shaKey []byte) []byte {
+	if key, ok := t.getSecKeyCache()[string(shaKey)]; ok {
+		return key
+	}
+	if t.preimages == nil {
+		return nil
+	}
+	return t.preimages.Preimage(common.BytesToHash(shaKey))
+}
+
 // Hash returns the root hash of StateTrie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 // Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 271
@@ -68,6 +162,37 @@ func (t *StateTrie) Hash() common.Hash {
 	return t.trie.Hash()
 }
 
+// Commit collects all dirty nodes in the trie and replaces them with the
+// corresponding node hash. All collected nodes (including dirty leaves if
+// collectLeaf is true) will be encapsulated into a nodeset for return.
+// The returned nodeset can be nil if the trie is clean (nothing to commit).
+// All cached preimages will be also flushed if preimages recording is enabled.
+// Once the trie is committed, it's not usable anymore. A new trie must
+// be created with new root and updated trie database for following usage
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 250
+func (t *StateTrie) Commit(collectLeaf bool) (common.Hash, *trienode.NodeSet) {
+	// Write all the pre-images to the actual disk database
+	if len(t.getSecKeyCache()) > 0 {
+		if t.preimages != nil {
+			preimages := make(map[common.Hash][]byte, len(t.secKeyCache))
+			for hk, key := range t.secKeyCache {
+				preimages[common.BytesToHash([]byte(hk))] = key
+			}
+			t.preimages.InsertPreimage(preimages)
+		}
+		t.secKeyCache = make(map[string][]byte)
+	}
+	// Commit the trie and return its modified nodeset.
+	return t.trie.Commit(collectLeaf)
+}
+
+// NodeIterator returns an iterator that returns nodes of the underlying trie.
+// Iteration starts at the key after the given start key.
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 284
+func (t *StateTrie) NodeIterator(start []byte) (NodeIterator, error) {
+	return t.trie.NodeIterator(start)
+}
+
 // hashKey returns the hash of key as an ephemeral buffer.
 // The caller must not hold onto the return value because it will become
 // invalid on the next call to hashKey or secKey.
@@ -81,6 +206,18 @@ func (t *StateTrie) hashKey(key []byte) []byte {
 	return t.hashKeyBuf[:]
 }
 
+// getSecKeyCache returns the current secure key cache, creating a new one if
+// ownership changed (i.e. the current secure trie is a copy of another owning
+// the actual cache).
+// Original function: github.com/ethereum/go-ethereum/trie/secure_trie.go line 309
+func (t *StateTrie) getSecKeyCache() map[string][]byte {
+	if t != t.secKeyCacheOwner {
+		t.secKeyCacheOwner = t
+		t.secKeyCache = make(map[string][]byte)
+	}
+	return t.secKeyCache
+}
+
 func (t *StateTrie) PrintTrie() {
 	t.trie.PrintTrie()
 }
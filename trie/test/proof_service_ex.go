@@ -3,6 +3,7 @@ package test
 import (
 	"fmt"
 	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
 	"storage_extract/state"
 	"storage_extract/trie"
 	"storage_extract/types"
@@ -13,7 +14,7 @@ import (
 )
 
 func init_stateDB() *state.StateDB {
-	db := &state.CachingDB{}
+	db := state.NewDatabase(memorydb.New())
 	stateRoot := types.EmptyRootHash
 	stateDB, err := state.New(stateRoot, db)
 	if err != nil {
@@ -47,7 +48,8 @@ func Proof_Service_Try() {
 		prevValue := stateDB.SetState(contractAddr, key.Bytes32(), value.Bytes32())
 		fmt.Printf("  Previous Value: %x\n\n", prevValue)
 	}
-	stateDB.Commit(0, false)
+	// Hash the storage tries without committing, so they stay usable for proofs
+	stateDB.IntermediateRoot(false)
 	fmt.Println("StateDB initialized and storage items set successfully.")
 	obj := stateDB.GetStateObject(contractAddr)
 	for _, kv := range testStorage {
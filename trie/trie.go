@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"storage_extract/common"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb/database"
 	"storage_extract/types"
 )
 
@@ -16,12 +18,27 @@ type Trie struct {
 	root  node
 	owner common.Hash
 
+	// Flag whether the commit operation is already performed. If so the
+	// trie is not usable(latest states is invisible).
+	committed bool
+
+	// reader is the handler trie can retrieve nodes from.
+	reader *trieReader
+
 	// Keep track of the number leaves which have been inserted since the last
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes.
 	unhashed int
 
 	uncommitted int // uncommitted is the number of updates since last commit.
+
+	// tracer is the tool to track the trie changes.
+	tracer *tracer
+
+	// trace records the structural decisions of the writes, nil unless a
+	// recorder is attached.
+	// Notice: This field is not included in the original code.
+	trace *InsertTrace
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -30,39 +47,168 @@ func (t *Trie) newFlag() nodeFlag {
 }
 
 // New creates the trie instance with provided trie id and the read-only
-// database.
-// TODO: The current implementation doesn't use the database as a parameter.
-// Thus, it doesn't support:
-// 1. provide a reader
-// 2. read trie node from the database to initialize the root node
-func New(id *ID) (*Trie, error) {
+// database. The state specified by trie id must be available, otherwise
+// an error will be returned. The trie root specified by trie id can be
+// zero hash or the sha3 hash of an empty string, then trie is initially
+// empty, otherwise, the root node must be present in database or returns
+// a MissingNodeError if not.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 86
+func New(id *ID, db database.NodeDatabase) (*Trie, error) {
+	reader, err := newTrieReader(id.StateRoot, id.Owner, db)
+	if err != nil {
+		return nil, err
+	}
 	trie := &Trie{
-		owner: id.Owner,
+		owner:  id.Owner,
+		reader: reader,
+		tracer: newTracer(),
+	}
+	if id.Root != (common.Hash{}) && id.Root != types.EmptyRootHash {
+		rootnode, err := trie.resolveAndTrack(id.Root[:], nil)
+		if err != nil {
+			return nil, err
+		}
+		trie.root = rootnode
 	}
 	return trie, nil
 }
 
-// Different from the original code, missing the commit check logic
+// NodeIterator returns an iterator that returns nodes of the trie. Iteration starts at
+// the key after the given start key.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 124
+func (t *Trie) NodeIterator(start []byte) (NodeIterator, error) {
+	// Short circuit if the trie is already committed and not usable.
+	if t.committed {
+		return nil, ErrCommitted
+	}
+	return newNodeIterator(t, start), nil
+}
+
+// Get returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+//
+// If the requested node is not present in trie, no error will be returned.
+// If the trie is corrupted, a MissingNodeError is returned.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 147
+func (t *Trie) Get(key []byte) ([]byte, error) {
+	// Short circuit if the trie is already committed and not usable.
+	if t.committed {
+		return nil, ErrCommitted
+	}
+	value, newroot, didResolve, err := t.get(t.root, keybytesToHex(key), 0)
+	if err == nil && didResolve {
+		// Keep the resolved nodes in memory, so the next lookup doesn't
+		// hit the database again
+		t.root = newroot
+	}
+	return value, err
+}
+
+// get walks down the trie following the hex key starting at position pos.
+// Nodes resolved from the database on the way are linked into a copy of the
+// path, which is returned as newnode together with the didResolve marker.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 159
+func (t *Trie) get(origNode node, key []byte, pos int) (value []byte, newnode node, didResolve bool, err error) {
+	switch n := (origNode).(type) {
+	case nil:
+		// Reached an empty slot, the key is not in the trie
+		return nil, nil, false, nil
+	case valueNode:
+		return n, n, false, nil
+	case *shortNode:
+		// The remaining key must start with the short node's key, otherwise
+		// the path diverges here and the key doesn't exist.
+		// Example:
+		//   Existing: shortNode("hello") -> value1
+		//   Looking up: "help" -> not found, "hello" -> value1
+		if !bytes.HasPrefix(key[pos:], n.Key) {
+			return nil, n, false, nil
+		}
+		value, newnode, didResolve, err = t.get(n.Val, key, pos+len(n.Key))
+		if err == nil && didResolve {
+			n = n.copy()
+			n.Val = newnode
+		}
+		return value, n, didResolve, err
+	case *fullNode:
+		// Follow the child selected by the next nibble of the key
+		value, newnode, didResolve, err = t.get(n.Children[key[pos]], key, pos+1)
+		if err == nil && didResolve {
+			n = n.copy()
+			n.Children[key[pos]] = newnode
+		}
+		return value, n, didResolve, err
+	case hashNode:
+		// We've hit a part of the trie that isn't loaded yet. Load
+		// the node from the database and continue the lookup from it.
+		child, err := t.resolveAndTrack(n, key[:pos])
+		if err != nil {
+			return nil, n, true, err
+		}
+		value, newnode, _, err := t.get(child, key, pos)
+		return value, newnode, true, err
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", origNode, origNode))
+	}
+}
+
+// Update associates key with value in the trie. Subsequent calls to
+// Get will return value. If value has length zero, any existing value
+// is deleted from the trie and calls to Get will return nil.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 299
 func (t *Trie) Update(key, value []byte) error {
+	// Short circuit if the trie is already committed and not usable.
+	if t.committed {
+		return ErrCommitted
+	}
 	return t.update(key, value)
 }
 
+// Delete removes any existing value for key from the trie.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 417
+func (t *Trie) Delete(key []byte) error {
+	// Short circuit if the trie is already committed and not usable.
+	if t.committed {
+		return ErrCommitted
+	}
+	t.uncommitted++
+	t.unhashed++
+	k := keybytesToHex(key)
+	t.trace.begin(k, true)
+	_, n, err := t.delete(t.root, nil, k)
+	if err != nil {
+		t.trace.abort()
+		return err
+	}
+	t.root = n
+	t.trace.end(t.root)
+	return nil
+}
+
 // The current implementation use a dummy function func (t *Trie) Update(key, value []byte) error
 // Original function: github.com/ethereum/go-ethereum/trie/trie.go line 314
 func (t *Trie) update(key, value []byte) error {
 	t.unhashed++
 	t.uncommitted++
 	k := keybytesToHex(key)
+	t.trace.begin(k, len(value) == 0)
 	if len(value) != 0 {
 		_, n, err := t.insert(t.root, nil, k, valueNode(value))
 		if err != nil {
+			t.trace.abort()
+			return err
+		}
+		t.root = n
+	} else {
+		// An empty value removes the key from the trie
+		_, n, err := t.delete(t.root, nil, k)
+		if err != nil {
+			t.trace.abort()
 			return err
 		}
 		t.root = n
 	}
-
-	// TODO: Implement the logic for delete
-
+	t.trace.end(t.root)
 	return nil
 }
 
@@ -71,7 +217,16 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 	if len(key) == 0 {
 		if v, ok := n.(valueNode); ok {
 			// If there's already a value, only return true if new value is different
-			return !bytes.Equal(v, value.(valueNode)), value, nil
+			dirty := !bytes.Equal(v, value.(valueNode))
+			if dirty {
+				t.trace.onEvent(TraceUpdateValue, prefix, nil, 0, -1)
+			}
+			return dirty, value, nil
+		}
+		if !t.trace.isKey(prefix) {
+			// The rest of a split short node is empty, its child is
+			// moved into the slot of the new branch as is
+			t.trace.onEvent(TraceMove, prefix, nil, 0, -1)
 		}
 		return true, value, nil
 	}
@@ -87,6 +242,7 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 			//   Inserting: "hello-world" -> value2
 			//   matchlen = 5 (full match of "hello")
 			//   Action: Recurse with remaining path "-world"
+			t.trace.onEvent(TraceDescend, prefix, n.Key, matchlen, -1)
 			dirty, nn, err := t.insert(n.Val, append(prefix, key[:matchlen]...), key[matchlen:], value)
 			if !dirty || err != nil {
 				return false, n, err
@@ -99,6 +255,8 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		//   Inserting: "help" -> value2
 		//   matchlen = 3 (matched "hel")
 		//   Action: Create branch (full) node at 'l' vs 'p'
+		t.trace.onEvent(TraceSplit, prefix, n.Key, matchlen, -1)
+		t.trace.onEvent(TraceCreateBranch, append(prefix, key[:matchlen]...), nil, matchlen, -1)
 		branch := &fullNode{flags: t.newFlag()}
 		var err error
 		_, branch.Children[n.Key[matchlen]], err = t.insert(nil, append(prefix, n.Key[:matchlen+1]...), n.Key[matchlen+1:], n.Val)
@@ -120,9 +278,12 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		//          ├── 'l' -> shortNode("o") -> value1
 		//          └── 'p' -> value2
 
-		// TODO: tracer logic to track the changes of the trie
+		// Track the newly inserted branch node in the tracer. The node
+		// identifier passed is the path from the root node.
+		t.tracer.onInsert(append(prefix, key[:matchlen]...))
 
 		// Replace it with a short node leading up to the branch.
+		t.trace.onEvent(TraceExtension, prefix, key[:matchlen], matchlen, -1)
 		return true, &shortNode{key[:matchlen], branch, t.newFlag()}, nil
 	case *fullNode:
 		// fullNode has exactly 16 children, one for each hex character (0-f)
@@ -134,6 +295,7 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		if !dirty || err != nil {
 			return false, n, err
 		}
+		t.trace.onEvent(TraceCopyBranch, prefix, nil, 0, int(key[0]))
 		n = n.copy()
 		n.flags = t.newFlag()
 		n.Children[key[0]] = nn
@@ -153,15 +315,235 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		//           ├── [5] -> shortNode("abc") -> value2
 		//           └── [7] -> shortNode("xyz") -> value1
 
-		// TODO: tracer logic to track the changes of the trie
+		// New short node is created and track it in the tracer. The node
+		// identifier passed is the path from the root node. Note the valueNode
+		// won't be tracked since it's always embedded in its parent.
+		t.tracer.onInsert(prefix)
+		if t.trace.isKey(concat(prefix, key...)) {
+			t.trace.onEvent(TraceNewLeaf, prefix, key, 0, -1)
+		} else {
+			t.trace.onEvent(TraceMove, prefix, key, 0, -1)
+		}
 		return true, &shortNode{key, value, t.newFlag()}, nil
-	// case hashNode: is ignored for now as we don't hit part of the trie that's not loaded
+	case hashNode:
+		// We've hit a part of the trie that isn't loaded yet. Load
+		// the node and insert into it. This leaves all child nodes on
+		// the path to the value in the trie.
+		rn, err := t.resolveAndTrack(n, prefix)
+		if err != nil {
+			return false, nil, err
+		}
+		t.trace.onEvent(TraceResolve, prefix, nil, 0, -1)
+		dirty, nn, err := t.insert(rn, prefix, key, value)
+		if !dirty || err != nil {
+			return false, rn, err
+		}
+		return true, nn, nil
 
 	default:
 		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
 	}
 }
 
+// delete returns the new root of the trie with key deleted.
+// It reduces the trie to minimal form by simplifying
+// nodes on the way up after deleting recursively.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 436
+func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
+	switch n := n.(type) {
+	case *shortNode:
+		matchlen := prefixLen(key, n.Key)
+		if matchlen < len(n.Key) {
+			// The key diverges inside the short node, so it's not in the trie.
+			// Example:
+			//   Existing: shortNode("hello") -> value1
+			//   Deleting: "help"
+			//   Action: Nothing to delete, keep the node as it is
+			return false, n, nil // don't replace n on mismatch
+		}
+		if matchlen == len(key) {
+			// The whole remaining key is consumed by this short node, which
+			// means it is the leaf holding the value. Remove it entirely
+			// and track it in the deletion set. The valueNode doesn't
+			// need to be tracked at all since it's always embedded.
+			t.tracer.onDelete(prefix)
+			t.trace.onEvent(TraceDeleteLeaf, prefix, n.Key, matchlen, -1)
+			return true, nil, nil // remove n entirely for whole matches
+		}
+		// The key is longer than n.Key. Remove the remaining suffix
+		// from the subtrie. Child can never be nil here since the
+		// subtrie must contain at least two other values with keys
+		// longer than n.Key.
+		t.trace.onEvent(TraceDescend, prefix, n.Key, matchlen, -1)
+		dirty, child, err := t.delete(n.Val, append(prefix, key[:len(n.Key)]...), key[len(n.Key):])
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		switch child := child.(type) {
+		case *shortNode:
+			// Deleting from the subtrie reduced it to another
+			// short node. Merge the nodes to avoid creating a
+			// shortNode{..., shortNode{...}}. Use concat (which
+			// always creates a new slice) instead of append to
+			// avoid modifying n.Key since it might be shared with
+			// other nodes.
+			// Example:
+			//   Before: shortNode("hel")
+			//              └── branch
+			//                  ├── 'l' -> shortNode("o") -> value1
+			//                  └── 'p' -> value2
+			//   Deleting: "help"
+			//   After:  shortNode("hel" + "l" + "o") -> value1
+			// The child shortNode is merged into its parent, track
+			// is deleted as well.
+			t.tracer.onDelete(append(prefix, n.Key...))
+			t.trace.onEvent(TraceMerge, prefix, concat(n.Key, child.Key...), 0, -1)
+			return true, &shortNode{concat(n.Key, child.Key...), child.Val, t.newFlag()}, nil
+		default:
+			return true, &shortNode{n.Key, child, t.newFlag()}, nil
+		}
+
+	case *fullNode:
+		dirty, nn, err := t.delete(n.Children[key[0]], append(prefix, key[0]), key[1:])
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		t.trace.onEvent(TraceCopyBranch, prefix, nil, 0, int(key[0]))
+		n = n.copy()
+		n.flags = t.newFlag()
+		n.Children[key[0]] = nn
+
+		// Because n is a full node, it must've contained at least two children
+		// before the delete operation. If the new child value is non-nil, n still
+		// has at least two children after the deletion, and cannot be reduced to
+		// a short node.
+		if nn != nil {
+			return true, n, nil
+		}
+		// Reduction:
+		// Check how many non-nil entries are left after deleting and
+		// reduce the full node to a short node if only one entry is
+		// left. Since n must've contained at least two children
+		// before deletion (otherwise it would not be a full node) n
+		// can never be reduced to nil.
+		//
+		// When the loop is done, pos contains the index of the single
+		// value that is left in n or -2 if n contains at least two
+		// values.
+		pos := -1
+		for i, cld := range &n.Children {
+			if cld != nil {
+				if pos == -1 {
+					pos = i
+				} else {
+					pos = -2
+					break
+				}
+			}
+		}
+		if pos >= 0 {
+			if pos != 16 {
+				// If the remaining entry is a short node, it replaces
+				// n and its key gets the missing nibble tacked to the
+				// front. This avoids creating an invalid
+				// shortNode{..., shortNode{...}}. Since the entry
+				// might not be loaded yet, resolve it just for this
+				// check.
+				// Example:
+				//   Before: branch
+				//           ├── [3] -> shortNode("abc") -> value1
+				//           └── [7] -> shortNode("xyz") -> value2
+				//   Deleting: "7xyz"
+				//   After:  shortNode("3abc") -> value1
+				cnode, err := t.resolve(n.Children[pos], append(prefix, byte(pos)))
+				if err != nil {
+					return false, nil, err
+				}
+				if cnode, ok := cnode.(*shortNode); ok {
+					// Replace the entire full node with the short node.
+					// Mark the original short node as deleted since the
+					// value is embedded into the parent now.
+					t.tracer.onDelete(append(prefix, byte(pos)))
+					k := append([]byte{byte(pos)}, cnode.Key...)
+					t.trace.onEvent(TraceReduceBranch, prefix, k, 0, pos)
+					return true, &shortNode{k, cnode.Val, t.newFlag()}, nil
+				}
+			}
+			// Otherwise, n is replaced by a one-nibble short node
+			// containing the child.
+			// Example:
+			//   Before: branch
+			//           ├── [3] -> branch(...)
+			//           └── [7] -> shortNode("xyz") -> value2
+			//   Deleting: "7xyz"
+			//   After:  shortNode("3") -> branch(...)
+			t.trace.onEvent(TraceReduceBranch, prefix, []byte{byte(pos)}, 0, pos)
+			return true, &shortNode{[]byte{byte(pos)}, n.Children[pos], t.newFlag()}, nil
+		}
+		// n still contains at least two values and cannot be reduced.
+		return true, n, nil
+
+	case valueNode:
+		return true, nil, nil
+
+	case nil:
+		// The key is not in the trie, nothing to delete
+		return false, nil, nil
+
+	case hashNode:
+		// We've hit a part of the trie that isn't loaded yet. Load
+		// the node and delete from it. This leaves all child nodes on
+		// the path to the value in the trie.
+		rn, err := t.resolveAndTrack(n, prefix)
+		if err != nil {
+			return false, nil, err
+		}
+		t.trace.onEvent(TraceResolve, prefix, nil, 0, -1)
+		dirty, nn, err := t.delete(rn, prefix, key)
+		if !dirty || err != nil {
+			return false, rn, err
+		}
+		return true, nn, nil
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v (%v)", n, n, key))
+	}
+}
+
+// concat returns a newly allocated slice holding s1 followed by s2.
+func concat(s1 []byte, s2 ...byte) []byte {
+	r := make([]byte, len(s1)+len(s2))
+	copy(r, s1)
+	copy(r[len(s1):], s2)
+	return r
+}
+
+// resolve loads the node behind a hashNode, other node types are returned as is.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 603
+func (t *Trie) resolve(n node, prefix []byte) (node, error) {
+	if n, ok := n.(hashNode); ok {
+		return t.resolveAndTrack(n, prefix)
+	}
+	return n, nil
+}
+
+// resolveAndTrack loads node from the underlying store with the given node hash
+// and path prefix and also tracks the loaded node blob in tracer treated as the
+// node's original value. The rlp-encoded blob is preferred to be loaded from
+// database because it's easy to decode node while complex to encode node to blob.
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 614
+func (t *Trie) resolveAndTrack(n hashNode, prefix []byte) (node, error) {
+	blob, err := t.reader.node(prefix, common.BytesToHash(n))
+	if err != nil {
+		return nil, err
+	}
+	t.tracer.onRead(prefix, blob)
+
+	// The returned node blob won't be changed afterward. No need to
+	// deep-copy the slice.
+	return decodeNodeUnsafe(n, blob)
+}
+
 // Hash returns the root hash of the trie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 // Original function: github.com/ethereum/go-ethereum/trie/trie.go line 609
@@ -171,6 +553,54 @@ func (t *Trie) Hash() common.Hash {
 	return common.BytesToHash(hash.(hashNode))
 }
 
+// Commit collects all dirty nodes in the trie and replaces them with the
+// corresponding node hash. All collected nodes (including dirty leaves if
+// collectLeaf is true) will be encapsulated into a nodeset for return.
+// The returned nodeset can be nil if the trie is clean (nothing to commit).
+// Once the trie is committed, it's not usable anymore. A new trie must
+// be created with new root and updated trie database for following usage
+// Original function: github.com/ethereum/go-ethereum/trie/trie.go line 638
+func (t *Trie) Commit(collectLeaf bool) (common.Hash, *trienode.NodeSet) {
+	defer func() {
+		t.committed = true
+	}()
+	// Trie is empty and can be classified into two types of situations:
+	// (a) The trie was empty and no update happens => return nil
+	// (b) The trie was non-empty and all nodes are dropped => return
+	//     the node set includes all deleted nodes
+	if t.root == nil {
+		paths := t.tracer.deletedNodes()
+		if len(paths) == 0 {
+			return types.EmptyRootHash, nil // case (a)
+		}
+		nodes := trienode.NewNodeSet(t.owner)
+		for _, path := range paths {
+			nodes.AddNode([]byte(path), trienode.NewDeleted())
+		}
+		return types.EmptyRootHash, nodes // case (b)
+	}
+	// Derive the hash for all dirty nodes first. We hold the assumption
+	// in the following procedure that all nodes are hashed.
+	rootHash := t.Hash()
+
+	// Do a quick check if we really need to commit. This can happen e.g.
+	// if we load a trie for reading storage values, but don't write to it.
+	if hashedNode, dirty := t.root.cache(); !dirty {
+		// Replace the root node with the origin hash in order to
+		// ensure all resolved nodes are dropped after the commit.
+		t.root = hashedNode
+		return rootHash, nil
+	}
+	nodes := trienode.NewNodeSet(t.owner)
+	for _, path := range t.tracer.deletedNodes() {
+		nodes.AddNode([]byte(path), trienode.NewDeleted())
+	}
+	// If the number of changes is below 100, we let one thread handle it
+	t.root = newCommitter(nodes, t.tracer, collectLeaf).Commit(t.root, t.uncommitted > 100)
+	t.uncommitted = 0
+	return rootHash, nodes
+}
+
 // hashRoot calculates the root hash of the given trie
 // Oringinal function: github.com/ethereum/go-ethereum/trie/trie.go line 663
 func (t *Trie) hashRoot() (node, node) {
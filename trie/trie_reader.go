@@ -0,0 +1,51 @@
+package trie
+
+import (
+	"storage_extract/common"
+	"storage_extract/triedb/database"
+	"storage_extract/types"
+)
+
+// trieReader is a wrapper of the underlying node reader. It's not safe
+// for concurrent usage.
+type trieReader struct {
+	owner  common.Hash
+	reader database.NodeReader
+}
+
+// newTrieReader initializes the trie reader with the given node reader.
+// Different from the original code, a nil database is accepted and treated
+// as an empty reader, since CachingDB can be used without a trie database.
+// Original function: github.com/ethereum/go-ethereum/trie/trie_reader.go line 36
+func newTrieReader(stateRoot, owner common.Hash, db database.NodeDatabase) (*trieReader, error) {
+	if stateRoot == (common.Hash{}) || stateRoot == types.EmptyRootHash || db == nil {
+		return &trieReader{owner: owner}, nil
+	}
+	reader, err := db.NodeReader(stateRoot)
+	if err != nil {
+		return nil, &MissingNodeError{Owner: owner, NodeHash: stateRoot, err: err}
+	}
+	return &trieReader{owner: owner, reader: reader}, nil
+}
+
+// newEmptyReader initializes the pure in-memory reader. All read operations
+// should be forbidden and returns the MissingNodeError.
+// Original function: github.com/ethereum/go-ethereum/trie/trie_reader.go line 47
+func newEmptyReader() *trieReader {
+	return &trieReader{}
+}
+
+// node retrieves the rlp-encoded trie node with the provided trie node
+// information. An MissingNodeError will be returned in case the node is
+// not found or any error is encountered.
+// Original function: github.com/ethereum/go-ethereum/trie/trie_reader.go line 57
+func (r *trieReader) node(path []byte, hash common.Hash) ([]byte, error) {
+	if r.reader == nil {
+		return nil, &MissingNodeError{Owner: r.owner, NodeHash: hash, Path: path}
+	}
+	blob, err := r.reader.Node(r.owner, path, hash)
+	if err != nil || len(blob) == 0 {
+		return nil, &MissingNodeError{Owner: r.owner, NodeHash: hash, Path: path, err: err}
+	}
+	return blob, nil
+}
@@ -0,0 +1,456 @@
+package trie_test
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/rawdb"
+	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb"
+	"storage_extract/triedb/pathdb"
+	"storage_extract/types"
+
+	gethrawdb "github.com/ethereum/go-ethereum/core/rawdb"
+	gethtrie "github.com/ethereum/go-ethereum/trie"
+	gethtriedb "github.com/ethereum/go-ethereum/triedb"
+)
+
+// The tests of this package check the trie against the go-ethereum one, which
+// it's ported from: the same operations must lead to the same root hashes,
+// values and proofs.
+
+// randomKey returns a key for the random tests: mostly short keys drawn from a
+// small alphabet, so that they share prefixes and the small nodes get embedded
+// in their parents, and now and then a full 32-byte key.
+func randomKey(rnd *rand.Rand) []byte {
+	if rnd.Intn(4) == 0 {
+		key := make([]byte, 32)
+		rnd.Read(key)
+		return key
+	}
+	key := make([]byte, 1+rnd.Intn(4))
+	for i := range key {
+		key[i] = byte(rnd.Intn(4)) * 0x11
+	}
+	return key
+}
+
+// randomValue returns a non-empty value of up to 40 bytes, long enough to move
+// some of the leaves out of their parents.
+func randomValue(rnd *rand.Rand) []byte {
+	value := make([]byte, 1+rnd.Intn(40))
+	rnd.Read(value)
+	return value
+}
+
+// newDatabase opens the trie database with the given config on top of the
+// key-value store.
+func newDatabase(t *testing.T, disk ethdb.KeyValueStore, config *triedb.Config) *triedb.Database {
+	t.Helper()
+
+	db, err := triedb.NewDatabase(disk, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newEmpty creates an empty trie on top of a fresh node database with the
+// given config.
+func newEmpty(t *testing.T, config *triedb.Config) (*trie.Trie, *triedb.Database) {
+	t.Helper()
+
+	db := newDatabase(t, memorydb.New(), config)
+	tr, err := trie.New(trie.StateTrieID(types.EmptyRootHash), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr, db
+}
+
+// newGethEmpty creates an empty go-ethereum trie.
+func newGethEmpty() *gethtrie.Trie {
+	return gethtrie.NewEmpty(gethtriedb.NewDatabase(gethrawdb.NewMemoryDatabase(), nil))
+}
+
+// commit commits the trie into the node database as the state following the
+// given one, flushes it to disk and reopens the trie at the new root.
+func commit(t *testing.T, tr *trie.Trie, db *triedb.Database, parent common.Hash, block uint64) (*trie.Trie, common.Hash) {
+	t.Helper()
+
+	root, set := tr.Commit(false)
+	if set != nil {
+		if err := db.Update(root, parent, block, trienode.NewWithNodeSet(set)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Commit(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reopened, err := trie.New(trie.StateTrieID(root), db)
+	if err != nil {
+		t.Fatalf("failed to reopen the trie at %x: %v", root, err)
+	}
+	return reopened, root
+}
+
+// sortedKeys returns the keys of the content in ascending order.
+func sortedKeys(content map[string][]byte) []string {
+	keys := make([]string, 0, len(content))
+	for key := range content {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkContent verifies that the trie holds exactly the given content.
+func checkContent(t *testing.T, tr *trie.Trie, content map[string][]byte) {
+	t.Helper()
+
+	for key, want := range content {
+		have, err := tr.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("key %x: %v", key, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("key %x: value mismatch: have %x, want %x", key, have, want)
+		}
+	}
+	nodeIt, err := tr.NodeIterator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for it := trie.NewIterator(nodeIt); it.Next(); {
+		keys = append(keys, string(it.Key))
+	}
+	if want := sortedKeys(content); !equalStrings(keys, want) {
+		t.Fatalf("iterated keys mismatch: have %x, want %x", keys, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Tests that random updates and deletes, including the ones that collapse
+// branch nodes into short nodes, lead to the same roots as in go-ethereum.
+func TestRandomRoots(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		tr, _ := newEmpty(t, triedb.HashDefaults)
+		geth := newGethEmpty()
+		content := make(map[string][]byte)
+
+		for op := 0; op < 200; op++ {
+			key := randomKey(rnd)
+			if rnd.Intn(3) == 0 {
+				if err := tr.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+				geth.MustDelete(key)
+				delete(content, string(key))
+			} else {
+				value := randomValue(rnd)
+				if err := tr.Update(key, value); err != nil {
+					t.Fatal(err)
+				}
+				geth.MustUpdate(key, value)
+				content[string(key)] = value
+			}
+			if op%20 == 0 {
+				if have, want := tr.Hash(), geth.Hash(); have != common.Hash(want) {
+					t.Fatalf("round %d op %d: root mismatch: have %x, want %x", round, op, have, want)
+				}
+			}
+		}
+		if have, want := tr.Hash(), geth.Hash(); have != common.Hash(want) {
+			t.Fatalf("round %d: root mismatch: have %x, want %x", round, have, want)
+		}
+		checkContent(t, tr, content)
+	}
+}
+
+// Tests that deleting every key brings the trie back to the empty root.
+func TestDeleteAll(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	tr, _ := newEmpty(t, triedb.HashDefaults)
+	var keys [][]byte
+	for i := 0; i < 100; i++ {
+		key := randomKey(rnd)
+		keys = append(keys, key)
+		if err := tr.Update(key, randomValue(rnd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rnd.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for _, key := range keys {
+		if err := tr.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if root := tr.Hash(); root != types.EmptyRootHash {
+		t.Fatalf("root mismatch: have %x, want %x", root, types.EmptyRootHash)
+	}
+}
+
+// Tests that a trie committed into the hash and the path scheme databases can
+// be reopened from its root, read back and modified further, over several
+// consecutive commits.
+func TestCommitReopen(t *testing.T) {
+	for _, tt := range []struct {
+		scheme string
+		config *triedb.Config
+	}{
+		{rawdb.HashScheme, triedb.HashDefaults},
+		{rawdb.PathScheme, triedb.PathDefaults},
+	} {
+		t.Run(tt.scheme, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(3))
+			tr, db := newEmpty(t, tt.config)
+			geth := newGethEmpty()
+			content := make(map[string][]byte)
+			parent := types.EmptyRootHash
+
+			for block := uint64(1); block <= 10; block++ {
+				for op := 0; op < 50; op++ {
+					key := randomKey(rnd)
+					if rnd.Intn(4) == 0 {
+						if err := tr.Delete(key); err != nil {
+							t.Fatal(err)
+						}
+						geth.MustDelete(key)
+						delete(content, string(key))
+					} else {
+						value := randomValue(rnd)
+						if err := tr.Update(key, value); err != nil {
+							t.Fatal(err)
+						}
+						geth.MustUpdate(key, value)
+						content[string(key)] = value
+					}
+				}
+				var root common.Hash
+				tr, root = commit(t, tr, db, parent, block)
+				if want := geth.Hash(); root != common.Hash(want) {
+					t.Fatalf("block %d: root mismatch: have %x, want %x", block, root, want)
+				}
+				checkContent(t, tr, content)
+				parent = root
+			}
+		})
+	}
+}
+
+// Tests that every committed state stays readable in the hash and the path
+// scheme databases, including once the node database is reopened on the same
+// disk and further states are committed on top.
+func TestHistoricalStates(t *testing.T) {
+	for _, config := range []*triedb.Config{triedb.HashDefaults, triedb.PathDefaults} {
+		disk := memorydb.New()
+		db := newDatabase(t, disk, config)
+		t.Run(db.Scheme(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(5))
+			tr, err := trie.New(trie.StateTrieID(types.EmptyRootHash), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				roots    = []common.Hash{types.EmptyRootHash}
+				contents = []map[string][]byte{{}}
+			)
+			write := func(db *triedb.Database, blocks int) {
+				for i := 0; i < blocks; i++ {
+					content := make(map[string][]byte)
+					for key, value := range contents[len(contents)-1] {
+						content[key] = value
+					}
+					for op := 0; op < 1+rnd.Intn(20); op++ {
+						key := randomKey(rnd)
+						if rnd.Intn(3) == 0 {
+							if err := tr.Delete(key); err != nil {
+								t.Fatal(err)
+							}
+							delete(content, string(key))
+						} else {
+							value := randomValue(rnd)
+							if err := tr.Update(key, value); err != nil {
+								t.Fatal(err)
+							}
+							content[string(key)] = value
+						}
+					}
+					var root common.Hash
+					tr, root = commit(t, tr, db, roots[len(roots)-1], uint64(len(roots)))
+					roots, contents = append(roots, root), append(contents, content)
+				}
+			}
+			check := func(db *triedb.Database) {
+				for i, root := range roots {
+					historical, err := trie.New(trie.StateTrieID(root), db)
+					if err != nil {
+						t.Fatalf("state %d: %v", i, err)
+					}
+					checkContent(t, historical, contents[i])
+				}
+			}
+			write(db, 10)
+			check(db)
+
+			db = newDatabase(t, disk, config)
+			check(db)
+			tr, err = trie.New(trie.StateTrieID(roots[len(roots)-1]), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			write(db, 5)
+			check(db)
+		})
+	}
+}
+
+// Tests that the path scheme keeps the histories of the configured number of
+// recent state transitions only: the older states are no longer readable, also
+// once the database is reopened, while the recent ones are.
+func TestHistoryLimit(t *testing.T) {
+	var (
+		disk     = memorydb.New()
+		config   = &triedb.Config{PathDB: &pathdb.Config{StateHistory: 3, WriteBufferSize: pathdb.Defaults.WriteBufferSize}}
+		db       = newDatabase(t, disk, config)
+		roots    = []common.Hash{types.EmptyRootHash}
+		contents = []map[string][]byte{{}}
+	)
+	tr, err := trie.New(trie.StateTrieID(types.EmptyRootHash), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for block := uint64(1); block <= 8; block++ {
+		content := make(map[string][]byte)
+		for key, value := range contents[len(contents)-1] {
+			content[key] = value
+		}
+		key, value := []byte{byte(block % 3), byte(block)}, []byte{byte(block)}
+		if err := tr.Update(key, value); err != nil {
+			t.Fatal(err)
+		}
+		content[string(key)] = value
+
+		root, set := tr.Commit(false)
+		if err := db.Update(root, roots[len(roots)-1], block, trienode.NewWithNodeSet(set)); err != nil {
+			t.Fatal(err)
+		}
+		// Flush every other state, so that histories are pruned both before
+		// and after they're written to disk
+		if block%2 == 0 {
+			if err := db.Commit(root); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tr, err = trie.New(trie.StateTrieID(root), db); err != nil {
+			t.Fatal(err)
+		}
+		roots, contents = append(roots, root), append(contents, content)
+	}
+	check := func(db *triedb.Database) {
+		// The state the oldest kept history starts from is readable as well
+		oldest := len(roots) - 1 - int(config.PathDB.StateHistory)
+		for i, root := range roots[1:oldest] {
+			if _, err := trie.New(trie.StateTrieID(root), db); err == nil {
+				t.Fatalf("state %d: readable after its history was pruned", i+1)
+			}
+		}
+		for i, root := range roots[oldest:] {
+			historical, err := trie.New(trie.StateTrieID(root), db)
+			if err != nil {
+				t.Fatalf("state %d: %v", oldest+i, err)
+			}
+			checkContent(t, historical, contents[oldest+i])
+		}
+	}
+	check(db)
+	if tail := rawdb.ReadTrieHistoryTail(disk); tail != 5 {
+		t.Fatalf("history tail mismatch: have %d, want 5", tail)
+	}
+	for id := uint64(1); id <= 8; id++ {
+		if stored := rawdb.ReadTrieHistory(disk, id) != nil; stored != (id > 5) {
+			t.Fatalf("history %d: stored=%v", id, stored)
+		}
+	}
+	check(newDatabase(t, disk, config))
+}
+
+// Tests that the path scheme database fails to open on a corrupt history,
+// reporting an error.
+func TestCorruptHistory(t *testing.T) {
+	disk := memorydb.New()
+	if err := rawdb.WriteTrieHistory(disk, 1, []byte{0xc1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := triedb.NewDatabase(disk, triedb.PathDefaults); err == nil {
+		t.Fatal("database opened on a corrupt history")
+	}
+}
+
+// Tests that the key-value iterator returns the leaves in key order, like the
+// go-ethereum one, and that seeking starts at the first key not below the
+// given one.
+func TestIteratorOrder(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	tr, db := newEmpty(t, triedb.HashDefaults)
+	geth := newGethEmpty()
+	for i := 0; i < 300; i++ {
+		key, value := randomKey(rnd), randomValue(rnd)
+		if err := tr.Update(key, value); err != nil {
+			t.Fatal(err)
+		}
+		geth.MustUpdate(key, value)
+	}
+	// Iterate over the committed trie, so that the hashed nodes are resolved
+	tr, _ = commit(t, tr, db, types.EmptyRootHash, 1)
+	for _, start := range [][]byte{nil, {0x11}, {0x22, 0x33}, {0x80}, {0xff, 0xff}} {
+		nodeIt, err := tr.NodeIterator(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gethNodeIt, err := geth.NodeIterator(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it, gethIt := trie.NewIterator(nodeIt), gethtrie.NewIterator(gethNodeIt)
+		var prev []byte
+		for n := 0; ; n++ {
+			more, gethMore := it.Next(), gethIt.Next()
+			if more != gethMore {
+				t.Fatalf("start %x: iterator length mismatch at %d: have %v, want %v", start, n, more, gethMore)
+			}
+			if !more {
+				break
+			}
+			if !bytes.Equal(it.Key, gethIt.Key) || !bytes.Equal(it.Value, gethIt.Value) {
+				t.Fatalf("start %x: entry %d mismatch: have %x=%x, want %x=%x", start, n, it.Key, it.Value, gethIt.Key, gethIt.Value)
+			}
+			if bytes.Compare(it.Key, start) < 0 || (prev != nil && bytes.Compare(prev, it.Key) >= 0) {
+				t.Fatalf("start %x: key %x out of order", start, it.Key)
+			}
+			prev = it.Key
+		}
+		if it.Err != nil {
+			t.Fatal(it.Err)
+		}
+	}
+}
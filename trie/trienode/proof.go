@@ -5,6 +5,10 @@ import (
 	"sync"
 
 	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/ethdb"
+
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // ProofSet stores a set of trie nodes. It implements trie.Database and can also
@@ -55,3 +59,109 @@ func (db *ProofSet) Has(key []byte) (bool, error) {
 	_, err := db.Get(key)
 	return err == nil, nil
 }
+
+// Delete removes a node from the set
+func (db *ProofSet) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	keystr := string(key)
+	entry, ok := db.nodes[keystr]
+	if !ok {
+		return nil
+	}
+	delete(db.nodes, keystr)
+	for i, k := range db.order {
+		if k == keystr {
+			db.order = append(db.order[:i], db.order[i+1:]...)
+			break
+		}
+	}
+	db.dataSize -= len(entry)
+	return nil
+}
+
+// KeyCount returns the number of nodes in the set
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 94
+func (db *ProofSet) KeyCount() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return len(db.nodes)
+}
+
+// DataSize returns the aggregated data size of nodes in the set
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 102
+func (db *ProofSet) DataSize() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.dataSize
+}
+
+// List converts the node set to a slice of bytes.
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 110
+func (db *ProofSet) List() [][]byte {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	values := make([][]byte, len(db.order))
+	for i, key := range db.order {
+		values[i] = db.nodes[key]
+	}
+	return values
+}
+
+// Store writes the contents of the set to the given database
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 122
+func (db *ProofSet) Store(target ethdb.KeyValueWriter) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for key, value := range db.nodes {
+		target.Put([]byte(key), value)
+	}
+}
+
+// ProofList stores an ordered list of trie nodes. It implements ethdb.KeyValueWriter.
+// Original type: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 132
+type ProofList []rlp.RawValue
+
+// Store writes the contents of the list to the given database
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 135
+func (n ProofList) Store(db ethdb.KeyValueWriter) {
+	for _, node := range n {
+		db.Put(crypto.Keccak256Hash(node).Bytes(), node)
+	}
+}
+
+// Set converts the node list to a ProofSet
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 142
+func (n ProofList) Set() *ProofSet {
+	db := NewProofSet()
+	n.Store(db)
+	return db
+}
+
+// Put stores a new node at the end of the list
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 149
+func (n *ProofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+// Delete panics as there's no reason to remove a node from the list.
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 155
+func (n *ProofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// DataSize returns the aggregated data size of nodes in the list
+// Original function: github.com/ethereum/go-ethereum/trie/trienode/proof.go line 160
+func (n ProofList) DataSize() int {
+	var size int
+	for _, node := range n {
+		size += len(node)
+	}
+	return size
+}
@@ -0,0 +1,243 @@
+// Package triedb provides the trie node database sitting between the tries
+// and the key-value disk database.
+package triedb
+
+import (
+	"errors"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/rawdb"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb/database"
+	"storage_extract/triedb/hashdb"
+	"storage_extract/triedb/pathdb"
+)
+
+// Config defines all necessary options for database.
+type Config struct {
+	Preimages bool           // Flag whether the preimage of node key is recorded
+	HashDB    *hashdb.Config // Configs for hash-based scheme
+	PathDB    *pathdb.Config // Configs for experimental path-based scheme
+}
+
+// HashDefaults represents a config for using hash-based scheme with
+// default settings.
+//
+// Different from the original code, preimages are recorded by default so that
+// the hashed storage keys can always be mapped back to the original slots.
+var HashDefaults = &Config{
+	Preimages: true,
+	HashDB:    hashdb.Defaults,
+}
+
+// PathDefaults represents a config for using path-based scheme with
+// default settings. Preimages are recorded by default, see HashDefaults.
+var PathDefaults = &Config{
+	Preimages: true,
+	PathDB:    pathdb.Defaults,
+}
+
+// backend defines the methods needed to access/update trie nodes in different
+// state scheme.
+// Original interface: github.com/ethereum/go-ethereum/triedb/database.go line 57
+type backend interface {
+	// NodeReader returns a reader for accessing trie nodes within the specified state.
+	// An error will be returned if the specified state is not available.
+	NodeReader(root common.Hash) (database.NodeReader, error)
+
+	// Size returns the current storage size of the diff layers on top of the
+	// disk layer and the storage size of the nodes cached in the disk layer.
+	//
+	// For hash scheme, there is no differentiation between diff layer nodes
+	// and dirty disk layer nodes, so both are merged into the second return.
+	Size() (common.StorageSize, common.StorageSize)
+
+	// Commit writes all relevant trie nodes belonging to the specified state
+	// to disk.
+	Commit(root common.Hash) error
+
+	// Close closes the trie database backend and releases all held resources.
+	Close() error
+}
+
+// Database is the wrapper of the underlying backend which is shared by different
+// types of node backend as an entrypoint. It's responsible for all interactions
+// relevant with trie nodes.
+// Original struct: github.com/ethereum/go-ethereum/triedb/database.go line 84
+type Database struct {
+	disk      ethdb.KeyValueStore
+	config    *Config        // Configuration for trie database
+	preimages *preimageStore // The store for caching preimages
+	backend   backend        // The backend for managing trie nodes
+}
+
+// NewDatabase initializes the trie database with default settings, note
+// the legacy hash-based scheme is used by default.
+//
+// Different from the original code, an error is returned if the path-based
+// backend can't load the histories it keeps.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 93
+func NewDatabase(diskdb ethdb.KeyValueStore, config *Config) (*Database, error) {
+	// Sanitize the config and use the default one if it's not specified.
+	if config == nil {
+		config = HashDefaults
+	}
+	var preimages *preimageStore
+	if config.Preimages {
+		preimages = newPreimageStore(diskdb)
+	}
+	db := &Database{
+		disk:      diskdb,
+		config:    config,
+		preimages: preimages,
+	}
+	if config.HashDB != nil && config.PathDB != nil {
+		panic("both 'hash' and 'path' mode are configured")
+	}
+	if config.PathDB != nil {
+		backend, err := pathdb.New(diskdb, config.PathDB)
+		if err != nil {
+			return nil, err
+		}
+		db.backend = backend
+	} else {
+		db.backend = hashdb.New(diskdb, config.HashDB)
+	}
+	return db, nil
+}
+
+// NodeReader returns a reader for accessing trie nodes within the specified state.
+// An error will be returned if the specified state is not available.
+func (db *Database) NodeReader(blockRoot common.Hash) (database.NodeReader, error) {
+	return db.backend.NodeReader(blockRoot)
+}
+
+// Update performs a state transition by committing dirty nodes contained in the
+// given set in order to update state from the specified parent to the specified
+// root. The held pre-images accumulated up to this point will be flushed in case
+// the size exceeds the threshold.
+//
+// The passed in maps(nodes) will be retained to avoid copying everything.
+// Therefore, these maps must not be changed afterwards.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 136
+func (db *Database) Update(root common.Hash, parent common.Hash, block uint64, nodes *trienode.MergedNodeSet) error {
+	if db.preimages != nil {
+		if err := db.preimages.commit(false); err != nil {
+			return err
+		}
+	}
+	switch b := db.backend.(type) {
+	case *hashdb.Database:
+		return b.Update(root, parent, block, nodes)
+	case *pathdb.Database:
+		return b.Update(root, parent, block, nodes)
+	}
+	return errors.New("unknown backend")
+}
+
+// Commit iterates over all the children of a particular node, writes them out
+// to disk. As a side effect, all pre-images accumulated up to this point are
+// also written.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 155
+func (db *Database) Commit(root common.Hash) error {
+	if db.preimages != nil {
+		if err := db.preimages.commit(true); err != nil {
+			return err
+		}
+	}
+	return db.backend.Commit(root)
+}
+
+// Size returns the storage size of diff layer nodes above the persistent disk
+// layer and the dirty nodes buffered within the disk layer.
+func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	return db.backend.Size()
+}
+
+// Scheme returns the node scheme used in the database.
+func (db *Database) Scheme() string {
+	if db.config.PathDB != nil {
+		return rawdb.PathScheme
+	}
+	return rawdb.HashScheme
+}
+
+// Close flushes the dangling preimages to disk and closes the trie database.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 188
+func (db *Database) Close() error {
+	if err := db.WritePreimages(); err != nil {
+		return err
+	}
+	return db.backend.Close()
+}
+
+// WritePreimages flushes all accumulated preimages to disk forcibly.
+// Different from the original code, a failed write is returned.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 194
+func (db *Database) WritePreimages() error {
+	if db.preimages != nil {
+		return db.preimages.commit(true)
+	}
+	return nil
+}
+
+// Preimage retrieves a cached trie node pre-image from preimage store.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 201
+func (db *Database) Preimage(hash common.Hash) []byte {
+	if db.preimages == nil {
+		return nil
+	}
+	return db.preimages.preimage(hash)
+}
+
+// InsertPreimage writes pre-images of trie node to the preimage store.
+// Original function: github.com/ethereum/go-ethereum/triedb/database.go line 209
+func (db *Database) InsertPreimage(preimages map[common.Hash][]byte) {
+	if db.preimages == nil {
+		return
+	}
+	db.preimages.insertPreimage(preimages)
+}
+
+// Cap iteratively flushes old but still referenced trie nodes until the total
+// memory usage goes below the given threshold.
+//
+// It's only supported by hash-based database and will return an error for others.
+func (db *Database) Cap(limit common.StorageSize) error {
+	hdb, ok := db.backend.(*hashdb.Database)
+	if !ok {
+		return errors.New("not supported")
+	}
+	return hdb.Cap(limit)
+}
+
+// Reference adds a new reference from a parent node to a child node. This function
+// is used to add reference between internal trie node and external node(e.g. storage
+// trie root), all internal trie nodes are referenced together by database itself.
+//
+// It's only supported by hash-based database and will return an error for others.
+func (db *Database) Reference(root common.Hash, parent common.Hash) error {
+	hdb, ok := db.backend.(*hashdb.Database)
+	if !ok {
+		return errors.New("not supported")
+	}
+	hdb.Reference(root, parent)
+	return nil
+}
+
+// Dereference removes an existing reference from a root node. It's only
+// supported by hash-based database and will return an error for others.
+func (db *Database) Dereference(root common.Hash) error {
+	hdb, ok := db.backend.(*hashdb.Database)
+	if !ok {
+		return errors.New("not supported")
+	}
+	hdb.Dereference(root)
+	return nil
+}
+
+// Disk returns the underlying disk database.
+func (db *Database) Disk() ethdb.KeyValueStore {
+	return db.disk
+}
@@ -0,0 +1,18 @@
+package database
+
+import "storage_extract/common"
+
+// NodeReader wraps the Node method of a backing trie reader.
+type NodeReader interface {
+	// Node retrieves the trie node blob with the provided trie identifier,
+	// node path and the corresponding node hash. No error will be returned
+	// if the node is not found.
+	Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error)
+}
+
+// NodeDatabase wraps the methods of a backing trie store.
+type NodeDatabase interface {
+	// NodeReader returns a node reader associated with the specific state.
+	// An error will be returned if the specified state is not available.
+	NodeReader(stateRoot common.Hash) (NodeReader, error)
+}
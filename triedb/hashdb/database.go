@@ -0,0 +1,518 @@
+// Package hashdb implements the hash-based trie node database, where nodes are
+// keyed by their own hash and the dirty ones are reference counted in memory
+// before being flushed to disk.
+package hashdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/rawdb"
+	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb/database"
+	"storage_extract/types"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Config contains the settings for database.
+// The clean cache of the original code is not ported, so there is nothing
+// to configure for now.
+type Config struct{}
+
+// Defaults is the default setting for database if it's not specified.
+var Defaults = &Config{}
+
+// Database is an intermediate write layer between the trie data structures and
+// the disk database. The aim is to accumulate trie writes in-memory and only
+// periodically flush a couple tries to disk, garbage collecting the remainder.
+// Original struct: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 83
+type Database struct {
+	diskdb  ethdb.KeyValueStore         // Persistent storage for matured trie nodes
+	dirties map[common.Hash]*cachedNode // Data and references relationships of dirty trie nodes
+	oldest  common.Hash                 // Oldest tracked node, flush-list head
+	newest  common.Hash                 // Newest tracked node, flush-list tail
+
+	gctime  time.Duration      // Time spent on garbage collection since last commit
+	gcnodes uint64             // Nodes garbage collected since last commit
+	gcsize  common.StorageSize // Data storage garbage collected since last commit
+
+	flushtime  time.Duration      // Time spent on data flushing since last commit
+	flushnodes uint64             // Nodes flushed since last commit
+	flushsize  common.StorageSize // Data storage flushed since last commit
+
+	dirtiesSize  common.StorageSize // Storage size of the dirty node cache (exc. metadata)
+	childrenSize common.StorageSize // Storage size of the external children tracking
+
+	lock sync.RWMutex
+}
+
+// cachedNode is all the information we know about a single cached trie node
+// in the memory database write layer.
+type cachedNode struct {
+	node      []byte                   // Encoded node blob, immutable
+	parents   uint32                   // Number of live nodes referencing this one
+	external  map[common.Hash]struct{} // The set of external children
+	flushPrev common.Hash              // Previous node in the flush-list
+	flushNext common.Hash              // Next node in the flush-list
+}
+
+// cachedNodeSize is the raw size of a cachedNode data structure without any
+// node data included. It's an approximate size, but should be a lot better
+// than not counting them.
+var cachedNodeSize = int(reflect.TypeOf(cachedNode{}).Size())
+
+// forChildren invokes the callback for all the tracked children of this node,
+// both the implicit ones from inside the node as well as the explicit ones
+// from outside the node.
+func (n *cachedNode) forChildren(onChild func(hash common.Hash)) {
+	for child := range n.external {
+		onChild(child)
+	}
+	trie.ForGatherChildren(n.node, onChild)
+}
+
+// New initializes the hash-based node database.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 127
+func New(diskdb ethdb.KeyValueStore, config *Config) *Database {
+	return &Database{
+		diskdb:  diskdb,
+		dirties: make(map[common.Hash]*cachedNode),
+	}
+}
+
+// insert inserts a trie node into the memory database. All nodes inserted by
+// this function will be reference tracked. This function assumes the lock is
+// already held.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 145
+func (db *Database) insert(hash common.Hash, node []byte) {
+	// If the node's already cached, skip
+	if _, ok := db.dirties[hash]; ok {
+		return
+	}
+	// Create the cached entry for this node
+	entry := &cachedNode{
+		node:      node,
+		flushPrev: db.newest,
+	}
+	entry.forChildren(func(child common.Hash) {
+		if c := db.dirties[child]; c != nil {
+			c.parents++
+		}
+	})
+	db.dirties[hash] = entry
+
+	// Update the flush-list endpoints
+	if db.oldest == (common.Hash{}) {
+		db.oldest, db.newest = hash, hash
+	} else {
+		db.dirties[db.newest].flushNext, db.newest = hash, hash
+	}
+	db.dirtiesSize += common.StorageSize(common.HashLength + len(node))
+}
+
+// node retrieves an encoded cached trie node from memory. If it cannot be found
+// cached, the method queries the persistent database for the content.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 175
+func (db *Database) node(hash common.Hash) ([]byte, error) {
+	// It doesn't make sense to retrieve the metaroot
+	if hash == (common.Hash{}) {
+		return nil, errors.New("not found")
+	}
+	// Retrieve the node from the dirty cache if available.
+	db.lock.RLock()
+	dirty := db.dirties[hash]
+	db.lock.RUnlock()
+
+	// Return the cached node if it's found in the dirty set.
+	// The dirty.node field is immutable and safe to read it
+	// even without lock guard.
+	if dirty != nil {
+		return dirty.node, nil
+	}
+	// Content unavailable in memory, attempt to retrieve from disk
+	enc := rawdb.ReadLegacyTrieNode(db.diskdb, hash)
+	if len(enc) != 0 {
+		return enc, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// Reference adds a new reference from a parent node to a child node.
+// This function is used to add reference between internal trie node
+// and external node(e.g. storage trie root), all internal trie nodes
+// are referenced together by database itself.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 220
+func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.reference(child, parent)
+}
+
+// reference is the private locked version of Reference.
+func (db *Database) reference(child common.Hash, parent common.Hash) {
+	// If the node does not exist, it's a node pulled from disk, skip
+	node, ok := db.dirties[child]
+	if !ok {
+		return
+	}
+	// The reference is for state root, increase the reference counter.
+	if parent == (common.Hash{}) {
+		node.parents += 1
+		return
+	}
+	// The reference is for external storage trie, don't duplicate if
+	// the reference is already existent.
+	if db.dirties[parent].external == nil {
+		db.dirties[parent].external = make(map[common.Hash]struct{})
+	}
+	if _, ok := db.dirties[parent].external[child]; ok {
+		return
+	}
+	node.parents++
+	db.dirties[parent].external[child] = struct{}{}
+	db.childrenSize += common.HashLength
+}
+
+// Dereference removes an existing reference from a root node.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 253
+func (db *Database) Dereference(root common.Hash) {
+	// Sanity check to ensure that the meta-root is not removed
+	if root == (common.Hash{}) {
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
+	db.dereference(root)
+
+	db.gcnodes += uint64(nodes - len(db.dirties))
+	db.gcsize += storage - db.dirtiesSize
+	db.gctime += time.Since(start)
+}
+
+// dereference is the private locked version of Dereference.
+func (db *Database) dereference(hash common.Hash) {
+	// If the node does not exist, it's a previously committed node.
+	node, ok := db.dirties[hash]
+	if !ok {
+		return
+	}
+	// If there are no more references to the node, delete it and cascade
+	if node.parents > 0 {
+		// This is a special cornercase where a node loaded from disk (i.e. not in the
+		// memcache any more) gets reinjected as a new node (short node split into full,
+		// then reverted into short), causing a cached node to have no parents. That is
+		// no problem in itself, but don't make maxint parents out of it.
+		node.parents--
+	}
+	if node.parents == 0 {
+		// Remove the node from the flush-list
+		db.unlink(hash, node)
+
+		// Dereference all children and delete the node
+		node.forChildren(func(child common.Hash) {
+			db.dereference(child)
+		})
+		delete(db.dirties, hash)
+		db.dirtiesSize -= common.StorageSize(common.HashLength + len(node.node))
+		if node.external != nil {
+			db.childrenSize -= common.StorageSize(len(node.external) * common.HashLength)
+		}
+	}
+}
+
+// unlink removes the node from the flush-list. This function assumes the lock
+// is already held.
+// Notice: This function is not included in the original code, where the same
+// switch is inlined into dereference and the cleaner.
+func (db *Database) unlink(hash common.Hash, node *cachedNode) {
+	switch hash {
+	case db.oldest:
+		db.oldest = node.flushNext
+		if node.flushNext != (common.Hash{}) {
+			db.dirties[node.flushNext].flushPrev = common.Hash{}
+		}
+	case db.newest:
+		db.newest = node.flushPrev
+		if node.flushPrev != (common.Hash{}) {
+			db.dirties[node.flushPrev].flushNext = common.Hash{}
+		}
+	default:
+		db.dirties[node.flushPrev].flushNext = node.flushNext
+		db.dirties[node.flushNext].flushPrev = node.flushPrev
+	}
+}
+
+// Cap iteratively flushes old but still referenced trie nodes until the total
+// memory usage goes below the given threshold.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 328
+func (db *Database) Cap(limit common.StorageSize) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// Create a database batch to flush persistent data out. It is important that
+	// outside code doesn't see an inconsistent state (referenced data removed from
+	// memory cache during commit but not yet in persistent storage). This is ensured
+	// by only uncaching existing data when the database write finalizes.
+	batch := db.diskdb.NewBatch()
+	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
+
+	// db.dirtiesSize only contains the useful data in the cache, but when reporting
+	// the total memory consumption, the maintenance metadata is also needed to be
+	// counted.
+	size := db.dirtiesSize + common.StorageSize(len(db.dirties)*cachedNodeSize)
+	size += db.childrenSize
+
+	// Keep committing nodes from the flush-list until we're below allowance
+	oldest := db.oldest
+	for size > limit && oldest != (common.Hash{}) {
+		// Fetch the oldest referenced node and push into the batch
+		node := db.dirties[oldest]
+		if err := rawdb.WriteLegacyTrieNode(batch, oldest, node.node); err != nil {
+			return err
+		}
+		// If we exceeded the ideal batch size, commit and reset
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return fmt.Errorf("failed to write flush list to disk: %v", err)
+			}
+			batch.Reset()
+		}
+		// Iterate to the next flush item, or abort if the size cap was achieved. Size
+		// is the total size, including the useful cached data (hash -> blob), the
+		// cache item metadata, as well as external children mappings.
+		size -= common.StorageSize(common.HashLength + len(node.node) + cachedNodeSize)
+		if node.external != nil {
+			size -= common.StorageSize(len(node.external) * common.HashLength)
+		}
+		oldest = node.flushNext
+	}
+	// Flush out any remainder data from the last batch
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write flush list to disk: %v", err)
+	}
+	// Write successful, clear out the flushed data
+	for db.oldest != oldest {
+		node := db.dirties[db.oldest]
+		delete(db.dirties, db.oldest)
+		db.oldest = node.flushNext
+
+		db.dirtiesSize -= common.StorageSize(common.HashLength + len(node.node))
+		if node.external != nil {
+			db.childrenSize -= common.StorageSize(len(node.external) * common.HashLength)
+		}
+	}
+	if db.oldest != (common.Hash{}) {
+		db.dirties[db.oldest].flushPrev = common.Hash{}
+	}
+	db.flushnodes += uint64(nodes - len(db.dirties))
+	db.flushsize += storage - db.dirtiesSize
+	db.flushtime += time.Since(start)
+	return nil
+}
+
+// Commit iterates over all the children of a particular node, writes them out
+// to disk, forcefully tearing down all references in both directions.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 407
+func (db *Database) Commit(node common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// Create a database batch to flush persistent data out. It is important that
+	// outside code doesn't see an inconsistent state (referenced data removed from
+	// memory cache during commit but not yet in persistent storage). This is ensured
+	// by only uncaching existing data when the database write finalizes.
+	batch := db.diskdb.NewBatch()
+
+	// Move the trie itself into the batch, flushing if enough data is accumulated
+	uncacher := &cleaner{db}
+	if err := db.commit(node, batch, uncacher); err != nil {
+		return fmt.Errorf("failed to commit trie from trie database: %v", err)
+	}
+	// Trie mostly committed to disk, flush any batch leftovers
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write trie to disk: %v", err)
+	}
+	// Uncache any leftovers in the last batch
+	if err := batch.Replay(uncacher); err != nil {
+		return err
+	}
+	batch.Reset()
+
+	// Reset the garbage collection statistics
+	db.gcnodes, db.gcsize, db.gctime = 0, 0, 0
+	db.flushnodes, db.flushsize, db.flushtime = 0, 0, 0
+
+	return nil
+}
+
+// commit is the private locked version of Commit.
+func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleaner) error {
+	// If the node does not exist, it's a previously committed node
+	node, ok := db.dirties[hash]
+	if !ok {
+		return nil
+	}
+	var err error
+
+	// Dereference all children and delete the node
+	node.forChildren(func(child common.Hash) {
+		if err == nil {
+			err = db.commit(child, batch, uncacher)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// If we've reached an optimal batch size, commit and start over
+	if err := rawdb.WriteLegacyTrieNode(batch, hash, node.node); err != nil {
+		return err
+	}
+	if batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		err := batch.Replay(uncacher)
+		if err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	return nil
+}
+
+// cleaner is a database batch replayer that takes a batch of write operations
+// and cleans up the trie database from anything written to disk.
+type cleaner struct {
+	db *Database
+}
+
+// Put reacts to database writes and implements dirty data uncaching. This is the
+// post-processing step of a commit operation where the already persisted trie is
+// removed from the dirty cache. The reason behind the two-phase commit is to
+// ensure data availability while moving from memory to disk.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 493
+func (c *cleaner) Put(key []byte, rlp []byte) error {
+	hash := common.BytesToHash(key)
+
+	// If the node does not exist, we're done on this path
+	node, ok := c.db.dirties[hash]
+	if !ok {
+		return nil
+	}
+	// Node still exists, remove it from the flush-list
+	c.db.unlink(hash, node)
+
+	// Remove the node from the dirty cache
+	delete(c.db.dirties, hash)
+	c.db.dirtiesSize -= common.StorageSize(common.HashLength + len(node.node))
+	if node.external != nil {
+		c.db.childrenSize -= common.StorageSize(len(node.external) * common.HashLength)
+	}
+	return nil
+}
+
+func (c *cleaner) Delete(key []byte) error {
+	panic("not implemented")
+}
+
+// Update inserts the dirty nodes in provided nodeset into database and link the
+// account trie with multiple storage tries if necessary.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 539
+func (db *Database) Update(root common.Hash, parent common.Hash, block uint64, nodes *trienode.MergedNodeSet) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// Insert dirty nodes into the database. In the same tree, it must be
+	// ensured that children are inserted first, then parent so that children
+	// can be linked with their parent correctly.
+	//
+	// Note, the storage tries must be flushed before the account trie to
+	// retain the invariant that children go into the dirty cache first.
+	var order []common.Hash
+	for owner := range nodes.Sets {
+		if owner == (common.Hash{}) {
+			continue
+		}
+		order = append(order, owner)
+	}
+	if _, ok := nodes.Sets[common.Hash{}]; ok {
+		order = append(order, common.Hash{})
+	}
+	for _, owner := range order {
+		subset := nodes.Sets[owner]
+		subset.ForEachWithOrder(func(path string, n *trienode.Node) {
+			if n.IsDeleted() {
+				return // ignore deletion
+			}
+			db.insert(n.Hash, n.Blob)
+		})
+	}
+	// Link up the account trie and storage trie if the node points
+	// to an account trie leaf.
+	if set, present := nodes.Sets[common.Hash{}]; present {
+		for _, n := range set.Leaves {
+			var account types.StateAccount
+			if err := rlp.DecodeBytes(n.Blob, &account); err != nil {
+				return err
+			}
+			if account.Root != types.EmptyRootHash {
+				db.reference(account.Root, n.Parent)
+			}
+		}
+	}
+	return nil
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+//
+// The first return will always be 0, representing the memory stored in unbounded
+// diff layers above the dirty cache. This is only available in pathdb.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 594
+func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	// db.dirtiesSize only contains the useful data in the cache, but when reporting
+	// the total memory consumption, the maintenance metadata is also needed to be
+	// counted.
+	var metadataSize = common.StorageSize(len(db.dirties) * cachedNodeSize)
+	return 0, db.dirtiesSize + db.childrenSize + metadataSize
+}
+
+// Close closes the trie database and releases all held resources.
+func (db *Database) Close() error {
+	return nil
+}
+
+// NodeReader returns a reader for accessing trie nodes within the specified state.
+// An error will be returned if the specified state is not available.
+// Original function: github.com/ethereum/go-ethereum/triedb/hashdb/database.go line 616
+func (db *Database) NodeReader(root common.Hash) (database.NodeReader, error) {
+	if _, err := db.node(root); err != nil {
+		return nil, fmt.Errorf("state %#x is not available, %v", root, err)
+	}
+	return &reader{db: db}, nil
+}
+
+// reader is a state reader of Database which implements the Reader interface.
+type reader struct {
+	db *Database
+}
+
+// Node retrieves the trie node with the given node hash. No error will be
+// returned if the node is not found.
+func (reader *reader) Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	blob, _ := reader.db.node(hash)
+	return blob, nil
+}
@@ -0,0 +1,111 @@
+package hashdb
+
+import (
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/trie"
+	"storage_extract/trie/trienode"
+	"storage_extract/types"
+)
+
+// commitTrie commits a trie holding the given key-value pairs into the dirty
+// cache of the database and returns its root.
+func commitTrie(t *testing.T, db *Database, kvs map[string]string) common.Hash {
+	t.Helper()
+
+	tr, err := trie.New(trie.StateTrieID(types.EmptyRootHash), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range kvs {
+		if err := tr.Update([]byte(k), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, nodes := tr.Commit(false)
+	if err := db.Update(root, types.EmptyRootHash, 0, trienode.NewWithNodeSet(nodes)); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// readable reports whether every node of the trie with the given root can be
+// loaded from the database.
+func readable(db *Database, root common.Hash) bool {
+	tr, err := trie.New(trie.StateTrieID(root), db)
+	if err != nil {
+		return false
+	}
+	it, err := tr.NodeIterator(nil)
+	if err != nil {
+		return false
+	}
+	for it.Next(true) {
+	}
+	return it.Error() == nil
+}
+
+// Tests that dereferencing a root garbage collects the dirty nodes no other
+// root references, and that the nodes flushed to disk outlive it.
+func TestDereference(t *testing.T) {
+	db := New(memorydb.New(), nil)
+
+	// The two tries share the leaf of key "shared"
+	var (
+		kvs1  = map[string]string{"shared": "value", "doe": "reindeer", "dog": "puppy"}
+		kvs2  = map[string]string{"shared": "value", "horse": "stallion"}
+		root1 = commitTrie(t, db, kvs1)
+		root2 = commitTrie(t, db, kvs2)
+	)
+	db.Reference(root1, common.Hash{})
+	db.Reference(root2, common.Hash{})
+
+	_, before := db.Size()
+	db.Dereference(root1)
+	if _, after := db.Size(); after >= before {
+		t.Fatalf("dirty cache didn't shrink: before %v, after %v", before, after)
+	}
+	if _, err := db.node(root1); err == nil {
+		t.Fatal("dereferenced root is still in the dirty cache")
+	}
+	if !readable(db, root2) {
+		t.Fatal("root still referenced is not readable")
+	}
+
+	// Flushed nodes aren't tracked any more, dereferencing them is a noop
+	if err := db.Commit(root2); err != nil {
+		t.Fatal(err)
+	}
+	db.Dereference(root2)
+	if !readable(db, root2) {
+		t.Fatal("committed root is not readable after dereference")
+	}
+	if _, dirty := db.Size(); dirty != 0 {
+		t.Fatalf("dirty cache not empty after commit: %v", dirty)
+	}
+}
+
+// Tests that Cap flushes the oldest dirty nodes to disk until the cache fits
+// into the limit, keeping every trie readable.
+func TestCap(t *testing.T) {
+	db := New(memorydb.New(), nil)
+
+	root1 := commitTrie(t, db, map[string]string{"doe": "reindeer", "dog": "puppy"})
+	root2 := commitTrie(t, db, map[string]string{"horse": "stallion", "dogglesworth": "cat"})
+	db.Reference(root1, common.Hash{})
+	db.Reference(root2, common.Hash{})
+
+	if err := db.Cap(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, dirty := db.Size(); dirty != 0 {
+		t.Fatalf("dirty cache not empty after capping to zero: %v", dirty)
+	}
+	for _, root := range []common.Hash{root1, root2} {
+		if !readable(db, root) {
+			t.Fatalf("trie %x not readable after cap", root)
+		}
+	}
+}
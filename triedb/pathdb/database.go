@@ -0,0 +1,298 @@
+// Package pathdb implements the path-based trie node database, where nodes are
+// keyed by their owner and path so that each position in a trie holds exactly
+// one version of the node on disk.
+//
+// Different from the original code, there are no diff layers: all committed
+// node sets are aggregated in a single dirty buffer on top of the disk. The
+// previous states stay accessible through the trie node histories, the reverse
+// diffs recorded by every state transition.
+package pathdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"storage_extract/common"
+	"storage_extract/crypto"
+	"storage_extract/ethdb"
+	"storage_extract/rawdb"
+	"storage_extract/trie/trienode"
+	"storage_extract/triedb/database"
+)
+
+const (
+	// defaultBufferSize is the default memory allowance of the dirty node buffer.
+	defaultBufferSize = 64 * 1024 * 1024
+
+	// defaultStateHistory is the default number of the latest state transitions
+	// whose histories are kept.
+	defaultStateHistory = 128
+)
+
+// Config contains the settings for database.
+type Config struct {
+	StateHistory    uint64 // Number of recent state transitions to keep the history of, 0 for all
+	WriteBufferSize int    // Maximum memory allowance (in bytes) for write buffer
+}
+
+// Defaults is the default setting for database if it's not specified.
+var Defaults = &Config{
+	StateHistory:    defaultStateHistory,
+	WriteBufferSize: defaultBufferSize,
+}
+
+// Database is a path-based trie node database. Dirty nodes are aggregated in
+// memory and flushed to disk once the buffer is full or Commit is called.
+// Original struct: github.com/ethereum/go-ethereum/triedb/pathdb/database.go line 210
+type Database struct {
+	diskdb    ethdb.KeyValueStore // Persistent storage for matured trie nodes
+	config    *Config             // Configuration for database
+	buffer    *nodeSet            // Aggregated dirty nodes waiting to be flushed
+	histories []*history          // Reverse diffs of the state transitions, oldest first
+	tail      uint64              // Id of the last pruned history, the first one kept has the next id
+	flushed   uint64              // Id of the last history written to disk
+	lock      sync.RWMutex
+}
+
+// New initializes the path-based node database on top of the given key-value
+// store, along with the histories of the states it holds.
+//
+// Different from the original code, an error is returned if the histories
+// can't be loaded, instead of crashing.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/database.go line 233
+func New(diskdb ethdb.KeyValueStore, config *Config) (*Database, error) {
+	if config == nil {
+		config = Defaults
+	}
+	histories, tail, err := readHistories(diskdb)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trie histories: %v", err)
+	}
+	db := &Database{
+		diskdb:    diskdb,
+		config:    config,
+		buffer:    newNodeSet(nil),
+		histories: histories,
+		tail:      tail,
+		flushed:   tail + uint64(len(histories)),
+	}
+	// The histories may have been written with a higher limit
+	if err := db.truncate(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Update merges the dirty nodes of a state transition into the write buffer,
+// which is flushed if it exceeds the configured allowance. The nodes they
+// replace are recorded as the history of the transition beforehand.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/database.go line 346
+func (db *Database) Update(root common.Hash, parentRoot common.Hash, block uint64, nodes *trienode.MergedNodeSet) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	flat := nodes.Flatten()
+	if root != parentRoot {
+		h := &history{
+			parent: parentRoot,
+			root:   root,
+			block:  block,
+			nodes:  make(map[common.Hash]map[string][]byte),
+		}
+		for owner, subset := range flat {
+			prev := make(map[string][]byte, len(subset))
+			for path := range subset {
+				prev[path] = db.blob(db.head(), owner, []byte(path))
+			}
+			h.nodes[owner] = prev
+		}
+		db.histories = append(db.histories, h)
+		if err := db.truncate(); err != nil {
+			return err
+		}
+	}
+	db.buffer.merge(newNodeSet(flat))
+	if db.buffer.size > uint64(db.config.WriteBufferSize) {
+		return db.flush()
+	}
+	return nil
+}
+
+// Commit writes the buffered trie nodes to disk. Since only the latest state
+// is kept, the whole write buffer is flushed regardless of the given root.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/database.go line 381
+func (db *Database) Commit(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.flush()
+}
+
+// flush writes the buffered nodes into the disk along with the histories of
+// the transitions they come from, and empties the buffer. This function
+// assumes the lock is already held.
+func (db *Database) flush() error {
+	batch := db.diskdb.NewBatchWithSize(int(db.buffer.size))
+	if _, err := db.buffer.write(batch); err != nil {
+		return err
+	}
+	// The histories pruned before being flushed are never written
+	for id := max(db.flushed, db.tail) + 1; id <= db.head(); id++ {
+		blob, err := db.histories[id-db.tail-1].encode()
+		if err != nil {
+			return err
+		}
+		if err := rawdb.WriteTrieHistory(batch, id, blob); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write trie nodes to disk: %v", err)
+	}
+	db.buffer.reset()
+	db.flushed = db.head()
+	return nil
+}
+
+// head returns the id of the latest history, which is also the index of the
+// latest state in the sequence of the states the histories lead through. This
+// function assumes the lock is already held.
+func (db *Database) head() uint64 {
+	return db.tail + uint64(len(db.histories))
+}
+
+// truncate prunes the oldest histories beyond the configured limit, deleting
+// the ones already written to disk. The states before their transitions can't
+// be read anymore. This function assumes the lock is already held.
+//
+// Different from the original code, which truncates the state histories in the
+// freezer, the histories are deleted from the key-value store.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/history.go line 626
+func (db *Database) truncate() error {
+	limit := db.config.StateHistory
+	if limit == 0 || uint64(len(db.histories)) <= limit {
+		return nil
+	}
+	var (
+		batch = db.diskdb.NewBatch()
+		tail  = db.head() - limit
+	)
+	for id := db.tail + 1; id <= min(tail, db.flushed); id++ {
+		if err := rawdb.DeleteTrieHistory(batch, id); err != nil {
+			return err
+		}
+	}
+	if err := rawdb.WriteTrieHistoryTail(batch, tail); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to prune trie histories: %v", err)
+	}
+	// Release the pruned histories for the garbage collector
+	n := tail - db.tail
+	for i := uint64(0); i < n; i++ {
+		db.histories[i] = nil
+	}
+	db.histories = db.histories[n:]
+	db.tail = tail
+	return nil
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+//
+// The first return will always be 0 since there are no diff layers, the
+// second return is the size of the write buffer.
+func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return 0, common.StorageSize(db.buffer.size)
+}
+
+// Close closes the trie database and releases all held resources.
+func (db *Database) Close() error {
+	return nil
+}
+
+// NodeReader retrieves a layer belonging to the given state root.
+//
+// Different from the original code, there are no layers to pick from. A state
+// the database transitioned from is read through the histories of the
+// transitions since the last time it was left, any other root through the
+// latest state. Every node read is verified against the requested hash, so the
+// states never committed, or whose histories are pruned, are reported as
+// missing nodes.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/reader.go line 160
+func (db *Database) NodeReader(root common.Hash) (database.NodeReader, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	from := db.head()
+	for i := len(db.histories) - 1; i >= 0; i-- {
+		if db.histories[i].root == root {
+			from = db.tail + uint64(i) + 1
+			break
+		}
+		if db.histories[i].parent == root {
+			from = db.tail + uint64(i)
+			break
+		}
+	}
+	return &reader{db: db, from: from}, nil
+}
+
+// node retrieves the trie node with the given owner and path in the state
+// before the transition of the given history and the ones after it.
+func (db *Database) node(from uint64, owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	db.lock.RLock()
+	if from < db.tail {
+		db.lock.RUnlock()
+		return nil, errors.New("state history pruned")
+	}
+	blob := db.blob(from, owner, path)
+	db.lock.RUnlock()
+
+	if len(blob) == 0 {
+		return nil, errors.New("not found")
+	}
+	if got := crypto.Keccak256Hash(blob); got != hash {
+		return nil, fmt.Errorf("unexpected node: (%x %v), %x!=%x", owner, path, hash, got)
+	}
+	return blob, nil
+}
+
+// blob retrieves the node blob with the given owner and path in the state
+// before the transition of the given history and the ones after it, nil if
+// the node doesn't exist. The histories are checked first, oldest first, then
+// the write buffer and at last the disk. The history must not be pruned. This
+// function assumes the lock is already held.
+func (db *Database) blob(from uint64, owner common.Hash, path []byte) []byte {
+	for _, h := range db.histories[from-db.tail:] {
+		if blob, ok := h.node(owner, path); ok {
+			return blob
+		}
+	}
+	if n, ok := db.buffer.node(owner, path); ok {
+		return n.Blob
+	}
+	if owner == (common.Hash{}) {
+		return rawdb.ReadAccountTrieNode(db.diskdb, path)
+	}
+	return rawdb.ReadStorageTrieNode(db.diskdb, owner, path)
+}
+
+// reader implements the database.NodeReader interface, providing the
+// functionalities to retrieve trie nodes by path.
+type reader struct {
+	db   *Database
+	from uint64 // Id of the history leading to the state read, the histories after it are read through
+}
+
+// Node implements database.NodeReader interface, retrieving the node with
+// specified node info.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/reader.go line 64
+func (r *reader) Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	return r.db.node(r.from, owner, path, hash)
+}
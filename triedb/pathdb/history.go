@@ -0,0 +1,114 @@
+package pathdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/rawdb"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// history is the reverse diff of a state transition: the blobs the trie nodes
+// written by the transition had before it, so that the state it started from
+// can still be read once the nodes are overwritten in place.
+//
+// Different from the original code, which records the account and storage
+// values changed by a transition (state history) to roll the disk layer back,
+// the previous trie nodes are recorded here and the historical states are read
+// through them, without touching the latest state.
+// Notice: This struct is not included in the original code.
+type history struct {
+	parent common.Hash                       // State root the transition started from
+	root   common.Hash                       // State root the transition led to
+	block  uint64                            // Block number of the transition
+	nodes  map[common.Hash]map[string][]byte // Previous node blobs by owner and path, empty if the node didn't exist
+}
+
+// historyNode is a previous trie node in the encoded history.
+type historyNode struct {
+	Owner common.Hash
+	Path  []byte
+	Blob  []byte
+}
+
+// historyRLP is the encoded history.
+type historyRLP struct {
+	Parent common.Hash
+	Root   common.Hash
+	Block  uint64
+	Nodes  []historyNode // Sorted by owner and path
+}
+
+// node returns the blob the node with the given owner and path had before the
+// transition, and whether the transition wrote the node at all.
+func (h *history) node(owner common.Hash, path []byte) ([]byte, bool) {
+	subset, ok := h.nodes[owner]
+	if !ok {
+		return nil, false
+	}
+	blob, ok := subset[string(path)]
+	return blob, ok
+}
+
+// encode serializes the history.
+func (h *history) encode() ([]byte, error) {
+	enc := historyRLP{Parent: h.parent, Root: h.root, Block: h.block}
+	for owner, subset := range h.nodes {
+		for path, blob := range subset {
+			enc.Nodes = append(enc.Nodes, historyNode{Owner: owner, Path: []byte(path), Blob: blob})
+		}
+	}
+	sort.Slice(enc.Nodes, func(i, j int) bool {
+		if c := bytes.Compare(enc.Nodes[i].Owner[:], enc.Nodes[j].Owner[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(enc.Nodes[i].Path, enc.Nodes[j].Path) < 0
+	})
+	return rlp.EncodeToBytes(&enc)
+}
+
+// decodeHistory deserializes a history.
+func decodeHistory(blob []byte) (*history, error) {
+	var dec historyRLP
+	if err := rlp.DecodeBytes(blob, &dec); err != nil {
+		return nil, err
+	}
+	h := &history{
+		parent: dec.Parent,
+		root:   dec.Root,
+		block:  dec.Block,
+		nodes:  make(map[common.Hash]map[string][]byte),
+	}
+	for _, n := range dec.Nodes {
+		if _, ok := h.nodes[n.Owner]; !ok {
+			h.nodes[n.Owner] = make(map[string][]byte)
+		}
+		h.nodes[n.Owner][string(n.Path)] = n.Blob
+	}
+	return h, nil
+}
+
+// readHistories loads the histories stored in the key-value store, oldest
+// first, along with the id of the last pruned one. The ids of the stored ones
+// follow it without gaps.
+func readHistories(diskdb ethdb.KeyValueReader) ([]*history, uint64, error) {
+	var (
+		histories []*history
+		tail      = rawdb.ReadTrieHistoryTail(diskdb)
+	)
+	for id := tail + 1; ; id++ {
+		blob := rawdb.ReadTrieHistory(diskdb, id)
+		if blob == nil {
+			return histories, tail, nil
+		}
+		h, err := decodeHistory(blob)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to decode trie history %d: %v", id, err)
+		}
+		histories = append(histories, h)
+	}
+}
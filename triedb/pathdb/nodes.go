@@ -0,0 +1,161 @@
+package pathdb
+
+import (
+	"maps"
+
+	"storage_extract/common"
+	"storage_extract/ethdb"
+	"storage_extract/rawdb"
+	"storage_extract/trie/trienode"
+)
+
+// nodeSet represents a collection of modified trie nodes resulting from a state
+// transition, typically corresponding to a block execution. It can also represent
+// the combined trie node set from several aggregated state transitions.
+// Original struct: github.com/ethereum/go-ethereum/triedb/pathdb/nodes.go line 37
+type nodeSet struct {
+	size         uint64                                    // aggregated size of the trie node
+	accountNodes map[string]*trienode.Node                 // account trie nodes, mapped by path
+	storageNodes map[common.Hash]map[string]*trienode.Node // storage trie nodes, mapped by owner and path
+}
+
+// newNodeSet constructs the set with the provided dirty trie nodes.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/nodes.go line 44
+func newNodeSet(nodes map[common.Hash]map[string]*trienode.Node) *nodeSet {
+	// Don't panic for the lazy callers, initialize the nil map instead
+	if nodes == nil {
+		nodes = make(map[common.Hash]map[string]*trienode.Node)
+	}
+	s := &nodeSet{
+		accountNodes: make(map[string]*trienode.Node),
+		storageNodes: make(map[common.Hash]map[string]*trienode.Node),
+	}
+	for owner, subset := range nodes {
+		if owner == (common.Hash{}) {
+			s.accountNodes = subset
+		} else {
+			s.storageNodes[owner] = subset
+		}
+	}
+	s.computeSize()
+	return s
+}
+
+// computeSize calculates the database size of the held trie nodes.
+func (s *nodeSet) computeSize() {
+	var size uint64
+	for path, n := range s.accountNodes {
+		size += uint64(len(n.Blob) + len(path))
+	}
+	for _, subset := range s.storageNodes {
+		for path, n := range subset {
+			size += uint64(common.HashLength + len(n.Blob) + len(path))
+		}
+	}
+	s.size = size
+}
+
+// updateSize updates the total cache size by the given delta.
+func (s *nodeSet) updateSize(delta int64) {
+	size := int64(s.size) + delta
+	if size >= 0 {
+		s.size = uint64(size)
+		return
+	}
+	s.size = 0
+}
+
+// node retrieves the trie node with node path and its trie identifier.
+func (s *nodeSet) node(owner common.Hash, path []byte) (*trienode.Node, bool) {
+	// Account trie node
+	if owner == (common.Hash{}) {
+		n, ok := s.accountNodes[string(path)]
+		return n, ok
+	}
+	// Storage trie node
+	subset, ok := s.storageNodes[owner]
+	if !ok {
+		return nil, false
+	}
+	n, ok := subset[string(path)]
+	return n, ok
+}
+
+// merge integrates the provided dirty nodes into the set. The provided nodeset
+// will remain unchanged.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/nodes.go line 107
+func (s *nodeSet) merge(set *nodeSet) {
+	var delta int64 // size difference resulting from node merging
+
+	// Merge account nodes
+	for path, n := range set.accountNodes {
+		if orig, exist := s.accountNodes[path]; !exist {
+			delta += int64(len(n.Blob) + len(path))
+		} else {
+			delta += int64(len(n.Blob) - len(orig.Blob))
+		}
+		s.accountNodes[path] = n
+	}
+	// Merge storage nodes
+	for owner, subset := range set.storageNodes {
+		current, exist := s.storageNodes[owner]
+		if !exist {
+			for path, n := range subset {
+				delta += int64(common.HashLength + len(n.Blob) + len(path))
+			}
+			s.storageNodes[owner] = maps.Clone(subset)
+			continue
+		}
+		for path, n := range subset {
+			if orig, exist := current[path]; !exist {
+				delta += int64(common.HashLength + len(n.Blob) + len(path))
+			} else {
+				delta += int64(len(n.Blob) - len(orig.Blob))
+			}
+			current[path] = n
+		}
+	}
+	s.updateSize(delta)
+}
+
+// write flushes the held trie nodes into the provided database batch. Deleted
+// nodes are removed from the database in place, which is what makes pruning
+// trivial in the path scheme. The number of written nodes is returned.
+// Original function: github.com/ethereum/go-ethereum/triedb/pathdb/flush.go line 29 (writeNodes)
+func (s *nodeSet) write(batch ethdb.Batch) (int, error) {
+	var total int
+	for path, n := range s.accountNodes {
+		var err error
+		if n.IsDeleted() {
+			err = rawdb.DeleteAccountTrieNode(batch, []byte(path))
+		} else {
+			err = rawdb.WriteAccountTrieNode(batch, []byte(path), n.Blob)
+		}
+		if err != nil {
+			return total, err
+		}
+		total++
+	}
+	for owner, subset := range s.storageNodes {
+		for path, n := range subset {
+			var err error
+			if n.IsDeleted() {
+				err = rawdb.DeleteStorageTrieNode(batch, owner, []byte(path))
+			} else {
+				err = rawdb.WriteStorageTrieNode(batch, owner, []byte(path), n.Blob)
+			}
+			if err != nil {
+				return total, err
+			}
+			total++
+		}
+	}
+	return total, nil
+}
+
+// reset clears the held trie nodes.
+func (s *nodeSet) reset() {
+	s.accountNodes = make(map[string]*trienode.Node)
+	s.storageNodes = make(map[common.Hash]map[string]*trienode.Node)
+	s.size = 0
+}
@@ -1,14 +1,42 @@
 package types
 
-import "storage_extract/common"
+import (
+	"storage_extract/common"
 
+	"github.com/holiman/uint256"
+)
+
+// StateAccount is the Ethereum consensus representation of accounts.
+// These objects are stored in the main account trie.
+// Original struct: github.com/ethereum/go-ethereum/core/types/state_account.go line 31
 type StateAccount struct {
-	Root common.Hash
+	Nonce    uint64
+	Balance  *uint256.Int
+	Root     common.Hash // merkle root of the storage trie
+	CodeHash []byte
+}
+
+// Copy returns a deep-copied state account object.
+// Original function: github.com/ethereum/go-ethereum/core/types/state_account.go line 47
+func (acct *StateAccount) Copy() *StateAccount {
+	var balance *uint256.Int
+	if acct.Balance != nil {
+		balance = new(uint256.Int).Set(acct.Balance)
+	}
+	return &StateAccount{
+		Nonce:    acct.Nonce,
+		Balance:  balance,
+		Root:     acct.Root,
+		CodeHash: common.CopyBytes(acct.CodeHash),
+	}
 }
 
-// NewEmptyStateAccount creates a new empty state account with a zero root hash.
+// NewEmptyStateAccount constructs an empty state account.
+// Original function: github.com/ethereum/go-ethereum/core/types/state_account.go line 38
 func NewEmptyStateAccount() *StateAccount {
 	return &StateAccount{
-		Root: EmptyRootHash,
+		Balance:  new(uint256.Int),
+		Root:     EmptyRootHash,
+		CodeHash: EmptyCodeHash.Bytes(),
 	}
 }
@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"storage_extract/common"
+	"storage_extract/params"
+)
+
+// GasSStoreEIP2200 implements gas cost for SSTORE according to EIP-2200,
+// the rules are as follows:
+//
+//	(0.) If *gasleft* is less than or equal to 2300, fail the current call.
+//	(1.) If current value equals new value (this is a no-op), SLOAD_GAS is deducted.
+//	(2.) If current value does not equal new value:
+//		(2.1.) If original value equals current value (this storage slot has not been changed by the current execution context):
+//			(2.1.1.) If original value is 0, SSTORE_SET_GAS (20K) gas is deducted.
+//			(2.1.2.) Otherwise, SSTORE_RESET_GAS gas is deducted. If new value is 0, add SSTORE_CLEARS_SCHEDULE to refund counter.
+//		(2.2.) If original value does not equal current value (this storage slot is dirty), SLOAD_GAS gas is deducted. Apply both of the following clauses:
+//			(2.2.1.) If original value is not 0:
+//				(2.2.1.1.) If current value is 0 (also means that new value is not 0), subtract SSTORE_CLEARS_SCHEDULE gas from refund counter.
+//				(2.2.1.2.) If new value is 0 (also means that current value is not 0), add SSTORE_CLEARS_SCHEDULE gas to refund counter.
+//			(2.2.2.) If original value equals new value (this storage slot is reset):
+//				(2.2.2.1.) If original value is 0, add SSTORE_SET_GAS - SLOAD_GAS to refund counter.
+//				(2.2.2.2.) Otherwise, add SSTORE_RESET_GAS - SLOAD_GAS gas to refund counter.
+//
+// Different from the original code, the reentrancy sentry (0.) is not checked
+// since there is no gas left to compare against.
+// Original function: github.com/ethereum/go-ethereum/core/vm/gas_table.go line 184
+func GasSStoreEIP2200(db StateDB, addr common.Address, slot, value common.Hash) uint64 {
+	current := db.GetState(addr, slot)
+	if current == value { // noop (1)
+		return params.SloadGasEIP2200
+	}
+	original := db.GetCommittedState(addr, slot)
+	if original == current {
+		if original == (common.Hash{}) { // create slot (2.1.1)
+			return params.SstoreSetGasEIP2200
+		}
+		if value == (common.Hash{}) { // delete slot (2.1.2b)
+			db.AddRefund(params.SstoreClearsScheduleRefundEIP2200)
+		}
+		return params.SstoreResetGasEIP2200 // write existing slot (2.1.2)
+	}
+	if original != (common.Hash{}) {
+		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
+			db.SubRefund(params.SstoreClearsScheduleRefundEIP2200)
+		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
+			db.AddRefund(params.SstoreClearsScheduleRefundEIP2200)
+		}
+	}
+	if original == value {
+		if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
+			db.AddRefund(params.SstoreSetGasEIP2200 - params.SloadGasEIP2200)
+		} else { // reset to original existing slot (2.2.2.2)
+			db.AddRefund(params.SstoreResetGasEIP2200 - params.SloadGasEIP2200)
+		}
+	}
+	return params.SloadGasEIP2200 // dirty update (2.2)
+}
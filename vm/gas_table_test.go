@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/state"
+	"storage_extract/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// pushGas is the gas of a PUSH1, which the vectors ported from go-ethereum
+// include in the gas used.
+const pushGas = 3
+
+// sstoreTest is an SSTORE gas vector: the code writes the slot 0 of an account
+// whose original value is given, and uses the given gas and refund.
+type sstoreTest struct {
+	original byte
+	input    string
+	used     uint64
+	refund   uint64
+}
+
+// runSStores runs the code of the vector with the given SSTORE gas function,
+// warming up the slot first if asked, and returns the gas used and the refund
+// counter. The code must only be made of PUSH1 value PUSH1 slot SSTORE
+// sequences, since there is no interpreter: the gas of the pushes is added to
+// the gas of the SSTOREs.
+func runSStores(t *testing.T, sstore SStoreGasFunc, tt sstoreTest, warm bool) (uint64, uint64) {
+	t.Helper()
+
+	address := common.BytesToAddress([]byte("contract"))
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.CreateAccount(address)
+	statedb.SetState(address, common.Hash{}, common.BytesToHash([]byte{tt.original}))
+	statedb.Finalise(false) // Push the state into the "original" slot
+	if warm {
+		statedb.AddSlotToAccessList(address, common.Hash{})
+	}
+
+	code := hexutil.MustDecode(tt.input)
+	if len(code)%5 != 0 {
+		t.Fatalf("%s: not a sequence of SSTOREs", tt.input)
+	}
+	var used uint64
+	for i := 0; i < len(code); i += 5 {
+		if code[i] != 0x60 || code[i+2] != 0x60 || code[i+4] != 0x55 {
+			t.Fatalf("%s: not a sequence of SSTOREs", tt.input)
+		}
+		slot, value := common.BytesToHash(code[i+3:i+4]), common.BytesToHash(code[i+1:i+2])
+		used += 2*pushGas + sstore(statedb, address, slot, value)
+		statedb.SetState(address, slot, value)
+	}
+	return used, statedb.GetRefund()
+}
+
+// The reentrancy sentry cases of the original vectors are left out, since the
+// gas left isn't checked.
+// Original code: github.com/ethereum/go-ethereum/core/vm/gas_table_test.go line 55
+var eip2200Tests = []sstoreTest{
+	{0, "0x60006000556000600055", 1612, 0},                // 0 -> 0 -> 0
+	{0, "0x60006000556001600055", 20812, 0},               // 0 -> 0 -> 1
+	{0, "0x60016000556000600055", 20812, 19200},           // 0 -> 1 -> 0
+	{0, "0x60016000556002600055", 20812, 0},               // 0 -> 1 -> 2
+	{0, "0x60016000556001600055", 20812, 0},               // 0 -> 1 -> 1
+	{1, "0x60006000556000600055", 5812, 15000},            // 1 -> 0 -> 0
+	{1, "0x60006000556001600055", 5812, 4200},             // 1 -> 0 -> 1
+	{1, "0x60006000556002600055", 5812, 0},                // 1 -> 0 -> 2
+	{1, "0x60026000556000600055", 5812, 15000},            // 1 -> 2 -> 0
+	{1, "0x60026000556003600055", 5812, 0},                // 1 -> 2 -> 3
+	{1, "0x60026000556001600055", 5812, 4200},             // 1 -> 2 -> 1
+	{1, "0x60026000556002600055", 5812, 0},                // 1 -> 2 -> 2
+	{1, "0x60016000556000600055", 5812, 15000},            // 1 -> 1 -> 0
+	{1, "0x60016000556002600055", 5812, 0},                // 1 -> 1 -> 2
+	{1, "0x60016000556001600055", 1612, 0},                // 1 -> 1 -> 1
+	{0, "0x600160005560006000556001600055", 40818, 19200}, // 0 -> 1 -> 0 -> 1
+	{1, "0x600060005560016000556000600055", 10818, 19200}, // 1 -> 0 -> 1 -> 0
+}
+
+// Original function: github.com/ethereum/go-ethereum/core/vm/gas_table_test.go line 78
+func TestEIP2200(t *testing.T) {
+	for i, tt := range eip2200Tests {
+		used, refund := runSStores(t, GasSStoreEIP2200, tt, false)
+		if used != tt.used {
+			t.Errorf("test %d: gas used mismatch: have %v, want %v", i, used, tt.used)
+		}
+		if refund != tt.refund {
+			t.Errorf("test %d: gas refund mismatch: have %v, want %v", i, refund, tt.refund)
+		}
+	}
+}
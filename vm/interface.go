@@ -0,0 +1,32 @@
+// Package vm implements the gas accounting of the storage opcodes.
+//
+// Different from the original code, there is no interpreter: the gas
+// functions are invoked directly with the accessed account and slot instead
+// of reading them from the stack of a running contract.
+package vm
+
+import (
+	"storage_extract/common"
+)
+
+// StateDB is an EVM database for full state querying.
+// Different from the original code, only the methods needed by the storage
+// gas accounting are included.
+// Original interface: github.com/ethereum/go-ethereum/core/vm/interface.go line 31
+type StateDB interface {
+	AddRefund(uint64)
+	SubRefund(uint64)
+	GetRefund() uint64
+
+	GetCommittedState(common.Address, common.Hash) common.Hash
+	GetState(common.Address, common.Hash) common.Hash
+
+	AddressInAccessList(addr common.Address) bool
+	SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool)
+	// AddAddressToAccessList adds the given address to the access list. This operation is safe to perform
+	// even if the feature/fork is not active yet
+	AddAddressToAccessList(addr common.Address)
+	// AddSlotToAccessList adds the given (address,slot) to the access list. This operation is safe to perform
+	// even if the feature/fork is not active yet
+	AddSlotToAccessList(addr common.Address, slot common.Hash)
+}
@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"storage_extract/common"
+	"storage_extract/params"
+)
+
+// SStoreGasFunc calculates the gas of an SSTORE writing the value into the
+// slot of the account, charging the refunds to the state.
+// Notice: This type is not included in the original code.
+type SStoreGasFunc func(db StateDB, addr common.Address, slot, value common.Hash) uint64
+
+// makeGasSStoreFunc creates the SSTORE gas function of EIP-2929 with the
+// given refund for clearing a slot.
+//
+// Different from the original code, the EIP-2200 reentrancy sentry is not
+// checked since there is no gas left to compare against.
+// Original function: github.com/ethereum/go-ethereum/core/vm/operations_acl.go line 29
+func makeGasSStoreFunc(clearingRefund uint64) SStoreGasFunc {
+	return func(db StateDB, addr common.Address, slot, value common.Hash) uint64 {
+		var (
+			current = db.GetState(addr, slot)
+			cost    = uint64(0)
+		)
+		// Check slot presence in the access list
+		if _, slotPresent := db.SlotInAccessList(addr, slot); !slotPresent {
+			cost = params.ColdSloadCostEIP2929
+			// If the caller cannot afford the cost, this change will be rolled back
+			db.AddSlotToAccessList(addr, slot)
+		}
+		if current == value { // noop (1)
+			// EIP 2200 original clause:
+			//		return params.SloadGasEIP2200, nil
+			return cost + params.WarmStorageReadCostEIP2929 // SLOAD_GAS
+		}
+		original := db.GetCommittedState(addr, slot)
+		if original == current {
+			if original == (common.Hash{}) { // create slot (2.1.1)
+				return cost + params.SstoreSetGasEIP2200
+			}
+			if value == (common.Hash{}) { // delete slot (2.1.2b)
+				db.AddRefund(clearingRefund)
+			}
+			// EIP-2200 original clause:
+			//		return params.SstoreResetGasEIP2200, nil // write existing slot (2.1.2)
+			return cost + (params.SstoreResetGasEIP2200 - params.ColdSloadCostEIP2929) // write existing slot (2.1.2)
+		}
+		if original != (common.Hash{}) {
+			if current == (common.Hash{}) { // recreate slot (2.2.1.1)
+				db.SubRefund(clearingRefund)
+			} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
+				db.AddRefund(clearingRefund)
+			}
+		}
+		if original == value {
+			if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
+				// EIP 2200 Original clause:
+				//evm.StateDB.AddRefund(params.SstoreSetGasEIP2200 - params.SloadGasEIP2200)
+				db.AddRefund(params.SstoreSetGasEIP2200 - params.WarmStorageReadCostEIP2929)
+			} else { // reset to original existing slot (2.2.2.2)
+				// EIP 2200 Original clause:
+				//	evm.StateDB.AddRefund(params.SstoreResetGasEIP2200 - params.SloadGasEIP2200)
+				// - SSTORE_RESET_GAS redefined as (5000 - COLD_SLOAD_COST)
+				// - SLOAD_GAS redefined as WARM_STORAGE_READ_COST
+				// Final: (5000 - COLD_SLOAD_COST) - WARM_STORAGE_READ_COST
+				db.AddRefund((params.SstoreResetGasEIP2200 - params.ColdSloadCostEIP2929) - params.WarmStorageReadCostEIP2929)
+			}
+		}
+		// EIP-2200 original clause:
+		//return params.SloadGasEIP2200, nil // dirty update (2.2)
+		return cost + params.WarmStorageReadCostEIP2929 // dirty update (2.2)
+	}
+}
+
+// GasSLoadEIP2929 calculates dynamic gas for SLOAD according to EIP-2929
+// For SLOAD, if the (address, storage_key) pair (where address is the address of the contract
+// whose storage is being read) is not yet in accessed_storage_keys,
+// charge 2100 gas and add the pair to accessed_storage_keys.
+// If the pair is already in accessed_storage_keys, charge 100 gas.
+// Original function: github.com/ethereum/go-ethereum/core/vm/operations_acl.go line 99
+func GasSLoadEIP2929(db StateDB, addr common.Address, slot common.Hash) uint64 {
+	// Check slot presence in the access list
+	if _, slotPresent := db.SlotInAccessList(addr, slot); !slotPresent {
+		// If the caller cannot afford the cost, this change will be rolled back
+		// If he does afford it, we can skip checking the same thing later on, during execution
+		db.AddSlotToAccessList(addr, slot)
+		return params.ColdSloadCostEIP2929
+	}
+	return params.WarmStorageReadCostEIP2929
+}
+
+var (
+	// GasSStoreEIP2929 implements gas cost for SSTORE according to EIP-2929
+	//
+	// When calling SSTORE, check if the (address, storage_key) pair is in accessed_storage_keys.
+	// If it is not, charge an additional COLD_SLOAD_COST gas, and add the pair to accessed_storage_keys.
+	// Additionally, modify the parameters defined in EIP 2200 as follows:
+	//
+	// Parameter 	Old value 	New value
+	// SLOAD_GAS 	800 	= WARM_STORAGE_READ_COST
+	// SSTORE_RESET_GAS 	5000 	5000 - COLD_SLOAD_COST
+	//
+	//The other parameters defined in EIP 2200 are unchanged.
+	// Original code: github.com/ethereum/go-ethereum/core/vm/operations_acl.go line 216
+	GasSStoreEIP2929 = makeGasSStoreFunc(params.SstoreClearsScheduleRefundEIP2200)
+
+	// GasSStoreEIP3529 implements gas cost for SSTORE according to EIP-3529
+	// Replace `SSTORE_CLEARS_SCHEDULE` with `SSTORE_RESET_GAS + ACCESS_LIST_STORAGE_KEY_COST` (4,800)
+	// Original code: github.com/ethereum/go-ethereum/core/vm/operations_acl.go line 220
+	GasSStoreEIP3529 = makeGasSStoreFunc(params.SstoreClearsScheduleRefundEIP3529)
+)
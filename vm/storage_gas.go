@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"storage_extract/common"
+	"storage_extract/params"
+)
+
+// StorageGas prices the storage opcodes of a transaction under the rules of a
+// fork:
+//
+//   - Istanbul: EIP-2200 net gas metering, SLOAD costs a flat 800 gas.
+//   - Berlin: EIP-2929 warm/cold slot access on top of EIP-2200.
+//   - London: the EIP-3529 reduced refunds on top of Berlin.
+//
+// Notice: This struct is not included in the original code.
+type StorageGas struct {
+	rules  params.Rules
+	sstore SStoreGasFunc
+}
+
+// NewStorageGas creates the storage gas calculator of the given rules, picking
+// the gas functions the way the jump tables of the forks do.
+// Notice: This function is not included in the original code.
+func NewStorageGas(rules params.Rules) *StorageGas {
+	g := &StorageGas{rules: rules, sstore: GasSStoreEIP2200}
+	switch {
+	case rules.IsLondon:
+		g.sstore = GasSStoreEIP3529
+	case rules.IsBerlin:
+		g.sstore = GasSStoreEIP2929
+	}
+	return g
+}
+
+// Rules returns the rules the gas is calculated by.
+// Notice: This function is not included in the original code.
+func (g *StorageGas) Rules() params.Rules {
+	return g.rules
+}
+
+// HasAccessList reports whether the slots are priced by their warm/cold
+// access, i.e. whether EIP-2929 is active.
+// Notice: This function is not included in the original code.
+func (g *StorageGas) HasAccessList() bool {
+	return g.rules.IsBerlin
+}
+
+// SLoad returns the gas of an SLOAD of the slot, warming it up if needed.
+// Notice: This function is not included in the original code.
+func (g *StorageGas) SLoad(db StateDB, addr common.Address, slot common.Hash) uint64 {
+	if !g.rules.IsBerlin {
+		return params.SloadGasEIP2200
+	}
+	return GasSLoadEIP2929(db, addr, slot)
+}
+
+// SStore returns the gas of an SSTORE writing the value into the slot and
+// charges its refund to the state. The value itself is not written.
+// Notice: This function is not included in the original code.
+func (g *StorageGas) SStore(db StateDB, addr common.Address, slot, value common.Hash) uint64 {
+	return g.sstore(db, addr, slot, value)
+}
+
+// Refund returns the amount of gas refunded to a transaction which used the
+// given gas and accumulated the given refund counter, i.e. the counter capped
+// to a fraction of the gas used.
+// Original function: github.com/ethereum/go-ethereum/core/state_transition.go line 624 (calcRefund)
+func (g *StorageGas) Refund(gasUsed, refund uint64) uint64 {
+	var limit uint64
+	if !g.rules.IsLondon {
+		// Before EIP-3529: refunds were capped to gasUsed / 2
+		limit = gasUsed / params.RefundQuotient
+	} else {
+		// After EIP-3529: refunds are capped to gasUsed / 5
+		limit = gasUsed / params.RefundQuotientEIP3529
+	}
+	if limit > refund {
+		limit = refund
+	}
+	return limit
+}
+
+// SStoreCase names the EIP-2200 case an SSTORE writing value falls in, given
+// the original value of the slot in the transaction and its current value.
+// Notice: This function is not included in the original code.
+func SStoreCase(original, current, value common.Hash) string {
+	switch {
+	case current == value:
+		return "noop"
+	case original == current && original == (common.Hash{}):
+		return "create slot"
+	case original == current && value == (common.Hash{}):
+		return "delete slot"
+	case original == current:
+		return "write existing slot"
+	case original == value && original == (common.Hash{}):
+		return "reset to original inexistent slot"
+	case original == value:
+		return "reset to original existing slot"
+	case original != (common.Hash{}) && current == (common.Hash{}):
+		return "recreate slot"
+	case original != (common.Hash{}) && value == (common.Hash{}):
+		return "delete dirty slot"
+	default:
+		return "dirty update"
+	}
+}
@@ -0,0 +1,179 @@
+package vm
+
+import (
+	"testing"
+
+	"storage_extract/common"
+	"storage_extract/ethdb/memorydb"
+	"storage_extract/params"
+	"storage_extract/state"
+	"storage_extract/types"
+)
+
+// eip3529Tests are the test cases of EIP-3529, in which the slot is already
+// warm.
+var eip3529Tests = []sstoreTest{
+	{0, "0x60006000556000600055", 212, 0},                 // 0 -> 0 -> 0
+	{0, "0x60006000556001600055", 20112, 0},               // 0 -> 0 -> 1
+	{0, "0x60016000556000600055", 20112, 19900},           // 0 -> 1 -> 0
+	{0, "0x60016000556002600055", 20112, 0},               // 0 -> 1 -> 2
+	{0, "0x60016000556001600055", 20112, 0},               // 0 -> 1 -> 1
+	{1, "0x60006000556000600055", 3012, 4800},             // 1 -> 0 -> 0
+	{1, "0x60006000556001600055", 3012, 2800},             // 1 -> 0 -> 1
+	{1, "0x60006000556002600055", 3012, 0},                // 1 -> 0 -> 2
+	{1, "0x60026000556000600055", 3012, 4800},             // 1 -> 2 -> 0
+	{1, "0x60026000556003600055", 3012, 0},                // 1 -> 2 -> 3
+	{1, "0x60026000556001600055", 3012, 2800},             // 1 -> 2 -> 1
+	{1, "0x60026000556002600055", 3012, 0},                // 1 -> 2 -> 2
+	{1, "0x60016000556000600055", 3012, 4800},             // 1 -> 1 -> 0
+	{1, "0x60016000556002600055", 3012, 0},                // 1 -> 1 -> 2
+	{1, "0x60016000556001600055", 212, 0},                 // 1 -> 1 -> 1
+	{0, "0x600160005560006000556001600055", 40118, 19900}, // 0 -> 1 -> 0 -> 1
+	{1, "0x600060005560016000556000600055", 5918, 7600},   // 1 -> 0 -> 1 -> 0
+}
+
+// eip2929Tests are the test cases of EIP-3529 under the Berlin rules: the gas
+// is the same, but clearing a slot refunds 15000 as in EIP-2200.
+var eip2929Tests = []sstoreTest{
+	{0, "0x60006000556000600055", 212, 0},                 // 0 -> 0 -> 0
+	{0, "0x60006000556001600055", 20112, 0},               // 0 -> 0 -> 1
+	{0, "0x60016000556000600055", 20112, 19900},           // 0 -> 1 -> 0
+	{0, "0x60016000556002600055", 20112, 0},               // 0 -> 1 -> 2
+	{0, "0x60016000556001600055", 20112, 0},               // 0 -> 1 -> 1
+	{1, "0x60006000556000600055", 3012, 15000},            // 1 -> 0 -> 0
+	{1, "0x60006000556001600055", 3012, 2800},             // 1 -> 0 -> 1
+	{1, "0x60006000556002600055", 3012, 0},                // 1 -> 0 -> 2
+	{1, "0x60026000556000600055", 3012, 15000},            // 1 -> 2 -> 0
+	{1, "0x60026000556003600055", 3012, 0},                // 1 -> 2 -> 3
+	{1, "0x60026000556001600055", 3012, 2800},             // 1 -> 2 -> 1
+	{1, "0x60026000556002600055", 3012, 0},                // 1 -> 2 -> 2
+	{1, "0x60016000556000600055", 3012, 15000},            // 1 -> 1 -> 0
+	{1, "0x60016000556002600055", 3012, 0},                // 1 -> 1 -> 2
+	{1, "0x60016000556001600055", 212, 0},                 // 1 -> 1 -> 1
+	{0, "0x600160005560006000556001600055", 40118, 19900}, // 0 -> 1 -> 0 -> 1
+	{1, "0x600060005560016000556000600055", 5918, 17800},  // 1 -> 0 -> 1 -> 0
+}
+
+// Tests the SSTORE gas and refunds of the forks with an access list, both with
+// the slot warm and cold, in which case the first access costs the cold
+// surcharge on top.
+func TestSStoreAccessList(t *testing.T) {
+	tests := []struct {
+		fork    string
+		vectors []sstoreTest
+	}{
+		{"berlin", eip2929Tests},
+		{"london", eip3529Tests},
+	}
+	for _, tt := range tests {
+		rules, err := params.RulesForFork(tt.fork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gas := NewStorageGas(rules)
+		for i, vector := range tt.vectors {
+			for _, warm := range []bool{true, false} {
+				want := vector.used
+				if !warm {
+					want += params.ColdSloadCostEIP2929
+				}
+				used, refund := runSStores(t, gas.SStore, vector, warm)
+				if used != want {
+					t.Errorf("%s test %d (warm %v): gas used mismatch: have %v, want %v", tt.fork, i, warm, used, want)
+				}
+				if refund != vector.refund {
+					t.Errorf("%s test %d (warm %v): gas refund mismatch: have %v, want %v", tt.fork, i, warm, refund, vector.refund)
+				}
+			}
+		}
+	}
+}
+
+// Tests that SLOAD costs a flat 800 gas before Berlin, and 2100 for the first
+// access to a slot and 100 for the later ones since.
+func TestSLoad(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	tests := []struct {
+		fork        string
+		first, next uint64
+	}{
+		{"istanbul", 800, 800},
+		{"berlin", 2100, 100},
+		{"london", 2100, 100},
+	}
+	for _, tt := range tests {
+		rules, err := params.RulesForFork(tt.fork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gas := NewStorageGas(rules)
+		if have := gas.SLoad(statedb, address, common.Hash{}); have != tt.first {
+			t.Errorf("%s: first SLOAD gas mismatch: have %d, want %d", tt.fork, have, tt.first)
+		}
+		if have := gas.SLoad(statedb, address, common.Hash{}); have != tt.next {
+			t.Errorf("%s: second SLOAD gas mismatch: have %d, want %d", tt.fork, have, tt.next)
+		}
+		if have := gas.SLoad(statedb, address, common.Hash{1}); have != tt.first {
+			t.Errorf("%s: SLOAD of another slot gas mismatch: have %d, want %d", tt.fork, have, tt.first)
+		}
+	}
+}
+
+// Tests that the refund is capped to a half of the gas used before London and
+// to a fifth since.
+func TestRefundCap(t *testing.T) {
+	tests := []struct {
+		fork            string
+		gasUsed, refund uint64
+		want            uint64
+	}{
+		{"istanbul", 40000, 19200, 19200},
+		{"istanbul", 30000, 19200, 15000},
+		{"berlin", 30000, 19900, 15000},
+		{"london", 30000, 4800, 4800},
+		{"london", 30000, 19900, 6000},
+	}
+	for i, tt := range tests {
+		rules, err := params.RulesForFork(tt.fork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := NewStorageGas(rules).Refund(tt.gasUsed, tt.refund); have != tt.want {
+			t.Errorf("test %d: refund mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests the names of the EIP-2200 cases an SSTORE falls in.
+func TestSStoreCase(t *testing.T) {
+	tests := []struct {
+		original, current, value byte
+		want                     string
+	}{
+		{0, 0, 0, "noop"},
+		{1, 2, 2, "noop"},
+		{0, 0, 1, "create slot"},
+		{1, 1, 0, "delete slot"},
+		{1, 1, 2, "write existing slot"},
+		{0, 1, 0, "reset to original inexistent slot"},
+		{1, 2, 1, "reset to original existing slot"},
+		{1, 0, 2, "recreate slot"},
+		{1, 2, 0, "delete dirty slot"},
+		{0, 1, 2, "dirty update"},
+		{1, 2, 3, "dirty update"},
+	}
+	for _, tt := range tests {
+		var (
+			original = common.BytesToHash([]byte{tt.original})
+			current  = common.BytesToHash([]byte{tt.current})
+			value    = common.BytesToHash([]byte{tt.value})
+		)
+		if have := SStoreCase(original, current, value); have != tt.want {
+			t.Errorf("%d -> %d -> %d: case mismatch: have %q, want %q", tt.original, tt.current, tt.value, have, tt.want)
+		}
+	}
+}